@@ -0,0 +1,383 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Analitik pemakaian kursi. Data mentah ada di logactivity, lalu diringkas
+// per hari ke analytics_daily dan analytics_hourly supaya query laporan
+// tidak perlu membaca seluruh histori.
+
+const dateLayout = "2006-01-02"
+
+// OccupancyRow adalah tingkat okupansi untuk satu kursi, zona, lantai atau divisi
+type OccupancyRow struct {
+	Key           string  `json:"key"`
+	Bookings      int     `json:"bookings"`
+	Cancellations int     `json:"cancellations"`
+	SeatDaysUsed  int     `json:"seat_days_used"`
+	Capacity      int     `json:"capacity_seat_days"`
+	OccupancyRate float64 `json:"occupancy_rate"`
+}
+
+type OccupancyReport struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	GroupBy string         `json:"group_by"`
+	Rows    []OccupancyRow `json:"rows"`
+}
+
+type HourCount struct {
+	Hour     int `json:"hour"`
+	Bookings int `json:"bookings"`
+}
+
+type WeekdayCount struct {
+	Weekday  string `json:"weekday"`
+	Bookings int    `json:"bookings"`
+}
+
+// UsageSummary berisi ringkasan pemakaian untuk rentang tanggal
+type UsageSummary struct {
+	From             string         `json:"from"`
+	To               string         `json:"to"`
+	Bookings         int            `json:"bookings"`
+	Cancellations    int            `json:"cancellations"`
+	CheckIns         int            `json:"check_ins"`
+	NoShows          int            `json:"no_shows"`
+	CancellationRate float64        `json:"cancellation_rate"`
+	NoShowRate       float64        `json:"no_show_rate"`
+	AvgLeadHours     float64        `json:"avg_lead_time_hours"`
+	PeakHours        []HourCount    `json:"peak_hours"`
+	Weekdays         []WeekdayCount `json:"weekdays"`
+}
+
+// Menghitung ulang rollup untuk satu tanggal (idempotent)
+func rollupDay(db *sql.DB, day time.Time) error {
+	date := day.Format(dateLayout)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM analytics_daily WHERE day = ?", date); err != nil {
+		return fmt.Errorf("failed to clear daily rollup: %v", err)
+	}
+	// No-show: booking yang tidak dibatalkan dan tidak pernah check-in setelah harinya lewat
+	_, err = tx.Exec(`
+		INSERT INTO analytics_daily (day, selected_seat, nama_divisi, bookings, cancellations, check_ins, no_shows, lead_seconds)
+		SELECT booked_for, selected_seat, nama_divisi,
+			COUNT(*),
+			SUM(cancelled_at IS NOT NULL),
+			SUM(checked_in_at IS NOT NULL),
+			SUM(cancelled_at IS NULL AND checked_in_at IS NULL AND booked_for < CURDATE()),
+			COALESCE(SUM(CASE WHEN checked_in_at IS NOT NULL THEN TIMESTAMPDIFF(SECOND, created_at, checked_in_at) END), 0)
+		FROM logactivity
+		WHERE booked_for = ?
+		GROUP BY booked_for, selected_seat, nama_divisi`, date)
+	if err != nil {
+		return fmt.Errorf("failed to build daily rollup: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM analytics_hourly WHERE day = ?", date); err != nil {
+		return fmt.Errorf("failed to clear hourly rollup: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO analytics_hourly (day, hour, bookings)
+		SELECT booked_for, HOUR(COALESCE(checked_in_at, created_at)), COUNT(*)
+		FROM logactivity
+		WHERE booked_for = ? AND cancelled_at IS NULL
+		GROUP BY booked_for, HOUR(COALESCE(checked_in_at, created_at))`, date)
+	if err != nil {
+		return fmt.Errorf("failed to build hourly rollup: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func rollupRange(db *sql.DB, from, to time.Time) error {
+	// Hari sebelum cutoff retensi sudah diarsipkan, rollup-nya dibekukan
+	if cutoff := retentionCutoff(); from.Before(cutoff) {
+		from = cutoff
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := rollupDay(db, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollup hari ini selalu dihitung ulang sebelum query karena datanya masih berubah
+func refreshTodayRollup(db *sql.DB, to time.Time) error {
+	today := time.Now().Format(dateLayout)
+	if to.Format(dateLayout) < today {
+		return nil
+	}
+	day, _ := time.Parse(dateLayout, today)
+	return rollupDay(db, day)
+}
+
+// Parsing ?from=&to= (YYYY-MM-DD), default 30 hari terakhir
+func parseAnalyticsRange(r *http.Request) (time.Time, time.Time, map[string]string) {
+	errs := make(map[string]string)
+	today, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+	from, to := today.AddDate(0, 0, -29), today
+
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		parsed, err := time.Parse(dateLayout, raw)
+		if err != nil {
+			errs["from"] = "must be a date in YYYY-MM-DD format"
+		}
+		from = parsed
+	}
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		parsed, err := time.Parse(dateLayout, raw)
+		if err != nil {
+			errs["to"] = "must be a date in YYYY-MM-DD format"
+		}
+		to = parsed
+	}
+	if len(errs) == 0 && to.Before(from) {
+		errs["to"] = "must not be before from"
+	}
+	if len(errs) == 0 && to.Sub(from) > 366*24*time.Hour {
+		errs["to"] = "range must not exceed one year"
+	}
+	return from, to, errs
+}
+
+// Kolom pengelompokan yang diizinkan untuk laporan okupansi
+var occupancyGroups = map[string]string{
+	"seat":     "a.selected_seat",
+	"zone":     "COALESCE(s.zone, '')",
+	"floor":    "COALESCE(s.floor, '')",
+	"division": "a.nama_divisi",
+}
+
+// Handler untuk GET /analytics/occupancy?from=&to=&group_by=seat|zone|floor|division
+func getOccupancyHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, errs := parseAnalyticsRange(r)
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "seat"
+	}
+	keyExpr, ok := occupancyGroups[groupBy]
+	if !ok {
+		errs["group_by"] = "must be one of: division, floor, seat, zone"
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	if err := refreshTodayRollup(db, to); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	fromDate, toDate := from.Format(dateLayout), to.Format(dateLayout)
+	days := int(to.Sub(from).Hours()/24) + 1
+
+	capacity, err := seatCapacity(db, groupBy, fromDate, toDate)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT %[1]s AS grp,
+			SUM(a.bookings), SUM(a.cancellations),
+			COUNT(DISTINCT CASE WHEN a.bookings > a.cancellations THEN CONCAT(a.day, '|', a.selected_seat) END)
+		FROM analytics_daily a
+		LEFT JOIN seats s ON s.code = a.selected_seat
+		WHERE a.day BETWEEN ? AND ?
+		GROUP BY grp
+		ORDER BY grp`, keyExpr), fromDate, toDate)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	report := OccupancyReport{From: fromDate, To: toDate, GroupBy: groupBy, Rows: []OccupancyRow{}}
+	for rows.Next() {
+		var row OccupancyRow
+		if err := rows.Scan(&row.Key, &row.Bookings, &row.Cancellations, &row.SeatDaysUsed); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		// Kursi per grup: seat = 1, zone/floor = jumlah kursi di grup, division = semua kursi
+		seats, ok := capacity[row.Key]
+		if !ok {
+			seats = capacity[""]
+		}
+		row.Capacity = seats * days
+		if row.Capacity > 0 {
+			row.OccupancyRate = float64(row.SeatDaysUsed) / float64(row.Capacity)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// Jumlah kursi per grup. Key "" berisi nilai default untuk grup yang tidak
+// terdaftar di tabel seats.
+func seatCapacity(db *sql.DB, groupBy, from, to string) (map[string]int, error) {
+	capacity := map[string]int{}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM seats").Scan(&total); err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		// Tabel seats belum diisi, pakai jumlah kursi yang pernah dibooking
+		err := db.QueryRow("SELECT COUNT(DISTINCT selected_seat) FROM analytics_daily WHERE day BETWEEN ? AND ?", from, to).Scan(&total)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch groupBy {
+	case "seat":
+		capacity[""] = 1
+	case "division":
+		capacity[""] = total
+	case "zone", "floor":
+		rows, err := db.Query(fmt.Sprintf("SELECT %s, COUNT(*) FROM seats GROUP BY %s", groupBy, groupBy))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key string
+			var count int
+			if err := rows.Scan(&key, &count); err != nil {
+				return nil, err
+			}
+			capacity[key] = count
+		}
+		if _, ok := capacity[""]; !ok {
+			capacity[""] = 1
+		}
+		return capacity, rows.Err()
+	}
+	return capacity, nil
+}
+
+// Handler untuk GET /analytics/summary?from=&to=
+func getUsageSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, errs := parseAnalyticsRange(r)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	if err := refreshTodayRollup(db, to); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	fromDate, toDate := from.Format(dateLayout), to.Format(dateLayout)
+	summary := UsageSummary{From: fromDate, To: toDate, PeakHours: []HourCount{}, Weekdays: []WeekdayCount{}}
+
+	var leadSeconds int64
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(bookings), 0), COALESCE(SUM(cancellations), 0), COALESCE(SUM(check_ins), 0),
+			COALESCE(SUM(no_shows), 0), COALESCE(SUM(lead_seconds), 0)
+		FROM analytics_daily
+		WHERE day BETWEEN ? AND ?`, fromDate, toDate).
+		Scan(&summary.Bookings, &summary.Cancellations, &summary.CheckIns, &summary.NoShows, &leadSeconds)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if summary.Bookings > 0 {
+		summary.CancellationRate = float64(summary.Cancellations) / float64(summary.Bookings)
+	}
+	if active := summary.Bookings - summary.Cancellations; active > 0 {
+		summary.NoShowRate = float64(summary.NoShows) / float64(active)
+	}
+	if summary.CheckIns > 0 {
+		summary.AvgLeadHours = float64(leadSeconds) / float64(summary.CheckIns) / 3600
+	}
+
+	hours, err := db.Query(`
+		SELECT hour, SUM(bookings)
+		FROM analytics_hourly
+		WHERE day BETWEEN ? AND ?
+		GROUP BY hour
+		ORDER BY SUM(bookings) DESC, hour`, fromDate, toDate)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer hours.Close()
+	for hours.Next() {
+		var h HourCount
+		if err := hours.Scan(&h.Hour, &h.Bookings); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		summary.PeakHours = append(summary.PeakHours, h)
+	}
+
+	weekdays, err := db.Query(`
+		SELECT DAYOFWEEK(day), SUM(bookings - cancellations)
+		FROM analytics_daily
+		WHERE day BETWEEN ? AND ?
+		GROUP BY DAYOFWEEK(day)
+		ORDER BY SUM(bookings - cancellations) DESC`, fromDate, toDate)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer weekdays.Close()
+	for weekdays.Next() {
+		var day, count int
+		if err := weekdays.Scan(&day, &count); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		// DAYOFWEEK MySQL: 1 = Minggu ... 7 = Sabtu
+		summary.Weekdays = append(summary.Weekdays, WeekdayCount{Weekday: time.Weekday(day - 1).String(), Bookings: count})
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// Handler untuk POST /analytics/rollup?from=&to=, membangun ulang rollup
+// misalnya setelah data lama diperbaiki
+func rebuildRollupHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, errs := parseAnalyticsRange(r)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	if err := rollupRange(db, from, to); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeMessage(w, http.StatusOK, fmt.Sprintf("Rollup rebuilt from %s to %s", from.Format(dateLayout), to.Format(dateLayout)))
+}
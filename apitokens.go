@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API token untuk akses tanpa login (dashboard, kiosk). Token berbentuk
+// sbk_<acak>, hanya hash-nya yang disimpan, dan diterima middleware yang
+// sama dengan JWT. Berbeda dengan JWT, token hanya boleh memanggil route
+// yang scope-nya dimiliki (lihat routeScope).
+//
+//	API_TOKEN_MAX_DAYS  masa berlaku maksimal (default 365)
+const apiTokenPrefix = "sbk_"
+
+var apiTokenMaxDays = getEnvInt("API_TOKEN_MAX_DAYS", 365)
+
+// account_type untuk service account, akun biasa bernilai "user"
+const accountService = "service"
+
+const (
+	auditAPITokenCreated      = "api_token.created"
+	auditAPITokenRevoked      = "api_token.revoked"
+	auditServiceAccountCreate = "service_account.created"
+)
+
+// Tag route yang boleh diakses API token. Route auth (login, 2FA, token,
+// kunci JWT), jobs dan ops hanya bisa dipanggil dengan login biasa.
+var apiTokenTags = []string{"analytics", "archive", "bookings", "contacts", "events", "exports", "notifications", "seats", "users", "webhooks"}
+
+// Scope yang dibutuhkan route: <tag>:read untuk GET, <tag>:write untuk
+// method lain. "" berarti route tidak bisa dipanggil dengan API token.
+func routeScope(rt route) string {
+	for _, tag := range apiTokenTags {
+		if rt.Tag == tag {
+			if rt.Method == http.MethodGet {
+				return tag + ":read"
+			}
+			return tag + ":write"
+		}
+	}
+	return ""
+}
+
+func validScopes() map[string]bool {
+	scopes := map[string]bool{}
+	for _, tag := range apiTokenTags {
+		scopes[tag+":read"] = true
+		scopes[tag+":write"] = true
+	}
+	return scopes
+}
+
+// Middleware scope, dipasang di dalam middleware auth. Request dengan JWT
+// tidak dibatasi scope.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := currentClaims(r)
+		if claims != nil && claims.APIToken && !hasScope(claims.Scopes, scope) {
+			if scope == "" {
+				writeError(w, r, http.StatusForbidden, codeInsufficientScope, "This endpoint cannot be used with an API token")
+				return
+			}
+			writeError(w, r, http.StatusForbidden, codeInsufficientScope, "API token is missing the "+scope+" scope")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	if scope == "" {
+		return false
+	}
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiTokens memverifikasi token sbk_ dari tabel api_tokens. Role dan
+// username dibaca dari pemilik token saat itu juga, jadi perubahan role
+// atau penghapusan akun langsung berlaku.
+type apiTokens struct {
+	db *sql.DB
+}
+
+func (t *apiTokens) Verify(ctx context.Context, token string) (*AccessClaims, error) {
+	var tokenID int64
+	var scopes string
+	claims := &AccessClaims{APIToken: true}
+	var userID int
+	err := t.db.QueryRowContext(ctx, `
+		SELECT t.id, t.scopes, t.mfa, u.id, u.username, u.role, u.must_change_password FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL AND t.expires_at > NOW()`, sha256Hex(token)).
+		Scan(&tokenID, &scopes, &claims.MFA, &userID, &claims.Username, &claims.Role, &claims.PasswordChangeRequired)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("unknown, revoked or expired api token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims.Subject = strconv.Itoa(userID)
+	claims.ID = strconv.FormatInt(tokenID, 10)
+	claims.Scopes = splitScopes(scopes)
+
+	// last_used_at cukup diperbarui paling sering sekali per menit. Gagal
+	// mencatatnya tidak membuat token yang valid ditolak.
+	_, err = t.db.ExecContext(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)`, tokenID)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to update api token last_used_at", "token_id", tokenID, "error", err)
+	}
+	return claims, nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, " ")
+}
+
+// bearerTokens memilih verifier berdasarkan bentuk token
+type bearerTokens struct {
+	jwt       TokenVerifier
+	apiTokens TokenVerifier
+}
+
+func (b bearerTokens) Verify(ctx context.Context, token string) (*AccessClaims, error) {
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return b.apiTokens.Verify(ctx, token)
+	}
+	return b.jwt.Verify(ctx, token)
+}
+
+// APIToken adalah metadata token, nilai token tidak pernah ditampilkan lagi
+type APIToken struct {
+	ID         int64    `json:"id"`
+	UserID     int      `json:"user_id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt string   `json:"last_used_at,omitempty"`
+	RevokedAt  string   `json:"revoked_at,omitempty"`
+	CreatedBy  string   `json:"created_by"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// Payload untuk membuat API token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // default 90
+}
+
+// Response pembuatan token, nilai token hanya ditampilkan sekali
+type CreatedAPIToken struct {
+	Token    string   `json:"token"`
+	APIToken APIToken `json:"api_token"`
+}
+
+// Payload untuk membuat service account
+type CreateServiceAccountRequest struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Fullname string `json:"fullname" validate:"required,max=100"`
+	Role     string `json:"role" validate:"required,oneof=admin anggota"`
+	Division string `json:"division" validate:"max=100"`
+}
+
+const apiTokenColumns = `id, user_id, name, token_prefix, scopes, CAST(expires_at AS CHAR), COALESCE(CAST(last_used_at AS CHAR), ''),
+	COALESCE(CAST(revoked_at AS CHAR), ''), created_by, CAST(created_at AS CHAR)`
+
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var t APIToken
+	var scopes string
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.ExpiresAt, &t.LastUsedAt,
+		&t.RevokedAt, &t.CreatedBy, &t.CreatedAt)
+	t.Scopes = splitScopes(scopes)
+	return t, err
+}
+
+func listAPITokens(db *sql.DB, userID int) ([]APIToken, error) {
+	rows, err := db.Query("SELECT "+apiTokenColumns+" FROM api_tokens WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Membuat token untuk userID. mfa ikut dari sesi pembuatnya supaya token
+// admin tetap lolos ADMIN_2FA_REQUIRED hanya jika dibuat dari sesi 2FA.
+func createAPIToken(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int, owner string, req CreateAPITokenRequest) {
+	errs := validateStruct(req)
+	if len(req.Scopes) == 0 {
+		errs["scopes"] = "is required"
+	}
+	valid := validScopes()
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, s := range req.Scopes {
+		if !valid[s] {
+			errs["scopes"] = fmt.Sprintf("unknown scope %q", s)
+			break
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = 90
+	}
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > apiTokenMaxDays {
+		errs["expires_in_days"] = fmt.Sprintf("must be between 1 and %d", apiTokenMaxDays)
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	sort.Strings(scopes)
+
+	secret, err := randomToken(32)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	token := apiTokenPrefix + secret
+	prefix := token[:len(apiTokenPrefix)+6]
+	expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+
+	mfa := false
+	if claims := currentClaims(r); claims != nil {
+		mfa = claims.MFA
+	}
+	result, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, mfa, created_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		userID, req.Name, prefix, sha256Hex(token), strings.Join(scopes, " "), mfa, currentUsername(r), expiresAt.Format(jobTimeLayout))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	created, err := scanAPIToken(db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?", id))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditAPITokenCreated, owner, fmt.Sprintf("id=%d scopes=%s", id, strings.Join(scopes, ",")))
+
+	writeJSON(w, http.StatusCreated, CreatedAPIToken{Token: token, APIToken: created})
+}
+
+// Handler untuk GET /me/tokens
+func getMyAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	tokens, err := listAPITokens(db, user.ID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// Handler untuk POST /me/tokens
+func createMyAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPITokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	createAPIToken(w, r, db, user.ID, user.Username, req)
+}
+
+// Handler untuk DELETE /me/tokens/{id}
+func revokeMyAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	revokeAPIToken(w, r, db, "AND user_id = ?", user.ID)
+}
+
+// Handler untuk DELETE /admin/api-tokens/{id}, bisa untuk token siapa saja
+func revokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	revokeAPIToken(w, r, db, "")
+}
+
+func revokeAPIToken(w http.ResponseWriter, r *http.Request, db *sql.DB, owner string, args ...interface{}) {
+	args = append([]interface{}{r.PathValue("id")}, args...)
+	result, err := db.Exec("UPDATE api_tokens SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL "+owner, args...)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No active API token with this ID")
+		return
+	}
+
+	var username string
+	err = db.QueryRow("SELECT u.username FROM api_tokens t JOIN users u ON u.id = t.user_id WHERE t.id = ?", r.PathValue("id")).Scan(&username)
+	if err != nil && err != sql.ErrNoRows {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditAPITokenRevoked, username, "id="+r.PathValue("id"))
+
+	writeMessage(w, http.StatusOK, "API token revoked")
+}
+
+// Handler untuk POST /admin/service-accounts. Service account tidak punya
+// password dan tidak bisa login, aksesnya hanya lewat API token.
+func createServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateServiceAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", req.Username).Scan(&exists); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if exists > 0 {
+		writeError(w, r, http.StatusConflict, codeConflict, "Username is already registered")
+		return
+	}
+	result, err := db.Exec(`
+		INSERT INTO users (username, fullname, password, role, division, status, account_type)
+		VALUES (?, ?, '', ?, ?, ?, ?)`,
+		req.Username, req.Fullname, req.Role, req.Division, userStatusActive, accountService)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditServiceAccountCreate, req.Username, "role="+req.Role)
+
+	writeJSON(w, http.StatusCreated, User{
+		ID: int(id), Username: req.Username, Fullname: req.Fullname, Role: req.Role,
+		Division: req.Division, Status: userStatusActive, AccountType: accountService,
+	})
+}
+
+// ID service account dari path, menulis 404 jika bukan service account
+func serviceAccountID(w http.ResponseWriter, r *http.Request, db *sql.DB) (int, string, bool) {
+	var id int
+	var username string
+	err := db.QueryRow("SELECT id, username FROM users WHERE id = ? AND account_type = ?", r.PathValue("id"), accountService).
+		Scan(&id, &username)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Service account not found")
+		return 0, "", false
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return 0, "", false
+	}
+	return id, username, true
+}
+
+// Handler untuk GET /admin/service-accounts/{id}/tokens
+func getServiceAccountTokensHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	id, _, ok := serviceAccountID(w, r, db)
+	if !ok {
+		return
+	}
+	tokens, err := listAPITokens(db, id)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// Handler untuk POST /admin/service-accounts/{id}/tokens
+func createServiceAccountTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPITokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	id, username, ok := serviceAccountID(w, r, db)
+	if !ok {
+		return
+	}
+	createAPIToken(w, r, db, id, username, req)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAPITokenVerifyIgnoresLastUsedFailure(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT t.id, t.scopes").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "mfa", "user_id", "username", "role", "must_change_password"}).
+			AddRow(4, "bookings:read", false, 7, "budi", roleMember, false))
+	mock.ExpectExec("UPDATE api_tokens SET last_used_at").WithArgs(4).
+		WillReturnError(errors.New("lock wait timeout"))
+
+	db := setupDatabase()
+	defer db.Close()
+	claims, err := (&apiTokens{db: db}).Verify(context.Background(), apiTokenPrefix+"abc")
+	if err != nil || claims.Username != "budi" {
+		t.Fatalf("claims = %+v, err = %v", claims, err)
+	}
+}
+
+// Router dengan handler asli diganti stub yang selalu menjawab 204
+func stubbedRouter(t *testing.T, verifier TokenVerifier) http.Handler {
+	stubbed := make([]route, len(routes))
+	for i, rt := range routes {
+		rt.Handler = func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+		stubbed[i] = rt
+	}
+	prevRoutes, prevVerifier := routes, tokenVerifier
+	routes, tokenVerifier = stubbed, verifier
+	t.Cleanup(func() { routes, tokenVerifier = prevRoutes, prevVerifier })
+	return newRouter()
+}
+
+// Token test "sbk_<scope>,<scope>..." menjadi API token admin dengan scope itu
+var scopedTestTokens = verifierFunc(func(token string) (*AccessClaims, error) {
+	scopes, ok := strings.CutPrefix(token, apiTokenPrefix)
+	if !ok {
+		return nil, errors.New("unknown test token")
+	}
+	return &AccessClaims{Username: "admin", Role: roleAdmin, MFA: true, APIToken: true, Scopes: strings.Split(scopes, ",")}, nil
+})
+
+func TestRouterEnforcesAPITokenScopes(t *testing.T) {
+	router := stubbedRouter(t, scopedTestTokens)
+	mock := useMockDB(t)
+	all := []string{}
+	for scope := range validScopes() {
+		all = append(all, scope)
+	}
+	sort.Strings(all)
+
+	call := func(rt route, scopes []string) *httptest.ResponseRecorder {
+		if rt.Auth == authActive {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM users WHERE username = ?")).WithArgs("admin").
+				WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(userStatusActive))
+		}
+		req := httptest.NewRequest(rt.Method, pathParamPattern.ReplaceAllString(rt.Path, "1"), nil)
+		req.Header.Set("Authorization", "Bearer "+apiTokenPrefix+strings.Join(scopes, ","))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, rt := range routes {
+		if rt.Auth == "" {
+			continue
+		}
+		name := rt.Method + " " + rt.Path
+		scope := routeScope(rt)
+		switch rt.Tag {
+		case "auth", "jobs", "ops":
+			if scope != "" {
+				t.Errorf("%s: API tokens allowed with scope %q", name, scope)
+			}
+		}
+
+		// Semua scope sekaligus tetap tidak membuka route tanpa scope
+		rec := call(rt, all)
+		if scope == "" {
+			if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), codeInsufficientScope) {
+				t.Errorf("%s answered %d for an API token: %s", name, rec.Code, rec.Body)
+			}
+			continue
+		}
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s answered %d for a token with every scope: %s", name, rec.Code, rec.Body)
+		}
+
+		// Scope tag yang sama untuk operasi lain, misalnya read untuk write
+		other := strings.TrimSuffix(scope, ":read") + ":read"
+		if other == scope {
+			other = strings.TrimSuffix(scope, ":read") + ":write"
+		}
+		for _, scopes := range [][]string{{other}, nil} {
+			if rec := call(rt, scopes); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), scope) {
+				t.Errorf("%s answered %d for scopes %v: %s", name, rec.Code, scopes, rec.Body)
+			}
+		}
+	}
+}
+
+func TestRouterRejectsRevokedOrExpiredAPIToken(t *testing.T) {
+	mock := useMockDB(t)
+	db := setupDatabase()
+	defer db.Close()
+	router := stubbedRouter(t, bearerTokens{jwt: testTokens, apiTokens: &apiTokens{db: db}})
+	token := apiTokenPrefix + "rahasia"
+	lookup := regexp.QuoteMeta("WHERE t.token_hash = ? AND t.revoked_at IS NULL AND t.expires_at > NOW()")
+
+	// Token dicabut atau kedaluwarsa tidak lolos filter query
+	mock.ExpectQuery(lookup).WithArgs(sha256Hex(token)).WillReturnError(sql.ErrNoRows)
+	// Token yang masih berlaku
+	mock.ExpectQuery(lookup).WithArgs(sha256Hex(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "mfa", "user_id", "username", "role", "must_change_password"}).
+			AddRow(4, "seats:write", true, 7, "admin", roleAdmin, false))
+	mock.ExpectExec("UPDATE api_tokens SET last_used_at").WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	for _, want := range []int{http.StatusUnauthorized, http.StatusNoContent} {
+		req := httptest.NewRequest("PUT", "/seats/A1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Proteksi brute force untuk login dan register:
+//   - token bucket per IP (login dan register) dan per username (login)
+//   - jeda yang makin lama setiap kali password salah
+//   - akun dikunci sementara setelah LOGIN_LOCKOUT_THRESHOLD kali gagal
+type AuthGuardConfig struct {
+	LoginPerIP    bucketLimit
+	LoginPerUser  bucketLimit
+	RegisterPerIP bucketLimit
+	Lockout       lockoutPolicy
+	DelayBase     time.Duration
+	DelayMax      time.Duration
+	Store         string
+}
+
+func loadAuthGuardConfig() AuthGuardConfig {
+	return AuthGuardConfig{
+		LoginPerIP: bucketLimit{
+			Burst:  getEnvInt("LOGIN_MAX_PER_IP", 20),
+			Window: getEnvDuration("LOGIN_IP_WINDOW", 15*time.Minute),
+		},
+		LoginPerUser: bucketLimit{
+			Burst:  getEnvInt("LOGIN_MAX_PER_USER", 10),
+			Window: getEnvDuration("LOGIN_USER_WINDOW", 15*time.Minute),
+		},
+		RegisterPerIP: bucketLimit{
+			Burst:  getEnvInt("REGISTER_MAX_PER_IP", 5),
+			Window: getEnvDuration("REGISTER_IP_WINDOW", time.Hour),
+		},
+		Lockout: lockoutPolicy{
+			Threshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+			Window:    getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			Duration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		},
+		DelayBase: getEnvDuration("LOGIN_DELAY_BASE", 250*time.Millisecond),
+		DelayMax:  getEnvDuration("LOGIN_DELAY_MAX", 5*time.Second),
+		Store:     getEnv("RATE_LIMIT_STORE", "memory"),
+	}
+}
+
+const (
+	limitLogin    = "login"
+	limitRegister = "register"
+)
+
+var (
+	authGuard = loadAuthGuardConfig()
+	// Diganti di main jika RATE_LIMIT_STORE=database
+	authLimiter LimiterStore = newMemoryLimiterStore()
+)
+
+// Hash pembanding untuk username yang tidak ada, supaya waktu respon sama
+// dengan password salah dan username tidak bisa ditebak dari latency
+var dummyPasswordHash, _ = hashPassword("sibakar-dummy-password")
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Middleware throttle untuk route dengan Limit login/register
+func throttle(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		limit := authGuard.LoginPerIP
+		if kind == limitRegister {
+			limit = authGuard.RegisterPerIP
+		}
+		if !takeOrReject(w, r, kind+":ip:"+ip, limit, kind) {
+			return
+		}
+
+		if kind == limitLogin {
+			username := peekUsername(r)
+			if username != "" {
+				if !checkLockout(w, r, username) {
+					return
+				}
+				if !takeOrReject(w, r, "login:user:"+username, authGuard.LoginPerUser, kind) {
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Mengambil token dari bucket, menulis 429 dan mengembalikan false jika habis.
+// Jika store error, request tetap dilanjutkan supaya login tidak mati total.
+// Request yang ditolak tidak dicatat ke audit log (hanya metrik) supaya
+// serangan tidak berubah menjadi banjir tulis ke database.
+func takeOrReject(w http.ResponseWriter, r *http.Request, key string, limit bucketLimit, kind string) bool {
+	allowed, wait, err := authLimiter.Take(r.Context(), key, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rate limiter unavailable", "key", key, "error", err)
+		return true
+	}
+	if allowed {
+		return true
+	}
+
+	metricRateLimited.Inc(kind, strings.SplitN(key, ":", 3)[1])
+	if kind == limitLogin {
+		metricLogins.Inc("rate_limited")
+	}
+	setRetryAfter(w, wait)
+	writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "Too many attempts, please try again later")
+	return false
+}
+
+func checkLockout(w http.ResponseWriter, r *http.Request, username string) bool {
+	f, err := authLimiter.Failures(r.Context(), username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rate limiter unavailable", "error", err)
+		return true
+	}
+	now := time.Now()
+	if !f.Locked(now) {
+		return true
+	}
+	metricLogins.Inc("locked")
+	setRetryAfter(w, f.LockedUntil.Sub(now))
+	writeError(w, r, http.StatusTooManyRequests, codeAccountLocked, "Account is temporarily locked after too many failed attempts")
+	return false
+}
+
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// Membaca username dari body JSON tanpa mengonsumsi body untuk handler
+func peekUsername(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		Username string `json:"username"`
+	}
+	json.Unmarshal(body, &payload)
+	return normalizeUsername(payload.Username)
+}
+
+// Dipanggil loginHandler saat username atau password salah: menambah
+// hitungan gagal, mencatat lockout ke audit log, lalu menahan respon
+// sesuai jumlah kegagalan sebelum membalas 401.
+func loginFailed(w http.ResponseWriter, r *http.Request, db *sql.DB, username string) {
+	failLogin(w, r, db, username, "Invalid username or password")
+}
+
+// Seperti loginFailed dengan pesan 401 sendiri, dipakai juga oleh langkah 2FA
+func failLogin(w http.ResponseWriter, r *http.Request, db *sql.DB, username, message string) {
+	metricLogins.Inc("failure")
+	username = normalizeUsername(username)
+
+	f, err := authLimiter.RecordFailure(r.Context(), username, authGuard.Lockout)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to record login failure", "error", err)
+	}
+	if f.Count == authGuard.Lockout.Threshold {
+		slog.WarnContext(r.Context(), "account locked", "username", username, "ip", clientIP(r))
+		recordAudit(db, r, auditLoginLocked, username,
+			fmt.Sprintf("%d failed attempts, locked until %s", f.Count, f.LockedUntil.Format(time.RFC3339)))
+	}
+
+	sleepContext(r.Context(), loginDelay(f.Count))
+	writeError(w, r, http.StatusUnauthorized, codeUnauthorized, message)
+}
+
+func loginSucceeded(r *http.Request, username string) {
+	if err := authLimiter.ResetFailures(r.Context(), normalizeUsername(username)); err != nil {
+		slog.ErrorContext(r.Context(), "failed to reset login failures", "error", err)
+	}
+}
+
+// Jeda bertingkat: base, 2x base, 4x base, ... sampai DelayMax
+func loginDelay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := authGuard.DelayBase
+	for i := 1; i < failures && delay < authGuard.DelayMax; i++ {
+		delay *= 2
+	}
+	return min(delay, authGuard.DelayMax)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// LoginLockout adalah akun dengan hitungan login gagal yang masih aktif
+type LoginLockout struct {
+	Username      string `json:"username"`
+	Failures      int    `json:"failures"`
+	LastFailureAt string `json:"last_failure_at"`
+	Locked        bool   `json:"locked"`
+	LockedUntil   string `json:"locked_until,omitempty"`
+}
+
+// Handler untuk GET /admin/lockouts
+func getLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := authLimiter.ListFailures(r.Context(), authGuard.Lockout)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	lockouts := make([]LoginLockout, 0, len(list))
+	for _, f := range list {
+		l := LoginLockout{
+			Username:      f.Username,
+			Failures:      f.Count,
+			LastFailureAt: f.LastFailure.Format(time.RFC3339),
+			Locked:        f.Locked(now),
+		}
+		if l.Locked {
+			l.LockedUntil = f.LockedUntil.Format(time.RFC3339)
+		}
+		lockouts = append(lockouts, l)
+	}
+	writeJSON(w, http.StatusOK, lockouts)
+}
+
+// Handler untuk DELETE /admin/lockouts/{username}
+func clearLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	username := normalizeUsername(r.PathValue("username"))
+	f, err := authLimiter.Failures(r.Context(), username)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if f.Count == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No failed logins recorded for this user")
+		return
+	}
+	if err := authLimiter.ResetFailures(r.Context(), username); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+	recordAudit(db, r, auditLoginLockoutClear, username, fmt.Sprintf("cleared %d failed attempts", f.Count))
+
+	writeMessage(w, http.StatusOK, "Lockout cleared")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoginDelay(t *testing.T) {
+	prev := authGuard
+	authGuard.DelayBase, authGuard.DelayMax = 250*time.Millisecond, 5*time.Second
+	t.Cleanup(func() { authGuard = prev })
+
+	for failures, want := range map[int]time.Duration{
+		-1: 0,
+		0:  0,
+		1:  250 * time.Millisecond,
+		2:  500 * time.Millisecond,
+		3:  time.Second,
+		5:  4 * time.Second,
+		6:  5 * time.Second,
+		50: 5 * time.Second,
+	} {
+		if got := loginDelay(failures); got != want {
+			t.Errorf("loginDelay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestThrottleLockout(t *testing.T) {
+	useFreshLimiter(t)
+	authGuard.Lockout = lockoutPolicy{Threshold: 3, Window: 15 * time.Minute, Duration: 10 * time.Minute}
+	authGuard.LoginPerIP = bucketLimit{Burst: 100, Window: time.Minute}
+	authGuard.LoginPerUser = bucketLimit{Burst: 100, Window: time.Minute}
+	reached := 0
+	handler := throttle(limitLogin, func(w http.ResponseWriter, r *http.Request) {
+		reached++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	login := func(username string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username":"`+username+`","password":"x"}`)))
+		return rec
+	}
+
+	for i := 0; i < authGuard.Lockout.Threshold; i++ {
+		if _, err := authLimiter.RecordFailure(context.Background(), "budi", authGuard.Lockout); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Username dinormalisasi sebelum dicek
+	rec := login(" Budi ")
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), codeAccountLocked) {
+		t.Fatalf("locked account: status = %d, body %s", rec.Code, rec.Body)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "600" && retry != "599" {
+		t.Errorf("Retry-After = %q", retry)
+	}
+	if rec := login("siti"); rec.Code != http.StatusNoContent {
+		t.Errorf("other account: status = %d", rec.Code)
+	}
+	if reached != 1 {
+		t.Errorf("handler reached %d times, want 1", reached)
+	}
+
+	// Setelah kunci lewat, login kembali diteruskan ke handler
+	store := authLimiter.(*memoryLimiterStore)
+	f := store.failures["budi"]
+	f.LockedUntil = time.Now().Add(-time.Second)
+	store.failures["budi"] = f
+	if rec := login("budi"); rec.Code != http.StatusNoContent {
+		t.Errorf("after lock expiry: status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestThrottlePerUserBucket(t *testing.T) {
+	useFreshLimiter(t)
+	authGuard.LoginPerIP = bucketLimit{Burst: 100, Window: time.Minute}
+	authGuard.LoginPerUser = bucketLimit{Burst: 2, Window: time.Minute}
+	handler := throttle(limitLogin, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNoContent, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username":"budi"}`)))
+		if rec.Code != want {
+			t.Fatalf("attempt %d: status = %d, want %d", i+1, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && !strings.Contains(rec.Body.String(), codeRateLimited) {
+			t.Errorf("body %s", rec.Body)
+		}
+	}
+}
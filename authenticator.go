@@ -0,0 +1,170 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Authenticator memeriksa username dan password untuk POST /login dan
+// mengembalikan akun lokal yang dipakai untuk membuat token. Backend dipilih
+// lewat AUTH_BACKENDS, dipisah koma dan dicoba berurutan (default local),
+// contoh "ldap,local" supaya admin lokal tetap bisa masuk saat LDAP mati.
+type Authenticator interface {
+	Authenticate(r *http.Request, db *sql.DB, username, password string) (User, error)
+}
+
+const (
+	authBackendLocal = "local"
+	authBackendLDAP  = "ldap"
+)
+
+var (
+	// Backend tidak mengenal username, backend berikutnya dicoba
+	errUnknownUser = errors.New("unknown user")
+	// Username dikenal tetapi password salah
+	errInvalidCredentials = errors.New("invalid credentials")
+	// Username sudah dipakai akun yang tidak tertaut ke backend ini
+	errUsernameTaken = errors.New("username belongs to another account")
+	// Pengguna tidak termasuk grup yang diizinkan
+	errGroupNotAllowed = errors.New("user is not in an allowed group")
+	// Server backend (misalnya LDAP) tidak bisa dihubungi
+	errBackendUnavailable = errors.New("auth backend unavailable")
+)
+
+// Dibuat di main dari AUTH_BACKENDS
+var authenticator Authenticator
+
+func newAuthenticator(backends []string) (Authenticator, error) {
+	var chain chainAuthenticator
+	for _, name := range backends {
+		switch name {
+		case authBackendLocal:
+			chain = append(chain, localAuthenticator{})
+		case authBackendLDAP:
+			if ldapConfig.URL == "" || ldapConfig.BaseDN == "" {
+				return nil, errors.New("ldap backend requires LDAP_URL and LDAP_BASE_DN")
+			}
+			chain = append(chain, &ldapAuthenticator{cfg: ldapConfig})
+		default:
+			return nil, fmt.Errorf("unknown auth backend %q", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no auth backend configured")
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+// chainAuthenticator mencoba backend berurutan. Backend berikutnya hanya
+// dicoba jika backend sebelumnya tidak mengenal username atau sedang error;
+// password salah langsung ditolak.
+type chainAuthenticator []Authenticator
+
+func (c chainAuthenticator) Authenticate(r *http.Request, db *sql.DB, username, password string) (User, error) {
+	var lastErr error = errUnknownUser
+	for _, backend := range c {
+		user, err := backend.Authenticate(r, db, username, password)
+		if err == nil || errors.Is(err, errInvalidCredentials) ||
+			errors.Is(err, errUsernameTaken) || errors.Is(err, errGroupNotAllowed) {
+			return user, err
+		}
+		if !errors.Is(err, errUnknownUser) {
+			slog.WarnContext(r.Context(), "auth backend failed, trying next", "error", err)
+			lastErr = err
+		}
+	}
+	return User{}, lastErr
+}
+
+// localAuthenticator memeriksa password bcrypt/argon2id di tabel users
+type localAuthenticator struct{}
+
+func (localAuthenticator) Authenticate(r *http.Request, db *sql.DB, username, password string) (User, error) {
+	user, err := getUserByUsername(db, username)
+	if err != nil && err != sql.ErrNoRows {
+		return User{}, err
+	}
+	// Username yang tidak ada tetap dicek dengan hash pembanding supaya
+	// waktunya sama dengan password salah
+	hash := user.Password
+	if err == sql.ErrNoRows {
+		hash = dummyPasswordHash
+	}
+	ok, needsRehash := verifyPassword(password, hash)
+	// Akun SSO/LDAP tidak punya password lokal, biarkan backend lain memeriksa
+	if err == sql.ErrNoRows || user.Password == "" {
+		return User{}, errUnknownUser
+	}
+	if !ok || user.AccountType == accountService {
+		return User{}, errInvalidCredentials
+	}
+	if needsRehash {
+		rehashPassword(r, db, user.ID, password)
+	}
+	return user, nil
+}
+
+// Pemetaan grup dari IdP atau direktori ke role dan divisi. Diatur lewat
+// env <PREFIX>_ADMIN_GROUPS, <PREFIX>_ALLOWED_GROUPS dan <PREFIX>_DIVISION_MAP.
+// Nama grup dibandingkan tanpa membedakan huruf besar kecil.
+type groupMapping struct {
+	AdminGroups   []string
+	AllowedGroups []string
+	DivisionMap   map[string]string
+	DivisionOrder []string
+}
+
+func loadGroupMapping(prefix string) groupMapping {
+	m := groupMapping{
+		AdminGroups:   getEnvList(prefix+"_ADMIN_GROUPS", nil),
+		AllowedGroups: getEnvList(prefix+"_ALLOWED_GROUPS", nil),
+		DivisionMap:   map[string]string{},
+	}
+	for _, pair := range getEnvList(prefix+"_DIVISION_MAP", nil) {
+		group, division, ok := strings.Cut(pair, "=")
+		if !ok {
+			slog.Warn("ignoring invalid division map entry", "env", prefix+"_DIVISION_MAP", "entry", pair)
+			continue
+		}
+		group = strings.TrimSpace(group)
+		m.DivisionMap[group] = strings.TrimSpace(division)
+		m.DivisionOrder = append(m.DivisionOrder, group)
+	}
+	return m
+}
+
+func containsAny(list, want []string) bool {
+	for _, a := range list {
+		for _, b := range want {
+			if strings.EqualFold(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Menentukan role dan divisi dari grup. ok false jika pengguna tidak
+// termasuk grup yang diizinkan.
+func (m groupMapping) mapGroups(groups []string) (role, division string, ok bool) {
+	role = roleMember
+	if containsAny(groups, m.AdminGroups) {
+		role = roleAdmin
+	} else if len(m.AllowedGroups) > 0 && !containsAny(groups, m.AllowedGroups) {
+		return "", "", false
+	}
+	for _, group := range m.DivisionOrder {
+		if containsAny(groups, []string{group}) {
+			division = m.DivisionMap[group]
+			break
+		}
+	}
+	return role, division, true
+}
@@ -2,18 +2,27 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// Kode error MySQL untuk pelanggaran unique index
+const mysqlErrDuplicateEntry = 1062
+
 // Booking struct
 type Booking struct {
-	Namalengkap  string `json:"namalengkap"`
-	Nama_divisi  string `json:"nama_divisi"`
-	SelectedSeat string `json:"selected_seat"`
-	Status       string `json:"status"`
+	ID           int64  `json:"id"`
+	Namalengkap  string `json:"namalengkap" validate:"required,max=100"`
+	Nama_divisi  string `json:"nama_divisi" validate:"required,max=100"`
+	SelectedSeat string `json:"selected_seat" validate:"required,max=20"`
+	Status       string `json:"status" validate:"required,oneof=occupied available"`
+	BookedFor    string `json:"booked_for,omitempty" validate:"date"` // tanggal pemakaian kursi, default hari ini
+	UserID       int    `json:"user_id"`                              // pemilik booking, diisi dari token
 }
 
 func resetSeatToAvailable(db *sql.DB) error {
@@ -26,31 +35,6 @@ func resetSeatToAvailable(db *sql.DB) error {
 	}
 	return nil
 }
-func scheduleSeatReset(db *sql.DB) {
-	go func() {
-		for {
-			currentTime := time.Now()
-
-			resetHour := 20
-			nextReset := time.Date(currentTime.Year(), currentTime.Month(), currentTime.Day(), resetHour, 0, 0, 0, time.Local)
-
-			if currentTime.After(nextReset) {
-				nextReset = nextReset.Add(24 * time.Hour)
-			}
-			waitDuration := nextReset.Sub(currentTime)
-			fmt.Printf("Waiting for %v until next reset at 8 malam..\n", waitDuration)
-
-			time.Sleep(waitDuration)
-
-			if err := resetSeatToAvailable(db); err != nil {
-				fmt.Printf("Error resetting seats: %v\n", err)
-			} else {
-				fmt.Println("Seats have been reset to available")
-			}
-		}
-	}()
-}
-
 func isBookingTimeValid() bool {
 	currentTime := time.Now()
 	startHour := 7 // Jam mulai (8 pagi)
@@ -62,47 +46,80 @@ func isBookingTimeValid() bool {
 
 // Booking handler
 func bookingHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	if !isBookingTimeValid() {
-		http.Error(w, "Booking hanya dapat dilakukan antara jam 8 pagi hingga 8 malam.", http.StatusForbidden)
+		metricBookings.Inc("rejected_time_policy")
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Booking hanya dapat dilakukan antara jam 8 pagi hingga 8 malam.")
 		return
 	}
 
 	var booking Booking
-	if err := json.NewDecoder(r.Body).Decode(&booking); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &booking) {
+		return
+	}
+	booking.UserID, _ = strconv.Atoi(currentClaims(r).Subject)
+	today := time.Now().Format("2006-01-02")
+	if booking.BookedFor == "" {
+		booking.BookedFor = today
+	}
+	errs := validateStruct(booking)
+	if _, invalid := errs["booked_for"]; !invalid && booking.BookedFor < today {
+		errs["booked_for"] = "must not be in the past"
+	}
+	if len(errs) > 0 {
+		metricBookings.Inc("invalid")
+		writeValidationError(w, r, errs)
 		return
 	}
-	fmt.Printf("Booking data received: %+v\n", booking)
 
 	db := setupDatabase()
 	defer db.Close()
 
-	if err := saveBooking(db, booking); err != nil {
-		http.Error(w, "Error saving booking", http.StatusInternalServerError)
+	bookingID, err := saveBooking(db, booking)
+	// Kursi yang sama tidak boleh dipesan dua kali untuk tanggal yang sama,
+	// dijaga unique index uniq_logactivity_active_seat
+	if errors.Is(err, errSeatTaken) {
+		metricBookings.Inc("conflict")
+		writeError(w, r, http.StatusConflict, codeConflict, "Seat is already booked for this date")
+		return
+	}
+	if err != nil {
+		metricBookings.Inc("error")
+		writeInternalError(w, r, err)
 		return
 	}
+	metricBookings.Inc("created")
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(booking)
+	booking.ID = bookingID
+	owner := sql.NullInt64{Int64: int64(booking.UserID), Valid: booking.UserID != 0}
+	logNotifyError(r, notifyBookingOwner(db, owner, booking.Namalengkap, notifyBookingConfirmed, map[string]string{
+		"seat":       booking.SelectedSeat,
+		"date":       booking.BookedFor,
+		"booking_id": strconv.FormatInt(bookingID, 10),
+	}))
+
+	writeJSON(w, http.StatusCreated, booking)
 }
 
-func saveBooking(db *sql.DB, booking Booking) error {
+var errSeatTaken = errors.New("seat is already booked for this date")
+
+func saveBooking(db *sql.DB, booking Booking) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	// Memasukkan data pemesanan
-	result, err := db.Exec(`
+	result, err := tx.Exec(`
 		INSERT INTO bookings (selected_seat) 
 		VALUES (?)`, booking.SelectedSeat)
 	if err != nil {
-		return fmt.Errorf("failed to insert into bookings table: %v", err)
+		return 0, fmt.Errorf("failed to insert into bookings table: %v", err)
 	}
 
 	bookingID, err := result.LastInsertId()
 	if err != nil {
-		return fmt.Errorf("failed to get last insert ID: %v", err)
+		return 0, fmt.Errorf("failed to get last insert ID: %v", err)
 	}
 
 	// // Tentukan status berdasarkan status dari frontend
@@ -115,15 +132,92 @@ func saveBooking(db *sql.DB, booking Booking) error {
 
 	// Memasukkan data pemesanan dan status ke logactivity
 	// Memasukkan data pemesanan ke dalam tabel logactivity
-	_, err = db.Exec(`
-		INSERT INTO logactivity (id, namalengkap, nama_divisi, selected_seat, status)
-		VALUES (?, ?, ?, ?, ?)`,
-		bookingID, booking.Namalengkap, booking.Nama_divisi, booking.SelectedSeat, booking.Status)
+	_, err = tx.Exec(`
+		INSERT INTO logactivity (id, namalengkap, nama_divisi, selected_seat, status, booked_for, user_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		bookingID, booking.Namalengkap, booking.Nama_divisi, booking.SelectedSeat, booking.Status, booking.BookedFor, booking.UserID)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		return 0, errSeatTaken
+	}
 	if err != nil {
-		return fmt.Errorf("failed to insert into logactivity table: %v", err)
+		return 0, fmt.Errorf("failed to insert into logactivity table: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
 	}
 
-	return nil
+	booking.ID = bookingID
+	logWebhookError(webhookBookingCreated, publishWebhookEvent(db, webhookBookingCreated, booking))
+
+	return bookingID, nil
+}
+
+// Handler untuk check-in, menandai kursi benar-benar dipakai
+func checkInBookingHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	if !authorizeBooking(w, r, db, pathID(r, "id")) {
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE logactivity
+		SET checked_in_at = NOW()
+		WHERE id = ? AND cancelled_at IS NULL AND checked_in_at IS NULL`, pathID(r, "id"))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusConflict, codeConflict, "Booking not found, already checked in or cancelled")
+		return
+	}
+	logWebhookError(webhookBookingCheckedIn, publishWebhookEvent(db, webhookBookingCheckedIn, map[string]string{"id": pathID(r, "id")}))
+
+	writeMessage(w, http.StatusOK, "Checked in successfully")
+}
+
+// Handler untuk membatalkan booking, kursi kembali tersedia
+func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	bookingID := pathID(r, "id")
+
+	db := setupDatabase()
+	defer db.Close()
+
+	if !authorizeBooking(w, r, db, bookingID) {
+		return
+	}
+
+	result, err := db.Exec(`
+		UPDATE logactivity
+		SET cancelled_at = NOW(), status = 'available'
+		WHERE id = ? AND cancelled_at IS NULL AND checked_in_at IS NULL`, bookingID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusConflict, codeConflict, "Booking not found, already checked in or cancelled")
+		return
+	}
+	if _, err := db.Exec("UPDATE bookings SET status = 'available' WHERE id = ?", bookingID); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	var owner sql.NullInt64
+	var name, seat, bookedFor string
+	err = db.QueryRow("SELECT user_id, namalengkap, selected_seat, CAST(booked_for AS CHAR) FROM logactivity WHERE id = ?", bookingID).
+		Scan(&owner, &name, &seat, &bookedFor)
+	if err == nil {
+		err = notifyBookingOwner(db, owner, name, notifyBookingCancelled, map[string]string{"seat": seat, "date": bookedFor, "booking_id": bookingID})
+	}
+	logNotifyError(r, err)
+	logWebhookError(webhookBookingCancelled, publishWebhookEvent(db, webhookBookingCancelled, map[string]string{"id": bookingID}))
+
+	writeMessage(w, http.StatusOK, "Booking cancelled successfully")
 }
 
 func getOccupiedSeatsHandler(w http.ResponseWriter, r *http.Request) {
@@ -131,13 +225,13 @@ func getOccupiedSeatsHandler(w http.ResponseWriter, r *http.Request) {
 	db := setupDatabase()
 	defer db.Close()
 
-	// Query to get occupied seats
+	// Query to get occupied seats, hanya booking aktif untuk hari ini
 	rows, err := db.Query(`
 		SELECT selected_seat
 		FROM logactivity
-		WHERE status = 'occupied'`) // Pastikan menggunakan status 'occupied'
+		WHERE booked_for = CURDATE() AND status = 'occupied' AND cancelled_at IS NULL`)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
 	defer rows.Close()
@@ -147,30 +241,27 @@ func getOccupiedSeatsHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var seat string
 		if err := rows.Scan(&seat); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, err)
 			return
 		}
 		occupiedSeats = append(occupiedSeats, seat)
 	}
 
 	// Debug log: Print the occupied seats
-	fmt.Printf("Occupied seats: %+v\n", occupiedSeats)
 
 	// Ensure that the response is an array in JSON format
-	w.Header().Set("Content-Type", "application/json")
 	if len(occupiedSeats) == 0 {
 		// Return an empty array if no occupied seats
-		json.NewEncoder(w).Encode([]string{})
-		return
+		occupiedSeats = []string{}
 	}
-	json.NewEncoder(w).Encode(occupiedSeats)
+	writeJSON(w, http.StatusOK, occupiedSeats)
 }
 
 func getBookingActivityHandler(w http.ResponseWriter, r *http.Request) {
-	// Ambil ID booking dari parameter query
-	bookingID := r.URL.Query().Get("booking_id")
+	// Ambil ID booking dari path, atau parameter query untuk path lama
+	bookingID := pathID(r, "booking_id")
 	if bookingID == "" {
-		http.Error(w, "Booking ID is required", http.StatusBadRequest)
+		writeValidationError(w, r, map[string]string{"booking_id": "is required"})
 		return
 	}
 
@@ -183,7 +274,7 @@ func getBookingActivityHandler(w http.ResponseWriter, r *http.Request) {
 		FROM logactivity 
 		WHERE id = ?`, bookingID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
 	defer rows.Close()
@@ -192,7 +283,7 @@ func getBookingActivityHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var namalengkap, namaDivisi, selectedSeat, status, createdAt string
 		if err := rows.Scan(&namalengkap, &namaDivisi, &selectedSeat, &status, &createdAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeInternalError(w, r, err)
 			return
 		}
 		activities = append(activities, map[string]interface{}{
@@ -204,6 +295,29 @@ func getBookingActivityHandler(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(activities)
+	writeJSON(w, http.StatusOK, activities)
+}
+
+// Hanya pemilik booking atau admin yang boleh mengubah booking. Menulis
+// 404/403 dan mengembalikan false jika tidak boleh.
+func authorizeBooking(w http.ResponseWriter, r *http.Request, db *sql.DB, bookingID string) bool {
+	claims := currentClaims(r)
+	var owner sql.NullInt64
+	err := db.QueryRow("SELECT user_id FROM logactivity WHERE id = ?", bookingID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Booking not found")
+		return false
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return false
+	}
+	if claims.Role == roleAdmin && (!twoFactorConfig.AdminRequired || claims.MFA) {
+		return true
+	}
+	if !owner.Valid || strconv.FormatInt(owner.Int64, 10) != claims.Subject {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "You can only change your own bookings")
+		return false
+	}
+	return true
 }
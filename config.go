@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Membaca environment variable, pakai nilai default jika kosong
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Membaca daftar yang dipisahkan koma, contoh: "casino,crypto,viagra"
+func getEnvList(key string, fallback []string) []string {
+	raw := getEnv(key, "")
+	if raw == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -2,94 +2,184 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
 )
 
 // Struktur data untuk Contact
 type Contact struct {
-	FirstName string `json:"first_name"`
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name"`
-	Email     string `json:"email"`
-	Phone     string `json:"phone"`
-	Message   string `json:"message"`
+	Email     string `json:"email" validate:"required,email"`
+	Phone     string `json:"phone" validate:"phone"`
+	Message   string `json:"message" validate:"required"`
+	SpamScore int    `json:"spam_score"`
+	Flagged   bool   `json:"flagged"`
+
+	// Field anti-spam dari form, tidak disimpan ke database
+	Website       string `json:"website,omitempty"`
+	FormStartedAt int64  `json:"form_started_at,omitempty"`
+	IPAddress     string `json:"-"`
 }
 
 // Fungsi untuk menyimpan data kontak ke dalam database
 func saveContact(db *sql.DB, contact Contact) error {
-	_, err := db.Exec(`
-		INSERT INTO contacts (first_name, last_name, email, phone, message) 
-		VALUES (?, ?, ?, ?, ?)`,
-		contact.FirstName, contact.LastName, contact.Email, contact.Phone, contact.Message)
-	return err
-}
-func getContacts(db *sql.DB) ([]Contact, error) {
-	rows, err := db.Query("SELECT first_name, last_name, email, phone, message FROM contacts")
+	result, err := db.Exec(`
+		INSERT INTO contacts (first_name, last_name, email, phone, message, spam_score, flagged, ip_address) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		contact.FirstName, contact.LastName, contact.Email, contact.Phone, contact.Message,
+		contact.SpamScore, contact.Flagged, contact.IPAddress)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var contacts []Contact
-	for rows.Next() {
-		var contact Contact
-		if err := rows.Scan(&contact.FirstName, &contact.LastName, &contact.Email, &contact.Phone, &contact.Message); err != nil {
-			return nil, err
-		}
-		contacts = append(contacts, contact)
+	// Pesan yang ditandai spam tidak diteruskan ke sistem lain
+	if !contact.Flagged {
+		id, _ := result.LastInsertId()
+		contact.ID = int(id)
+		contact.Website, contact.FormStartedAt = "", 0
+		logWebhookError(webhookContactReceived, publishWebhookEvent(db, webhookContactReceived, contact))
 	}
-	return contacts, nil
+	return nil
+}
+
+var contactListSpec = listSpec{
+	Table:       "contacts",
+	Sortable:    map[string]string{"id": "id", "email": "email", "created_at": "created_at", "spam_score": "spam_score"},
+	DefaultSort: "id",
+	// Filter: ?email=&flagged=true|false
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		p.FilterParam(r, "email", "email")
+		switch r.URL.Query().Get("flagged") {
+		case "":
+		case "true":
+			p.Filter("flagged = 1")
+		case "false":
+			p.Filter("flagged = 0")
+		default:
+			errs["flagged"] = "must be true or false"
+		}
+	},
+}
+
+func getContacts(db *sql.DB, page *pageRequest) (Page, error) {
+	return page.Query(db, "id, first_name, last_name, email, phone, message, spam_score, flagged", func() (interface{}, []interface{}) {
+		contact := &Contact{}
+		return contact, []interface{}{&contact.ID, &contact.FirstName, &contact.LastName, &contact.Email, &contact.Phone, &contact.Message, &contact.SpamScore, &contact.Flagged}
+	})
 }
 
 // Handler untuk menangani form kontak
 func ContactHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	// Mendekode data kontak yang dikirimkan dalam request body
+	var contact Contact
+	if !decodeJSON(w, r, &contact) {
 		return
 	}
+	contact.Email = strings.TrimSpace(contact.Email)
 
-	// Mendekode data kontak yang dikirimkan dalam request body
-	var contact Contact
-	if err := json.NewDecoder(r.Body).Decode(&contact); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	thanks := "Thank you for contacting us! We will get back to you shortly."
+
+	// Bot yang terkena honeypot tetap mendapat respon sukses agar tidak tahu sudah diblokir
+	if looksLikeBot(contact) {
+		slog.InfoContext(r.Context(), "contact submission dropped by bot check", "ip", clientIP(r))
+		writeMessage(w, http.StatusOK, thanks)
+		return
+	}
+
+	if errs := validateContact(contact); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	contact.IPAddress = clientIP(r)
+	if !contactIPLimiter.Allow(contact.IPAddress, contactGuard.MaxPerIP, contactGuard.RateWindow) ||
+		!contactMailLimiter.Allow(strings.ToLower(contact.Email), contactGuard.MaxPerEmail, contactGuard.RateWindow) {
+		writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "Too many submissions, please try again later")
+		return
+	}
+
+	fingerprint := contactFingerprint(contact)
+	if !contactDuplicates.Claim(fingerprint, contactGuard.DuplicateWindow) {
+		writeError(w, r, http.StatusConflict, codeConflict, "Duplicate submission")
 		return
 	}
 
+	contact.SpamScore = spamScore(contact)
+	contact.Flagged = contact.SpamScore >= contactGuard.FlagThreshold
+
 	// Setup koneksi database
 	db := setupDatabase()
 	defer db.Close()
 
 	// Simpan data kontak ke dalam database
 	if err := saveContact(db, contact); err != nil {
-		http.Error(w, "Failed to save contact", http.StatusInternalServerError)
+		contactDuplicates.Forget(fingerprint)
+		writeInternalError(w, r, err)
 		return
 	}
 
 	// Tampilkan log di konsol server untuk debugging
-	fmt.Printf("New contact form submission: %+v\n", contact)
+	slog.InfoContext(r.Context(), "contact form submitted", "spam_score", contact.SpamScore, "flagged", contact.Flagged)
 
 	// Kirim response dengan pesan terima kasih
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Thank you for contacting us! We will get back to you shortly.",
-	})
+	writeMessage(w, http.StatusOK, thanks)
 }
 
 func getContactsHandlers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	page, errs := parsePageRequest(r, contactListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	contacts, err := getContacts(db, page)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writePage(w, r, contacts)
+}
+
+// Handler untuk mengambil satu kontak berdasarkan ID
+func getContactHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	var contact Contact
+	err := db.QueryRow("SELECT id, first_name, last_name, email, phone, message, spam_score, flagged FROM contacts WHERE id = ?", pathID(r, "id")).
+		Scan(&contact.ID, &contact.FirstName, &contact.LastName, &contact.Email, &contact.Phone, &contact.Message, &contact.SpamScore, &contact.Flagged)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Contact not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
 		return
 	}
 
+	writeJSON(w, http.StatusOK, contact)
+}
+
+// Handler untuk menghapus kontak berdasarkan ID
+func deleteContactHandler(w http.ResponseWriter, r *http.Request) {
 	db := setupDatabase()
 	defer db.Close()
 
-	contacts, err := getContacts(db)
+	result, err := db.Exec("DELETE FROM contacts WHERE id = ?", pathID(r, "id"))
 	if err != nil {
-		http.Error(w, "failed to retrieve contacts", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(contacts)
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Contact not found")
+		return
+	}
+
+	writeMessage(w, http.StatusOK, "Contact deleted successfully")
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Konfigurasi proteksi spam untuk form kontak
+type ContactGuardConfig struct {
+	MaxPerIP         int
+	MaxPerEmail      int
+	RateWindow       time.Duration
+	MinFillTime      time.Duration
+	DuplicateWindow  time.Duration
+	SpamKeywords     []string
+	MaxURLs          int
+	FlagThreshold    int
+	MaxMessageLength int
+	MaxNameLength    int
+}
+
+func loadContactGuardConfig() ContactGuardConfig {
+	return ContactGuardConfig{
+		MaxPerIP:         getEnvInt("CONTACT_MAX_PER_IP", 5),
+		MaxPerEmail:      getEnvInt("CONTACT_MAX_PER_EMAIL", 3),
+		RateWindow:       getEnvDuration("CONTACT_RATE_WINDOW", time.Hour),
+		MinFillTime:      getEnvDuration("CONTACT_MIN_FILL_TIME", 3*time.Second),
+		DuplicateWindow:  getEnvDuration("CONTACT_DUPLICATE_WINDOW", 24*time.Hour),
+		SpamKeywords:     getEnvList("CONTACT_SPAM_KEYWORDS", []string{"casino", "viagra", "crypto", "bitcoin", "loan", "judi", "slot gacor", "pinjol"}),
+		MaxURLs:          getEnvInt("CONTACT_MAX_URLS", 2),
+		FlagThreshold:    getEnvInt("CONTACT_SPAM_THRESHOLD", 3),
+		MaxMessageLength: getEnvInt("CONTACT_MAX_MESSAGE_LENGTH", 2000),
+		MaxNameLength:    getEnvInt("CONTACT_MAX_NAME_LENGTH", 100),
+	}
+}
+
+var (
+	contactGuard       = loadContactGuardConfig()
+	contactIPLimiter   = newRateLimiter()
+	contactMailLimiter = newRateLimiter()
+	contactDuplicates  = newDuplicateTracker()
+
+	phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 \-]{6,19}$`)
+	urlPattern   = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+)
+
+// rateLimiter menghitung jumlah request per key dalam jendela waktu (sliding window)
+type rateLimiter struct {
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{hits: make(map[string][]time.Time), lastSweep: time.Now()}
+}
+
+// Allow mencatat satu hit untuk key dan mengembalikan false jika batas terlampaui
+func (l *rateLimiter) Allow(key string, limit int, window time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-window)
+	// Key (misalnya email) dipilih oleh pengirim, jadi key yang sudah
+	// kosong dibuang berkala agar map tidak tumbuh tanpa batas
+	if now.Sub(l.lastSweep) >= window {
+		for k, hits := range l.hits {
+			if !hits[len(hits)-1].After(cutoff) {
+				delete(l.hits, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	recent := l.hits[key][:0]
+	for _, t := range l.hits[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		l.hits[key] = recent
+		return false
+	}
+	l.hits[key] = append(recent, now)
+	return true
+}
+
+// duplicateTracker mengingat hash pesan yang sudah dikirim dalam jendela waktu tertentu
+type duplicateTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newDuplicateTracker() *duplicateTracker {
+	return &duplicateTracker{seen: make(map[string]time.Time)}
+}
+
+// Claim mencatat key dan mengembalikan false jika key sudah tercatat dalam
+// window. Cek dan catat dalam satu lock agar dua kiriman identik yang datang
+// bersamaan tidak sama-sama lolos.
+func (d *duplicateTracker) Claim(key string, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range d.seen {
+		if now.Sub(t) > window {
+			delete(d.seen, k)
+		}
+	}
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// Forget melepas key yang gagal disimpan agar kiriman ulang tidak dianggap duplikat
+func (d *duplicateTracker) Forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
+
+// Reverse proxy yang boleh mengirim X-Forwarded-For, diatur lewat env
+// TRUSTED_PROXIES berisi IP atau CIDR dipisah koma, contoh
+// "127.0.0.1,10.0.0.0/8". Kosong berarti header itu selalu diabaikan.
+var trustedProxies = loadTrustedProxies()
+
+func loadTrustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range getEnvList("TRUSTED_PROXIES", nil) {
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			slog.Warn("ignoring invalid trusted proxy", "env", "TRUSTED_PROXIES", "entry", entry)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mengambil IP client. X-Forwarded-For hanya dipakai jika koneksi datang
+// dari proxy tepercaya, dibaca dari kanan dan berhenti di alamat pertama
+// yang bukan proxy tepercaya. Nilai yang bukan IP diabaikan supaya tidak
+// bisa dipakai untuk memalsukan key rate limit.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	if peer == nil {
+		return host
+	}
+	if !isTrustedProxy(peer) {
+		return peer.String()
+	}
+
+	client := peer
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !isTrustedProxy(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// Validasi field kontak: aturan dasar dari tag struct, ditambah batas
+// panjang yang bisa dikonfigurasi lewat environment
+func validateContact(contact Contact) map[string]string {
+	errs := validateStruct(contact)
+
+	if _, ok := errs["first_name"]; !ok && utf8.RuneCountInString(contact.FirstName) > contactGuard.MaxNameLength {
+		errs["first_name"] = "is too long"
+	}
+	if utf8.RuneCountInString(contact.LastName) > contactGuard.MaxNameLength {
+		errs["last_name"] = "is too long"
+	}
+	if _, ok := errs["message"]; !ok && utf8.RuneCountInString(strings.TrimSpace(contact.Message)) > contactGuard.MaxMessageLength {
+		errs["message"] = "is too long"
+	}
+
+	return errs
+}
+
+// Menghitung skor spam dari kata kunci dan jumlah URL di dalam pesan
+func spamScore(contact Contact) int {
+	text := strings.ToLower(contact.FirstName + " " + contact.LastName + " " + contact.Message)
+
+	score := 0
+	for _, keyword := range contactGuard.SpamKeywords {
+		if strings.Contains(text, strings.ToLower(keyword)) {
+			score++
+		}
+	}
+	if urls := len(urlPattern.FindAllString(contact.Message, -1)); urls > contactGuard.MaxURLs {
+		score += urls - contactGuard.MaxURLs
+	}
+	return score
+}
+
+// Hash untuk deteksi pengiriman ganda (email + isi pesan)
+func contactFingerprint(contact Contact) string {
+	normalized := strings.ToLower(strings.TrimSpace(contact.Email)) + "|" + strings.Join(strings.Fields(strings.ToLower(contact.Message)), " ")
+	return sha256Hex(normalized)
+}
+
+// Cek honeypot dan waktu pengisian form. Bot biasanya mengisi semua field
+// (termasuk field tersembunyi "website") dan submit dalam hitungan milidetik.
+// Form asli selalu mengirim form_started_at, jadi nilai kosong juga dianggap bot.
+func looksLikeBot(contact Contact) bool {
+	if contact.Website != "" || contact.FormStartedAt <= 0 {
+		return true
+	}
+	return time.Since(time.UnixMilli(contact.FormStartedAt)) < contactGuard.MinFillTime
+}
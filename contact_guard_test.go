@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestClientIP(t *testing.T) {
+	prev := trustedProxies
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1, 172.16.0.0/12,2001:db8::/32,bukan-ip")
+	trustedProxies = loadTrustedProxies()
+	t.Cleanup(func() { trustedProxies = prev })
+
+	for _, tc := range []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct client", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"untrusted peer cannot spoof", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left-most hop is ignored", "10.0.0.1:4000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:4000", []string{"198.51.100.1, 172.20.0.3"}, "198.51.100.1"},
+		{"multiple headers", "10.0.0.1:4000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"garbage falls back to peer", "10.0.0.1:4000", []string{strings.Repeat("x", 300)}, "10.0.0.1"},
+		{"garbage stops the walk", "10.0.0.1:4000", []string{"198.51.100.1, x' OR 1=1"}, "10.0.0.1"},
+		{"empty header", "10.0.0.1:4000", []string{""}, "10.0.0.1"},
+		{"ipv6 proxy", "[2001:db8::1]:4000", []string{"2001:db8:ffff::9, 2001:db8::2"}, "2001:db8:ffff::9"},
+		{"ipv6 client normalised", "[2001:0DB8:0000::0001]:4000", nil, "2001:db8::1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tc.remote
+		for _, v := range tc.forwarded {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		if got := clientIP(r); got != tc.want {
+			t.Errorf("%s: clientIP = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLooksLikeBot(t *testing.T) {
+	now := time.Now()
+	for name, tc := range map[string]struct {
+		contact Contact
+		want    bool
+	}{
+		"honeypot filled":       {Contact{Website: "spam.example", FormStartedAt: now.Add(-time.Minute).UnixMilli()}, true},
+		"missing start time":    {Contact{}, true},
+		"submitted too quickly": {Contact{FormStartedAt: now.UnixMilli()}, true},
+		"start time in future":  {Contact{FormStartedAt: now.Add(time.Hour).UnixMilli()}, true},
+		"human":                 {Contact{FormStartedAt: now.Add(-time.Minute).UnixMilli()}, false},
+	} {
+		if got := looksLikeBot(tc.contact); got != tc.want {
+			t.Errorf("%s: looksLikeBot = %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestContactDuplicateRecordedAfterSave(t *testing.T) {
+	prev := contactDuplicates
+	contactDuplicates = newDuplicateTracker()
+	t.Cleanup(func() { contactDuplicates = prev })
+
+	started := time.Now().Add(-time.Minute).UnixMilli()
+	body := `{"first_name":"Budi","email":"budi@example.com","message":"Halo, saya ingin bertanya.","form_started_at":` + strconv.FormatInt(started, 10) + `}`
+	submit := func() int {
+		r := httptest.NewRequest("POST", "/contact", strings.NewReader(body))
+		r.RemoteAddr = "203.0.113.77:4000"
+		rec := httptest.NewRecorder()
+		ContactHandler(rec, r)
+		return rec.Code
+	}
+
+	// Gagal simpan: kiriman ulang tidak boleh dianggap duplikat
+	mock := useMockDB(t)
+	mock.ExpectExec("INSERT INTO contacts").WillReturnError(errors.New("database down"))
+	if code := submit(); code != http.StatusInternalServerError {
+		t.Fatalf("first submit status = %d", code)
+	}
+	mock.ExpectExec("INSERT INTO contacts").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows(nil))
+	if code := submit(); code != http.StatusOK {
+		t.Fatalf("retry status = %d", code)
+	}
+	if code := submit(); code != http.StatusConflict {
+		t.Fatalf("duplicate status = %d", code)
+	}
+}
+
+func TestDuplicateClaimIsAtomic(t *testing.T) {
+	d := newDuplicateTracker()
+	var wg sync.WaitGroup
+	var claimed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if d.Claim("sama", time.Hour) {
+				claimed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed.Load() != 1 {
+		t.Fatalf("claimed %d times, want 1", claimed.Load())
+	}
+	d.Forget("sama")
+	if !d.Claim("sama", time.Hour) {
+		t.Fatal("key is still claimed after Forget")
+	}
+}
+
+func TestRateLimiterPrunesIdleKeys(t *testing.T) {
+	l := newRateLimiter()
+	for i := 0; i < 100; i++ {
+		l.Allow(strconv.Itoa(i)+"@example.com", 3, 20*time.Millisecond)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !l.Allow("baru@example.com", 3, 20*time.Millisecond) {
+		t.Fatal("fresh key was limited")
+	}
+	if len(l.hits) != 1 {
+		t.Fatalf("limiter still holds %d keys, want 1", len(l.hits))
+	}
+}
@@ -2,29 +2,26 @@
 package main
 
 import (
-	// Pastikan database/sql digunakan
-	"encoding/json"
+	"database/sql"
 	"net/http"
 )
 
 // Event struct untuk merepresentasikan event dalam database
 type Event struct {
 	ID     int    `json:"id"`
-	Name   string `json:"name"`
-	Time   string `json:"time"`
-	Detail string `json:"detail"`
+	Name   string `json:"name" validate:"required,max=150"`
+	Time   string `json:"time" validate:"required,max=50"`
+	Detail string `json:"detail" validate:"max=2000"`
 }
 
 // CreateEventHandler untuk membuat event baru
 func createEventHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	var event Event
+	if !decodeJSON(w, r, &event) {
 		return
 	}
-
-	var event Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if errs := validateStruct(event); len(errs) > 0 {
+		writeValidationError(w, r, errs)
 		return
 	}
 
@@ -35,88 +32,134 @@ func createEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Menyimpan event ke database
 	result, err := db.Exec("INSERT INTO events (event_name, event_time, event_detail) VALUES (?, ?, ?)", event.Name, event.Time, event.Detail)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
 
 	// Ambil ID event yang baru dibuat
 	lastInsertID, err := result.LastInsertId()
 	if err != nil {
-		http.Error(w, "Failed to retrieve last inserted ID", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
 
 	// Update ID event dengan ID yang dihasilkan
 	event.ID = int(lastInsertID)
+	logWebhookError(webhookEventCreated, publishWebhookEvent(db, webhookEventCreated, event))
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(event)
+	writeJSON(w, http.StatusCreated, event)
 }
 
-// GetEventsHandler untuk mengambil semua event
+var eventListSpec = listSpec{
+	Table:       "events",
+	Sortable:    map[string]string{"id": "id", "name": "event_name", "time": "event_time"},
+	DefaultSort: "id",
+	// Filter: ?q= (pencarian nama event)
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		if q := r.URL.Query().Get("q"); q != "" {
+			p.Filter("event_name LIKE ?", "%"+q+"%")
+		}
+	},
+}
+
+// GetEventsHandler untuk mengambil daftar event
 func getEventsHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePageRequest(r, eventListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
 	db := setupDatabase()
 	defer db.Close()
 
-	rows, err := db.Query("SELECT id, event_name, event_time, event_detail FROM events")
+	result, err := page.Query(db, "id, event_name, event_time, event_detail", func() (interface{}, []interface{}) {
+		event := &Event{}
+		return event, []interface{}{&event.ID, &event.Name, &event.Time, &event.Detail}
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	var events []Event
-	for rows.Next() {
-		var event Event
-		if err := rows.Scan(&event.ID, &event.Name, &event.Time, &event.Detail); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		events = append(events, event)
+	writePage(w, r, result)
+}
+
+// GetEventHandler untuk mengambil satu event berdasarkan ID
+func getEventHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	event, err := getEventByID(db, pathID(r, "id"))
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Event not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(events)
+	writeJSON(w, http.StatusOK, event)
+}
+
+func getEventByID(db *sql.DB, eventID string) (Event, error) {
+	var event Event
+	err := db.QueryRow("SELECT id, event_name, event_time, event_detail FROM events WHERE id = ?", eventID).Scan(&event.ID, &event.Name, &event.Time, &event.Detail)
+	return event, err
 }
 
 // DeleteEventHandler untuk menghapus event berdasarkan ID
 func deleteEventHandler(w http.ResponseWriter, r *http.Request) {
-	eventID := r.URL.Query().Get("id")
+	eventID := pathID(r, "id")
 	if eventID == "" {
-		http.Error(w, "Event ID is required", http.StatusBadRequest)
+		writeValidationError(w, r, map[string]string{"id": "is required"})
 		return
 	}
 
 	db := setupDatabase()
 	defer db.Close()
 
+	event, err := getEventByID(db, eventID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Event not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
 	// Hapus event dari database berdasarkan ID
-	_, err := db.Exec("DELETE FROM events WHERE id = ?", eventID)
+	result, err := db.Exec("DELETE FROM events WHERE id = ?", eventID)
 	if err != nil {
-		http.Error(w, "Failed to delete event", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Event not found")
 		return
 	}
+	logNotifyError(r, notifyAllUsers(db, notifyEventCancelled, map[string]string{"event_name": event.Name, "event_time": event.Time}))
+	logWebhookError(webhookEventDeleted, publishWebhookEvent(db, webhookEventDeleted, event))
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Event deleted successfuly"))
+	writeMessage(w, http.StatusOK, "Event deleted successfully")
 }
 
 // UpdateEventHandler untuk memperbarui event berdasarkan ID
 func updateEventHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	eventID := r.URL.Query().Get("id")
+	eventID := pathID(r, "id")
 	if eventID == "" {
-		http.Error(w, "Event ID is required", http.StatusBadRequest)
+		writeValidationError(w, r, map[string]string{"id": "is required"})
 		return
 	}
 
 	var event Event
-	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if !decodeJSON(w, r, &event) {
+		return
+	}
+	if errs := validateStruct(event); len(errs) > 0 {
+		writeValidationError(w, r, errs)
 		return
 	}
 
@@ -126,10 +169,77 @@ func updateEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Update event di database berdasarkan ID
 	_, err := db.Exec("UPDATE events SET event_name = ?, event_time = ?, event_detail = ? WHERE id = ?", event.Name, event.Time, event.Detail, eventID)
 	if err != nil {
-		http.Error(w, "Failed to update event", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
+		return
+	}
+
+	updated, err := getEventByID(db, eventID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Event not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	logNotifyError(r, notifyAllUsers(db, notifyEventChanged, map[string]string{"event_name": updated.Name, "event_time": updated.Time}))
+	logWebhookError(webhookEventUpdated, publishWebhookEvent(db, webhookEventUpdated, updated))
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// EventPatch berisi field event yang boleh diubah sebagian (PATCH)
+type EventPatch struct {
+	Name   *string `json:"name"`
+	Time   *string `json:"time"`
+	Detail *string `json:"detail"`
+}
+
+// PatchEventHandler untuk memperbarui sebagian field event
+func patchEventHandler(w http.ResponseWriter, r *http.Request) {
+	eventID := pathID(r, "id")
+
+	var patch EventPatch
+	if !decodeJSON(w, r, &patch) {
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	event, err := getEventByID(db, eventID)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Event not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	// Terapkan hanya field yang dikirim, lalu validasi hasil akhirnya
+	if patch.Name != nil {
+		event.Name = *patch.Name
+	}
+	if patch.Time != nil {
+		event.Time = *patch.Time
+	}
+	if patch.Detail != nil {
+		event.Detail = *patch.Detail
+	}
+	if errs := validateStruct(event); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	_, err = db.Exec("UPDATE events SET event_name = ?, event_time = ?, event_detail = ? WHERE id = ?", event.Name, event.Time, event.Detail, eventID)
+	if err != nil {
+		writeInternalError(w, r, err)
 		return
 	}
+	logNotifyError(r, notifyAllUsers(db, notifyEventChanged, map[string]string{"event_name": event.Name, "event_time": event.Time}))
+	logWebhookError(webhookEventUpdated, publishWebhookEvent(db, webhookEventUpdated, event))
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(event)
+	writeJSON(w, http.StatusOK, event)
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// exportSpec mendefinisikan kolom yang diexport untuk satu resource.
+// Filter dan sort mengikuti listSpec endpoint list yang sama.
+type exportSpec struct {
+	Name    string
+	List    listSpec
+	Header  []string
+	Columns []string
+}
+
+var exportSpecs = map[string]exportSpec{
+	"logactivity": {
+		Name:    "logactivity",
+		List:    logActivityListSpec,
+		Header:  []string{"ID", "Nama Lengkap", "Divisi", "Kursi", "Status", "Tanggal Pakai", "Check-in", "Dibatalkan", "Dibuat"},
+		Columns: []string{"id", "namalengkap", "nama_divisi", "selected_seat", "status", "booked_for", "checked_in_at", "cancelled_at", "created_at"},
+	},
+	"users": {
+		Name:    "users",
+		List:    userListSpec,
+		Header:  []string{"ID", "Username", "Nama Lengkap", "Role", "Divisi"},
+		Columns: []string{"id", "username", "fullname", "role", "division"},
+	},
+	"events": {
+		Name:    "events",
+		List:    eventListSpec,
+		Header:  []string{"ID", "Nama Event", "Waktu", "Detail"},
+		Columns: []string{"id", "event_name", "event_time", "event_detail"},
+	},
+	"contacts": {
+		Name:    "contacts",
+		List:    contactListSpec,
+		Header:  []string{"ID", "Nama Depan", "Nama Belakang", "Email", "Telepon", "Pesan", "Skor Spam", "Ditandai Spam", "Dikirim"},
+		Columns: []string{"id", "first_name", "last_name", "email", "phone", "message", "spam_score", "flagged", "created_at"},
+	},
+}
+
+// tabularWriter menulis baris data ke format file tertentu secara streaming
+type tabularWriter interface {
+	WriteRow(values []string) error
+	Close() error
+}
+
+// Membuat handler export untuk resource tertentu, format dipilih lewat ?format=csv|xlsx
+func exportHandler(resource string) http.HandlerFunc {
+	spec := exportSpecs[resource]
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+
+		page, errs := parsePageRequest(r, spec.List)
+		if format != "csv" && format != "xlsx" {
+			errs["format"] = "must be one of: csv, xlsx"
+		}
+		if len(errs) > 0 {
+			writeValidationError(w, r, errs)
+			return
+		}
+
+		db := setupDatabase()
+		defer db.Close()
+
+		// Header HTTP baru dikirim saat baris pertama siap, jadi query yang
+		// gagal di awal masih bisa dijawab dengan error JSON biasa
+		var out tabularWriter
+		begin := func() error {
+			filename := fmt.Sprintf("%s-%s.%s", spec.Name, time.Now().Format("20060102-150405"), format)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+			if format == "xlsx" {
+				w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+				out = newXLSXWriter(w, spec.Name)
+			} else {
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				out = newCSVWriter(w)
+			}
+			return out.WriteRow(spec.Header)
+		}
+
+		flusher, _ := w.(http.Flusher)
+		rowCount := 0
+		err := page.Stream(db, spec.Columns, func(values []string) error {
+			if out == nil {
+				if err := begin(); err != nil {
+					return err
+				}
+			}
+			rowCount++
+			if flusher != nil && rowCount%500 == 0 {
+				flusher.Flush()
+			}
+			return out.WriteRow(values)
+		})
+		if err != nil && out == nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		// Hasil kosong tetap berupa file dengan baris judul saja
+		if err == nil && out == nil {
+			err = begin()
+		}
+		if err == nil {
+			err = out.Close()
+		}
+		// Error di tengah stream: koneksi diputus supaya client tidak
+		// menyimpan file terpotong yang terlihat lengkap
+		if err != nil {
+			slog.ErrorContext(r.Context(), "export failed", "resource", spec.Name, "rows", rowCount, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	// BOM supaya Excel membaca file sebagai UTF-8
+	io.WriteString(w, "\ufeff")
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) WriteRow(values []string) error {
+	safe := make([]string, len(values))
+	for i, v := range values {
+		safe[i] = escapeFormula(v)
+	}
+	return c.w.Write(safe)
+}
+
+// Data dari form publik (misalnya pesan kontak) bisa berisi formula seperti
+// "=HYPERLINK(...)", beri awalan ' agar tidak dieksekusi saat dibuka di Excel.
+// Tab dan carriage return di awal sel juga diperlakukan sebagai formula (OWASP).
+func escapeFormula(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xlsxWriter menulis file XLSX minimal (satu sheet, inline string) langsung
+// ke zip stream tanpa menyimpan seluruh isi sheet di memori
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+	err   error
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+func newXLSXWriter(w io.Writer, sheetName string) *xlsxWriter {
+	x := &xlsxWriter{zip: zip.NewWriter(w)}
+	x.writeFile("[Content_Types].xml", xlsxContentTypes)
+	x.writeFile("_rels/.rels", xlsxRootRels)
+	x.writeFile("xl/_rels/workbook.xml.rels", xlsxWorkbookRels)
+	x.writeFile("xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName)))
+	if x.err == nil {
+		x.sheet, x.err = x.zip.Create("xl/worksheets/sheet1.xml")
+	}
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+
+			`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	}
+	return x
+}
+
+func (x *xlsxWriter) writeFile(name, content string) {
+	if x.err != nil {
+		return
+	}
+	f, err := x.zip.Create(name)
+	if err != nil {
+		x.err = err
+		return
+	}
+	_, x.err = io.WriteString(f, content)
+}
+
+func (x *xlsxWriter) WriteRow(values []string) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.row++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for i, v := range values {
+		fmt.Fprintf(&b, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xlsxColumn(i), x.row, xmlEscape(v))
+	}
+	b.WriteString(`</row>`)
+	_, x.err = io.WriteString(x.sheet, b.String())
+	return x.err
+}
+
+func (x *xlsxWriter) Close() error {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, `</sheetData></worksheet>`)
+	}
+	if err := x.zip.Close(); x.err == nil {
+		x.err = err
+	}
+	return x.err
+}
+
+// Nama kolom Excel dari index 0-based: 0 -> A, 25 -> Z, 26 -> AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var exportTestColumns = []string{"id", "event_name", "event_time", "event_detail"}
+
+func runExport(t *testing.T) (rec *httptest.ResponseRecorder, aborted bool) {
+	t.Helper()
+	rec = httptest.NewRecorder()
+	defer func() {
+		if p := recover(); p != nil {
+			if p != http.ErrAbortHandler {
+				panic(p)
+			}
+			aborted = true
+		}
+	}()
+	exportHandler("events")(rec, httptest.NewRequest("GET", "/events/export?format=csv", nil))
+	return rec, false
+}
+
+func TestExportQueryErrorBeforeFirstRow(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT id, event_name").WillReturnError(errors.New("Error 1054: Unknown column"))
+
+	rec, aborted := runExport(t)
+	if aborted || rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, aborted = %v", rec.Code, aborted)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") || rec.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("error response sent as a download: %q", ct)
+	}
+}
+
+func TestExportAbortsMidStream(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT id, event_name").WillReturnRows(sqlmock.NewRows(exportTestColumns).
+		AddRow(1, "Rapat", "2026-10-19 09:00:00", "Ruang A").
+		AddRow(2, "Pelatihan", "2026-10-20 09:00:00", "Ruang B").
+		RowError(1, errors.New("connection reset")))
+
+	rec, aborted := runExport(t)
+	if !aborted {
+		t.Fatalf("export finished normally after a stream error: %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestExportEmptyResult(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT id, event_name").WillReturnRows(sqlmock.NewRows(exportTestColumns))
+
+	rec, aborted := runExport(t)
+	if aborted || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, aborted = %v", rec.Code, aborted)
+	}
+	if body := strings.TrimPrefix(rec.Body.String(), "\ufeff"); body != "ID,Nama Event,Waktu,Detail\n" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	for in, want := range map[string]string{
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-1":                "'-1",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\t=1+1":            "'\t=1+1",
+		"\r=1+1":            "'\r=1+1",
+		"Budi":              "Budi",
+		"":                  "",
+	} {
+		if got := escapeFormula(in); got != want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Probe untuk load balancer / orchestrator:
+//
+//	/healthz  proses hidup, tidak menyentuh database
+//	/readyz   database terjangkau, migrasi terbaru sudah jalan, scheduler aktif
+//
+// Saat menerima SIGTERM, /readyz langsung gagal supaya traffic dialihkan
+// sebelum server benar-benar berhenti.
+
+const (
+	healthOK      = "ok"
+	healthFail    = "fail"
+	healthSkipped = "skipped"
+)
+
+var (
+	shuttingDown atomic.Bool
+	startedAt    = time.Now()
+)
+
+// HealthCheck adalah hasil satu pemeriksaan di /readyz
+type HealthCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status        string        `json:"status"`
+	UptimeSeconds int64         `json:"uptime_seconds"`
+	Checks        []HealthCheck `json:"checks,omitempty"`
+}
+
+// Handler untuk GET /healthz
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{
+		Status:        healthOK,
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+	})
+}
+
+// Handler untuk GET /readyz. Mengembalikan 503 jika ada pemeriksaan yang gagal.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), getEnvDuration("READY_CHECK_TIMEOUT", 2*time.Second))
+	defer cancel()
+
+	db := setupDatabase()
+	defer db.Close()
+
+	checks := []HealthCheck{
+		runHealthCheck(r, "shutdown", func() (string, error) {
+			if shuttingDown.Load() {
+				return healthFail, fmt.Errorf("server is shutting down")
+			}
+			return healthOK, nil
+		}),
+		runHealthCheck(r, "database", func() (string, error) {
+			if err := db.PingContext(ctx); err != nil {
+				return healthFail, err
+			}
+			return healthOK, nil
+		}),
+		runHealthCheck(r, "migrations", func() (string, error) {
+			var current int
+			err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+			if err != nil {
+				return healthFail, err
+			}
+			if latest := latestMigrationVersion(); current < latest {
+				return healthFail, fmt.Errorf("schema is at version %d, expected %d", current, latest)
+			}
+			return healthOK, nil
+		}),
+		runHealthCheck(r, "scheduler", func() (string, error) {
+			// Instance dengan SCHEDULER_ENABLED=false tetap boleh menerima traffic
+			if !schedulerEnabled {
+				return healthSkipped, nil
+			}
+			if jobScheduler == nil || !jobScheduler.Running() {
+				return healthFail, fmt.Errorf("scheduler is not running")
+			}
+			return healthOK, nil
+		}),
+	}
+
+	resp := HealthResponse{
+		Status:        healthOK,
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		Checks:        checks,
+	}
+	status := http.StatusOK
+	for _, c := range checks {
+		if c.Status == healthFail {
+			resp.Status = healthFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	// Probe tidak boleh di-cache oleh proxy
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, resp)
+}
+
+// Detail error hanya masuk log. Response /readyz bisa dibaca siapa saja,
+// jadi pesan dari driver (alamat host, user database) tidak ikut dikirim.
+func runHealthCheck(r *http.Request, name string, check func() (string, error)) HealthCheck {
+	start := time.Now()
+	status, err := check()
+	result := HealthCheck{
+		Name:       name,
+		Status:     status,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "readiness check failed", "check", name, "error", err)
+		result.Error = "unavailable"
+	}
+	return result
+}
+
+func latestMigrationVersion() int {
+	latest := 0
+	for _, m := range migrations {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyzHidesErrorDetails(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\), 0\\) FROM schema_migrations").
+		WillReturnError(errors.New("Error 1045: Access denied for user 'sibakar'@'10.0.3.7'"))
+
+	rec := httptest.NewRecorder()
+	readyzHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "sibakar") || strings.Contains(rec.Body.String(), "10.0.3.7") {
+		t.Fatalf("driver error leaked: %s", rec.Body)
+	}
+	var resp HealthResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	for _, c := range resp.Checks {
+		if c.Name == "migrations" && (c.Status != healthFail || c.Error != "unavailable") {
+			t.Fatalf("migrations check = %+v", c)
+		}
+	}
+}
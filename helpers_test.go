@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Mengarahkan setupDatabase ke sqlmock selama test berjalan. Handler tetap
+// membuka dan menutup pool sendiri, semuanya memakai mock yang sama.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	dsn := "mock_" + strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, mock, err := sqlmock.NewWithDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDriver, prevDSN := dbDriver, dbDSN
+	dbDriver, dbDSN = "sqlmock", dsn
+	t.Cleanup(func() {
+		dbDriver, dbDSN = prevDriver, prevDSN
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return mock
+}
+
+// Baris audit_log untuk event tertentu, argumen lain bebas
+func expectAudit(mock sqlmock.Sqlmock, event string) {
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(event, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// captureArg menyimpan nilai argumen query supaya bisa diperiksa test
+type captureArg struct {
+	value string
+}
+
+func (c *captureArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	c.value = s
+	return ok
+}
+
+// stubIssuer membuat token palsu yang bisa dibaca test
+type stubIssuer struct{}
+
+func (stubIssuer) Issue(ctx context.Context, user User, sessionID string, mfa bool) (string, error) {
+	return fmt.Sprintf("token:%s:mfa=%t", user.Username, mfa), nil
+}
+
+func useStubIssuer(t *testing.T) {
+	prev := tokenIssuer
+	tokenIssuer = stubIssuer{}
+	t.Cleanup(func() { tokenIssuer = prev })
+}
+
+// Kolom hasil getUserByUsername
+var userColumns = []string{"id", "username", "fullname", "password", "role", "status", "account_type", "totp_enabled"}
+
+// Hash bcrypt dengan cost minimum supaya test tidak lambat
+func useFastHashing(t *testing.T) {
+	prev := passwordConfig
+	passwordConfig.Algorithm, passwordConfig.BcryptCost = hashBcrypt, bcrypt.MinCost
+	passwordConfig.Argon2Memory, passwordConfig.Argon2Time, passwordConfig.Argon2Threads = 64, 1, 1
+	t.Cleanup(func() { passwordConfig = prev })
+}
+
+// Limiter login baru yang kosong, dengan jeda gagal login yang singkat
+func useFreshLimiter(t *testing.T) {
+	prevStore, prevGuard := authLimiter, authGuard
+	authLimiter = newMemoryLimiterStore()
+	authGuard.DelayBase, authGuard.DelayMax = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { authLimiter, authGuard = prevStore, prevGuard })
+}
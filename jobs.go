@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scheduler global, dibuat di main sebelum server menerima request
+var jobScheduler *Scheduler
+
+var (
+	schedulerEnabled = getEnv("SCHEDULER_ENABLED", "true") == "true"
+	// Booking yang belum check-in sampai jam ini dilepas (no-show)
+	noShowDeadline = getEnv("NO_SHOW_DEADLINE", "10:00")
+	// Booking yang dibuat mendekati deadline tetap diberi waktu sebanyak ini
+	noShowGrace = getEnvDuration("NO_SHOW_GRACE", time.Hour)
+)
+
+// Jadwal job bisa diganti lewat env, contoh JOB_SCHEDULE_SEAT_RESET="0 21 * * *".
+// Nilai "off" mematikan jadwal, job tetap bisa dijalankan manual.
+func jobSchedule(name, fallback string) string {
+	schedule := getEnv("JOB_SCHEDULE_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_")), fallback)
+	if schedule == "off" {
+		return ""
+	}
+	return schedule
+}
+
+func defaultJobs() []Job {
+	return []Job{
+		{
+			Name:        "seat-reset",
+			Description: "Reset semua kursi menjadi available setelah jam operasional",
+			Schedule:    jobSchedule("seat-reset", "0 20 * * *"),
+			CatchUp:     true,
+			Run: func(ctx context.Context, db *sql.DB) error {
+				return resetSeatToAvailable(db)
+			},
+		},
+		{
+			Name:        "no-show-release",
+			Description: "Melepas kursi yang tidak di-check-in sampai batas waktu",
+			Schedule:    jobSchedule("no-show-release", "*/15 7-20 * * *"),
+			Run:         releaseNoShows,
+		},
+		{
+			Name:        "reminders",
+			Description: "Pengingat check-in untuk booking hari ini",
+			Schedule:    jobSchedule("reminders", "0 8 * * 1-5"),
+			Run:         sendCheckInReminders,
+		},
+		{
+			Name:        "notifications",
+			Description: "Mengirim notifikasi dari outbox dan mencoba lagi yang gagal",
+			Schedule:    jobSchedule("notifications", "* * * * *"),
+			Run:         deliverNotifications,
+		},
+		{
+			Name:        "webhooks",
+			Description: "Mengirim webhook keluar dan mencoba lagi yang gagal",
+			Schedule:    jobSchedule("webhooks", "* * * * *"),
+			Run:         deliverWebhooks,
+		},
+		{
+			Name:        "analytics-rollup",
+			Description: "Membuat rollup analitik untuk hari kemarin",
+			Schedule:    jobSchedule("analytics-rollup", "15 0 * * *"),
+			CatchUp:     true,
+			Run: func(ctx context.Context, db *sql.DB) error {
+				return rollupDay(db, time.Now().AddDate(0, 0, -1))
+			},
+		},
+		{
+			Name:        "retention",
+			Description: "Memindahkan booking lama ke arsip sesuai RETENTION_MONTHS",
+			Schedule:    jobSchedule("retention", "0 2 * * *"),
+			CatchUp:     true,
+			Run: func(ctx context.Context, db *sql.DB) error {
+				run, err := archiveLogActivity(db, retentionCutoff())
+				if err == nil && run.RowCount > 0 {
+					slog.InfoContext(ctx, "archived logactivity", "rows", run.RowCount, "to", run.ToDate)
+				}
+				return err
+			},
+		},
+		{
+			Name:        "limiter-prune",
+			Description: "Menghapus bucket rate limit, hitungan login gagal, challenge 2FA, state SSO dan sesi yang sudah kedaluwarsa",
+			Schedule:    jobSchedule("limiter-prune", "30 * * * *"),
+			Run: func(ctx context.Context, db *sql.DB) error {
+				if err := pruneLoginChallenges(ctx, db); err != nil {
+					return err
+				}
+				if err := pruneOIDCLogins(ctx, db); err != nil {
+					return err
+				}
+				if err := pruneSessions(ctx, db); err != nil {
+					return err
+				}
+				return authLimiter.Prune(ctx, 24*time.Hour)
+			},
+		},
+		{
+			Name:        "jwt-keys",
+			Description: "Membuat kunci JWT berikutnya sebelum kunci aktif pensiun dan menghapus kunci kedaluwarsa",
+			Schedule:    jobSchedule("jwt-keys", "45 * * * *"),
+			Run: func(ctx context.Context, db *sql.DB) error {
+				return signingKeys.ensure(ctx)
+			},
+		},
+	}
+}
+
+// Melepas kursi hari ini yang belum check-in setelah deadline. Booking tetap
+// tercatat sebagai no-show di analitik karena cancelled_at tidak diisi.
+func releaseNoShows(ctx context.Context, db *sql.DB) error {
+	deadline, err := time.Parse("15:04", noShowDeadline)
+	if err != nil {
+		return fmt.Errorf("invalid NO_SHOW_DEADLINE %q", noShowDeadline)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM logactivity
+		WHERE booked_for = CURDATE() AND status = 'occupied'
+			AND checked_in_at IS NULL AND cancelled_at IS NULL
+			AND GREATEST(TIMESTAMP(booked_for, ?), created_at + INTERVAL ? SECOND) < NOW()
+		FOR UPDATE`, deadline.Format("15:04:05"), int(noShowGrace.Seconds()))
+	if err != nil {
+		return err
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	if _, err := tx.ExecContext(ctx, "UPDATE logactivity SET status = 'available' WHERE id IN ("+placeholders+")", ids...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE bookings SET status = 'available' WHERE id IN ("+placeholders+")", ids...); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "released no-show bookings", "count", len(ids))
+	return nil
+}
+
+// Mengingatkan pemesan yang belum check-in untuk booking hari ini
+func sendCheckInReminders(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, namalengkap, selected_seat, CAST(booked_for AS CHAR) FROM logactivity
+		WHERE booked_for = CURDATE() AND status = 'occupied'
+			AND checked_in_at IS NULL AND cancelled_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	type reminder struct {
+		id                    int64
+		owner                 sql.NullInt64
+		name, seat, bookedFor string
+	}
+	var reminders []reminder
+	for rows.Next() {
+		var rm reminder
+		if err := rows.Scan(&rm.id, &rm.owner, &rm.name, &rm.seat, &rm.bookedFor); err != nil {
+			rows.Close()
+			return err
+		}
+		reminders = append(reminders, rm)
+	}
+	rows.Close()
+
+	for _, rm := range reminders {
+		err := notifyBookingOwner(db, rm.owner, rm.name, notifyBookingReminder, map[string]string{
+			"seat":       rm.seat,
+			"date":       rm.bookedFor,
+			"booking_id": strconv.FormatInt(rm.id, 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	slog.InfoContext(ctx, "queued check-in reminders", "count", len(reminders))
+	return nil
+}
+
+var jobRunListSpec = listSpec{
+	Table:       "job_runs",
+	Sortable:    map[string]string{"id": "id", "started_at": "started_at", "duration_ms": "duration_ms"},
+	DefaultSort: "id",
+	// Filter: ?status=&trigger=
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		p.Filter("job_name = ?", r.PathValue("name"))
+		p.FilterParam(r, "status", "status")
+		p.FilterParam(r, "trigger", "trigger_type")
+	},
+}
+
+// Handler untuk GET /admin/jobs, daftar job dengan jadwal dan run terakhir
+func getJobsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	jobs := jobScheduler.Jobs()
+	for i := range jobs {
+		run, err := scanJobRun(db.QueryRow(jobRunSelect+" WHERE job_name = ? ORDER BY id DESC LIMIT 1", jobs[i].Name))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		jobs[i].LastRun = &run
+	}
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// Handler untuk GET /admin/jobs/{name}/runs, riwayat run terbaru lebih dulu
+func getJobRunsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := jobScheduler.byName[r.PathValue("name")]; !ok {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Job not found")
+		return
+	}
+	page, errs := parsePageRequest(r, jobRunListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if r.URL.Query().Get("sort") == "" {
+		page.Desc = true
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	runs, err := page.Query(db, jobRunColumns, func() (interface{}, []interface{}) {
+		run := &JobRun{}
+		return run, jobRunDest(run)
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writePage(w, r, runs)
+}
+
+// Handler untuk POST /admin/jobs/{name}/run, menjalankan job sekarang
+func runJobHandler(w http.ResponseWriter, r *http.Request) {
+	run, err := jobScheduler.Trigger(r.PathValue("name"))
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusAccepted, run)
+	case errJobNotFound:
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Job not found")
+	case errJobLocked:
+		writeError(w, r, http.StatusConflict, codeConflict, "Job is already running")
+	default:
+		writeInternalError(w, r, err)
+	}
+}
+
+const jobRunColumns = `id, job_name, trigger_type, COALESCE(CAST(scheduled_for AS CHAR), ''), CAST(started_at AS CHAR),
+	COALESCE(CAST(finished_at AS CHAR), ''), status, duration_ms, COALESCE(error, ''), instance`
+
+const jobRunSelect = "SELECT " + jobRunColumns + " FROM job_runs"
+
+func jobRunDest(run *JobRun) []interface{} {
+	return []interface{}{&run.ID, &run.Job, &run.Trigger, &run.ScheduledFor, &run.StartedAt,
+		&run.FinishedAt, &run.Status, &run.DurationMs, &run.Error, &run.Instance}
+}
+
+func scanJobRun(row *sql.Row) (JobRun, error) {
+	var run JobRun
+	err := row.Scan(jobRunDest(&run)...)
+	return run, err
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kunci penandatangan JWT disimpan di tabel jwt_keys supaya semua instance
+// memakai kunci yang sama. Setiap kunci punya tiga waktu:
+//
+//	not_before  mulai dipakai untuk menandatangani token
+//	retires_at  berhenti dipakai untuk menandatangani (not_before + JWT_KEY_ROTATION)
+//	expires_at  berhenti diterima (retires_at + JWT_TTL), lalu dihapus
+//
+// Kunci baru dibuat JWT_KEY_PREPUBLISH sebelum kunci aktif pensiun dan
+// langsung muncul di /.well-known/jwks.json, jadi service lain sudah
+// mengenalnya sebelum token pertama ditandatangani dengan kunci itu.
+type KeyConfig struct {
+	Algorithm  string // RS256 atau EdDSA
+	Rotation   time.Duration
+	Prepublish time.Duration
+	Reload     time.Duration // interval membaca ulang jwt_keys dari database
+}
+
+func loadKeyConfig() KeyConfig {
+	return KeyConfig{
+		Algorithm:  getEnv("JWT_ALGORITHM", algRS256),
+		Rotation:   getEnvDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		Prepublish: getEnvDuration("JWT_KEY_PREPUBLISH", 24*time.Hour),
+		Reload:     getEnvDuration("JWT_KEY_RELOAD", time.Minute),
+	}
+}
+
+const (
+	algRS256 = "RS256"
+	algEdDSA = "EdDSA"
+)
+
+var (
+	keyConfig = loadKeyConfig()
+	// Dibuat di main setelah migrasi
+	signingKeys *keyring
+)
+
+type signingKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	NotBefore time.Time
+	RetiresAt time.Time
+	ExpiresAt time.Time
+}
+
+func (k signingKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+func (k signingKey) signing(now time.Time) bool {
+	return !now.Before(k.NotBefore) && now.Before(k.RetiresAt)
+}
+
+func generatePrivateKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case algRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case algEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q, use %s or %s", alg, algRS256, algEdDSA)
+}
+
+// keyring adalah cache jwt_keys di memori
+type keyring struct {
+	db       *sql.DB
+	mu       sync.RWMutex
+	keys     map[string]signingKey
+	loadedAt time.Time
+}
+
+func newKeyring(db *sql.DB) *keyring {
+	return &keyring{db: db, keys: map[string]signingKey{}}
+}
+
+func (k *keyring) reload(ctx context.Context) error {
+	rows, err := k.db.QueryContext(ctx,
+		"SELECT kid, algorithm, private_key, not_before, retires_at, expires_at FROM jwt_keys WHERE expires_at > ?",
+		time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := map[string]signingKey{}
+	for rows.Next() {
+		var key signingKey
+		var privatePEM string
+		var notBefore, retires, expires int64
+		if err := rows.Scan(&key.ID, &key.Algorithm, &privatePEM, &notBefore, &retires, &expires); err != nil {
+			return err
+		}
+		block, _ := pem.Decode([]byte(privatePEM))
+		if block == nil {
+			return fmt.Errorf("jwt key %s: invalid PEM", key.ID)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("jwt key %s: %v", key.ID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("jwt key %s: unsupported key type", key.ID)
+		}
+		key.Private = signer
+		key.NotBefore, key.RetiresAt, key.ExpiresAt = time.UnixMilli(notBefore), time.UnixMilli(retires), time.UnixMilli(expires)
+		keys[key.ID] = key
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys, k.loadedAt = keys, time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Membaca ulang dari database jika cache sudah lebih tua dari maxAge
+func (k *keyring) refresh(ctx context.Context, maxAge time.Duration) {
+	k.mu.RLock()
+	stale := time.Since(k.loadedAt) > maxAge
+	k.mu.RUnlock()
+	if !stale {
+		return
+	}
+	if err := k.reload(ctx); err != nil {
+		slog.ErrorContext(ctx, "failed to reload jwt keys", "error", err)
+	}
+}
+
+// Kunci untuk memverifikasi token dengan kid tertentu. kid yang belum
+// dikenal memicu baca ulang (paling sering tiap 10 detik) untuk kunci yang
+// baru dibuat instance lain.
+func (k *keyring) lookup(ctx context.Context, kid string) (signingKey, bool) {
+	k.refresh(ctx, keyConfig.Reload)
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	k.mu.RUnlock()
+	if !ok {
+		k.refresh(ctx, 10*time.Second)
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+	if !ok || !time.Now().Before(key.ExpiresAt) {
+		return signingKey{}, false
+	}
+	return key, true
+}
+
+// Kunci aktif terbaru untuk menandatangani token
+func (k *keyring) current(ctx context.Context) (signingKey, error) {
+	k.refresh(ctx, keyConfig.Reload)
+	if key, ok := k.pickSigning(time.Now()); ok {
+		return key, nil
+	}
+	// Tidak ada kunci aktif, misalnya job rotasi dimatikan
+	if err := k.ensure(ctx); err != nil {
+		return signingKey{}, err
+	}
+	if key, ok := k.pickSigning(time.Now()); ok {
+		return key, nil
+	}
+	return signingKey{}, fmt.Errorf("no active jwt signing key")
+}
+
+func (k *keyring) pickSigning(now time.Time) (signingKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	var best signingKey
+	found := false
+	for _, key := range k.keys {
+		if key.signing(now) && (!found || key.NotBefore.After(best.NotBefore)) {
+			best, found = key, true
+		}
+	}
+	return best, found
+}
+
+func (k *keyring) list() []signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]signingKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].NotBefore.After(keys[j].NotBefore) })
+	return keys
+}
+
+// Menjalankan fn dengan lock MySQL supaya dua instance tidak merotasi
+// kunci bersamaan
+func (k *keyring) withLock(ctx context.Context, fn func() error) error {
+	conn, err := k.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK('sibakar.jwt-keys', 10)").Scan(&acquired); err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return fmt.Errorf("timed out waiting for jwt key lock")
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK('sibakar.jwt-keys')")
+	return fn()
+}
+
+// Memastikan ada kunci aktif dan kunci berikutnya sudah dipublikasikan
+// sebelum kunci aktif pensiun. Dipanggil saat start dan oleh job jwt-keys.
+func (k *keyring) ensure(ctx context.Context) error {
+	return k.withLock(ctx, func() error {
+		if err := k.reload(ctx); err != nil {
+			return err
+		}
+		now := time.Now()
+		keys := k.list()
+
+		switch {
+		case len(keys) == 0 || !now.Before(keys[0].RetiresAt):
+			if _, err := k.create(ctx, now); err != nil {
+				return err
+			}
+		case !now.Before(keys[0].RetiresAt.Add(-keyConfig.Prepublish)):
+			if _, err := k.create(ctx, keys[0].RetiresAt); err != nil {
+				return err
+			}
+		}
+
+		if _, err := k.db.ExecContext(ctx, "DELETE FROM jwt_keys WHERE expires_at <= ?", now.UnixMilli()); err != nil {
+			return err
+		}
+		return k.reload(ctx)
+	})
+}
+
+// Membuat kunci baru yang mulai menandatangani pada notBefore
+func (k *keyring) create(ctx context.Context, notBefore time.Time) (string, error) {
+	priv, err := generatePrivateKey(keyConfig.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	kid, err := randomToken(12)
+	if err != nil {
+		return "", err
+	}
+	retires := notBefore.Add(keyConfig.Rotation)
+	expires := retires.Add(tokenConfig.TTL)
+	_, err = k.db.ExecContext(ctx,
+		"INSERT INTO jwt_keys (kid, algorithm, private_key, not_before, retires_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		kid, keyConfig.Algorithm, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		notBefore.UnixMilli(), retires.UnixMilli(), expires.UnixMilli())
+	if err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "created jwt signing key", "kid", kid, "algorithm", keyConfig.Algorithm, "not_before", notBefore.Format(time.RFC3339))
+	return kid, nil
+}
+
+// Rotasi paksa: kunci baru langsung aktif, kunci lain berhenti
+// menandatangani tetapi token yang sudah terbit tetap berlaku
+func (k *keyring) rotate(ctx context.Context) (string, error) {
+	var kid string
+	err := k.withLock(ctx, func() error {
+		now := time.Now()
+		_, err := k.db.ExecContext(ctx, `
+			UPDATE jwt_keys SET retires_at = LEAST(retires_at, ?), expires_at = LEAST(expires_at, ?)
+			WHERE expires_at > ?`, now.UnixMilli(), now.Add(tokenConfig.TTL).UnixMilli(), now.UnixMilli())
+		if err != nil {
+			return err
+		}
+		if kid, err = k.create(ctx, now); err != nil {
+			return err
+		}
+		return k.reload(ctx)
+	})
+	return kid, err
+}
+
+// Menghapus kunci yang bocor: semua token yang ditandatanganinya langsung
+// ditolak (instance lain menyusul paling lambat JWT_KEY_RELOAD)
+func (k *keyring) revoke(ctx context.Context, kid string) (bool, error) {
+	result, err := k.db.ExecContext(ctx, "DELETE FROM jwt_keys WHERE kid = ?", kid)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+	return true, k.ensure(ctx)
+}
+
+// JWK (RFC 7517) untuk kunci publik
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func publicJWK(key signingKey) JWK {
+	jwk := JWK{Use: "sig", Alg: key.Algorithm, Kid: key.ID}
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// Handler untuk GET /.well-known/jwks.json, berisi semua kunci yang
+// tokennya masih bisa berlaku termasuk kunci berikutnya
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	signingKeys.refresh(r.Context(), keyConfig.Reload)
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range signingKeys.list() {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(keyConfig.Reload.Seconds())))
+	writeJSON(w, http.StatusOK, set)
+}
+
+// Metadata kunci untuk admin, tanpa private key
+type SigningKeyInfo struct {
+	Kid       string `json:"kid"`
+	Algorithm string `json:"algorithm"`
+	NotBefore string `json:"not_before"`
+	RetiresAt string `json:"retires_at"`
+	ExpiresAt string `json:"expires_at"`
+	Signing   bool   `json:"signing"`
+}
+
+const (
+	auditJWTKeyRotated = "jwt_key.rotated"
+	auditJWTKeyRevoked = "jwt_key.revoked"
+)
+
+// Handler untuk GET /admin/jwt-keys
+func getSigningKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if err := signingKeys.reload(r.Context()); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	now := time.Now()
+	current, _ := signingKeys.pickSigning(now)
+	list := []SigningKeyInfo{}
+	for _, key := range signingKeys.list() {
+		list = append(list, SigningKeyInfo{
+			Kid:       key.ID,
+			Algorithm: key.Algorithm,
+			NotBefore: key.NotBefore.Format(time.RFC3339),
+			RetiresAt: key.RetiresAt.Format(time.RFC3339),
+			ExpiresAt: key.ExpiresAt.Format(time.RFC3339),
+			Signing:   key.ID == current.ID,
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Handler untuk POST /admin/jwt-keys/rotate
+func rotateSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	kid, err := signingKeys.rotate(r.Context())
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+	recordAudit(db, r, auditJWTKeyRotated, "", "kid="+kid)
+
+	writeMessage(w, http.StatusOK, "Signing key rotated, new kid "+kid)
+}
+
+// Handler untuk DELETE /admin/jwt-keys/{kid}
+func revokeSigningKeyHandler(w http.ResponseWriter, r *http.Request) {
+	kid := r.PathValue("kid")
+	found, err := signingKeys.revoke(r.Context(), kid)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !found {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Signing key not found")
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+	recordAudit(db, r, auditJWTKeyRevoked, "", "kid="+kid)
+
+	writeMessage(w, http.StatusOK, "Signing key revoked, tokens signed with it are no longer accepted")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Kunci untuk test dengan waktu dibulatkan ke milidetik seperti di jwt_keys
+func newTestKey(t *testing.T, kid, alg string, notBefore time.Time) signingKey {
+	t.Helper()
+	priv, err := generatePrivateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore = time.UnixMilli(notBefore.UnixMilli())
+	retires := notBefore.Add(keyConfig.Rotation)
+	return signingKey{ID: kid, Algorithm: alg, Private: priv,
+		NotBefore: notBefore, RetiresAt: retires, ExpiresAt: retires.Add(tokenConfig.TTL)}
+}
+
+func useKeyConfig(t *testing.T, alg string) {
+	prev := keyConfig
+	keyConfig.Algorithm, keyConfig.Reload = alg, time.Hour
+	t.Cleanup(func() { keyConfig = prev })
+}
+
+// Baris jwt_keys untuk hasil reload
+func keyRows(t *testing.T, keys ...signingKey) *sqlmock.Rows {
+	t.Helper()
+	rows := sqlmock.NewRows([]string{"kid", "algorithm", "private_key", "not_before", "retires_at", "expires_at"})
+	for _, key := range keys {
+		der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows.AddRow(key.ID, key.Algorithm, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+			key.NotBefore.UnixMilli(), key.RetiresAt.UnixMilli(), key.ExpiresAt.UnixMilli())
+	}
+	return rows
+}
+
+// Cocok dengan waktu Unix milidetik yang dekat dengan at
+type millisNear struct{ at time.Time }
+
+func (m millisNear) Match(v driver.Value) bool {
+	ms, ok := v.(int64)
+	return ok && time.UnixMilli(ms).Sub(m.at).Abs() < 5*time.Second
+}
+
+func expectKeyLock(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT GET_LOCK").WillReturnRows(sqlmock.NewRows([]string{"acquired"}).AddRow(1))
+}
+
+func expectKeyUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("SELECT RELEASE_LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestKeyringEnsurePrepublishesNextKey(t *testing.T) {
+	useKeyConfig(t, algEdDSA)
+	now := time.Now()
+	// Kunci aktif pensiun dalam 12 jam, di dalam jendela prepublish 24 jam
+	active := newTestKey(t, "aktif", algEdDSA, now.Add(12*time.Hour-keyConfig.Rotation))
+	next := newTestKey(t, "berikut", algEdDSA, active.RetiresAt)
+
+	mock := useMockDB(t)
+	expectKeyLock(mock)
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t, active))
+	// Kunci berikutnya baru menandatangani saat kunci aktif pensiun
+	mock.ExpectExec("INSERT INTO jwt_keys").
+		WithArgs(sqlmock.AnyArg(), algEdDSA, sqlmock.AnyArg(),
+			next.NotBefore.UnixMilli(), next.RetiresAt.UnixMilli(), next.ExpiresAt.UnixMilli()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM jwt_keys WHERE expires_at <= ?").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t, active, next))
+	expectKeyUnlock(mock)
+
+	db := setupDatabase()
+	defer db.Close()
+	ring := newKeyring(db)
+	if err := ring.ensure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if key, _ := ring.pickSigning(now); key.ID != active.ID {
+		t.Errorf("signing now with %q, want %q", key.ID, active.ID)
+	}
+	if key, _ := ring.pickSigning(active.RetiresAt); key.ID != next.ID {
+		t.Errorf("signing after retirement with %q, want %q", key.ID, next.ID)
+	}
+	// Sudah ada di JWKS sebelum dipakai menandatangani
+	if keys := ring.list(); len(keys) != 2 || keys[0].ID != next.ID {
+		t.Errorf("published keys = %v", keys)
+	}
+}
+
+func TestKeyringEnsureCreatesFirstKey(t *testing.T) {
+	useKeyConfig(t, algEdDSA)
+	first := newTestKey(t, "pertama", algEdDSA, time.Now())
+
+	mock := useMockDB(t)
+	expectKeyLock(mock)
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t))
+	mock.ExpectExec("INSERT INTO jwt_keys").
+		WithArgs(sqlmock.AnyArg(), algEdDSA, sqlmock.AnyArg(), millisNear{time.Now()}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM jwt_keys WHERE expires_at <= ?").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t, first))
+	expectKeyUnlock(mock)
+
+	db := setupDatabase()
+	defer db.Close()
+	ring := newKeyring(db)
+	if err := ring.ensure(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := ring.current(context.Background()); err != nil || key.ID != first.ID {
+		t.Errorf("current = %q, %v", key.ID, err)
+	}
+}
+
+func TestKeyringRotateRetiresOldKeys(t *testing.T) {
+	useKeyConfig(t, algEdDSA)
+	now := time.Now()
+	old := newTestKey(t, "lama", algEdDSA, now.Add(-time.Hour))
+	fresh := newTestKey(t, "baru", algEdDSA, now)
+	// Kunci lama berhenti menandatangani sekarang, tokennya berlaku sampai JWT_TTL
+	retiredOld := old
+	retiredOld.RetiresAt = time.UnixMilli(now.UnixMilli())
+	retiredOld.ExpiresAt = retiredOld.RetiresAt.Add(tokenConfig.TTL)
+
+	mock := useMockDB(t)
+	expectKeyLock(mock)
+	mock.ExpectExec("UPDATE jwt_keys SET retires_at = LEAST\\(retires_at, \\?\\), expires_at = LEAST\\(expires_at, \\?\\)").
+		WithArgs(millisNear{now}, millisNear{now.Add(tokenConfig.TTL)}, millisNear{now}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO jwt_keys").
+		WithArgs(sqlmock.AnyArg(), algEdDSA, sqlmock.AnyArg(), millisNear{now}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t, retiredOld, fresh))
+	expectKeyUnlock(mock)
+
+	db := setupDatabase()
+	defer db.Close()
+	ring := newKeyring(db)
+	if _, err := ring.rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := ring.pickSigning(time.Now()); key.ID != fresh.ID {
+		t.Errorf("signing with %q, want %q", key.ID, fresh.ID)
+	}
+	if _, ok := ring.lookup(context.Background(), old.ID); !ok {
+		t.Error("retired key no longer verifies issued tokens")
+	}
+}
+
+func TestKeyringRevokeRejectsTokens(t *testing.T) {
+	useKeyConfig(t, algEdDSA)
+	leaked := newTestKey(t, "bocor", algEdDSA, time.Now().Add(-time.Hour))
+	replacement := newTestKey(t, "pengganti", algEdDSA, time.Now())
+
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t, leaked))
+	mock.ExpectExec("DELETE FROM jwt_keys WHERE kid = ?").WithArgs(leaked.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	// Tidak ada kunci tersisa, ensure langsung membuat pengganti
+	expectKeyLock(mock)
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t))
+	mock.ExpectExec("INSERT INTO jwt_keys").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM jwt_keys WHERE expires_at <= ?").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT kid, algorithm, private_key").WillReturnRows(keyRows(t, replacement))
+	expectKeyUnlock(mock)
+	mock.ExpectExec("DELETE FROM jwt_keys WHERE kid = ?").WithArgs("tidak-ada").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := setupDatabase()
+	defer db.Close()
+	ring := newKeyring(db)
+	if err := ring.reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tokens := newJWTTokens(ring, tokenConfig, time.Time{})
+	token, err := tokens.Issue(context.Background(), User{ID: 7, Username: "budi", Role: roleMember}, "sid", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Verify(context.Background(), token); err != nil {
+		t.Fatalf("token rejected before revoke: %v", err)
+	}
+
+	if found, err := ring.revoke(context.Background(), leaked.ID); !found || err != nil {
+		t.Fatalf("revoke = %v, %v", found, err)
+	}
+	if _, err := tokens.Verify(context.Background(), token); err == nil {
+		t.Error("token signed with a revoked key accepted")
+	}
+	if key, err := ring.current(context.Background()); err != nil || key.ID != replacement.ID {
+		t.Errorf("current = %q, %v", key.ID, err)
+	}
+	if found, err := ring.revoke(context.Background(), "tidak-ada"); found || err != nil {
+		t.Errorf("revoke unknown kid = %v, %v", found, err)
+	}
+}
+
+func TestPublicJWK(t *testing.T) {
+	rsaKey := newTestKey(t, "rsa", algRS256, time.Now())
+	jwk := publicJWK(rsaKey)
+	pub := rsaKey.Public().(*rsa.PublicKey)
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	if jwk.Kty != "RSA" || jwk.Alg != algRS256 || jwk.Kid != "rsa" || jwk.Use != "sig" ||
+		jwk.E != "AQAB" || new(big.Int).SetBytes(n).Cmp(pub.N) != 0 || jwk.X != "" || jwk.Crv != "" {
+		t.Errorf("RSA JWK = %+v", jwk)
+	}
+
+	edKey := newTestKey(t, "ed", algEdDSA, time.Now())
+	jwk = publicJWK(edKey)
+	x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+	if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != algEdDSA || jwk.Kid != "ed" || jwk.Use != "sig" ||
+		!edKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) || jwk.N != "" || jwk.E != "" {
+		t.Errorf("Ed25519 JWK = %+v", jwk)
+	}
+	if len(x) != ed25519.PublicKeySize {
+		t.Errorf("x is %d bytes", len(x))
+	}
+}
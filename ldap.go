@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Login lewat bind LDAP/Active Directory, aktif jika AUTH_BACKENDS berisi
+// ldap. Diatur lewat env:
+//
+//	LDAP_URL              contoh ldaps://dc01.kantor.local:636
+//	LDAP_START_TLS        true untuk StartTLS di atas ldap:// (default false)
+//	LDAP_SKIP_VERIFY      true untuk melewati verifikasi sertifikat (hanya untuk uji coba)
+//	LDAP_BIND_DN          akun layanan untuk mencari pengguna, kosong berarti anonymous
+//	LDAP_BIND_PASSWORD
+//	LDAP_BASE_DN          contoh DC=kantor,DC=local
+//	LDAP_USER_FILTER      {username} diganti username yang sudah di-escape
+//	                      (default "(&(objectClass=user)(sAMAccountName={username}))")
+//	LDAP_USERNAME_ATTR    atribut username (default sAMAccountName)
+//	LDAP_FULLNAME_ATTR    atribut nama lengkap (default displayName)
+//	LDAP_GROUP_ATTR       atribut grup (default memberOf), dicocokkan dengan DN lengkap atau CN
+//	LDAP_ADMIN_GROUPS, LDAP_ALLOWED_GROUPS, LDAP_DIVISION_MAP  sama seperti OIDC_*
+//	LDAP_LINK_EXISTING    true untuk mengambil alih akun lokal dengan username yang sama (default false)
+//	LDAP_TIMEOUT          batas waktu koneksi dan query (default 10s)
+type LDAPConfig struct {
+	URL          string
+	StartTLS     bool
+	SkipVerify   bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	UserFilter   string
+	UsernameAttr string
+	FullnameAttr string
+	GroupAttr    string
+	Groups       groupMapping
+	LinkExisting bool
+	Timeout      time.Duration
+}
+
+func loadLDAPConfig() LDAPConfig {
+	return LDAPConfig{
+		URL:          getEnv("LDAP_URL", ""),
+		StartTLS:     getEnv("LDAP_START_TLS", "false") == "true",
+		SkipVerify:   getEnv("LDAP_SKIP_VERIFY", "false") == "true",
+		BindDN:       getEnv("LDAP_BIND_DN", ""),
+		BindPassword: getEnv("LDAP_BIND_PASSWORD", ""),
+		BaseDN:       getEnv("LDAP_BASE_DN", ""),
+		UserFilter:   getEnv("LDAP_USER_FILTER", "(&(objectClass=user)(sAMAccountName={username}))"),
+		UsernameAttr: getEnv("LDAP_USERNAME_ATTR", "sAMAccountName"),
+		FullnameAttr: getEnv("LDAP_FULLNAME_ATTR", "displayName"),
+		GroupAttr:    getEnv("LDAP_GROUP_ATTR", "memberOf"),
+		Groups:       loadGroupMapping("LDAP"),
+		LinkExisting: getEnv("LDAP_LINK_EXISTING", "false") == "true",
+		Timeout:      getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+	}
+}
+
+var ldapConfig = loadLDAPConfig()
+
+const auditLoginLDAP = "login.ldap"
+
+type ldapAuthenticator struct {
+	cfg LDAPConfig
+}
+
+func (a *ldapAuthenticator) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(a.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: a.cfg.SkipVerify}
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Entri pengguna hasil pencarian di direktori
+type ldapEntry struct {
+	DN       string
+	Username string
+	Fullname string
+	Groups   []string
+}
+
+// Mencari DN pengguna dengan akun layanan, lalu bind ulang sebagai
+// pengguna tersebut untuk memeriksa password
+func (a *ldapAuthenticator) lookup(username, password string) (ldapEntry, error) {
+	var entry ldapEntry
+	// Bind dengan password kosong dianggap anonymous bind oleh banyak server
+	if password == "" {
+		return entry, errInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return entry, fmt.Errorf("%w: ldap dial failed: %v", errBackendUnavailable, err)
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		err = conn.Bind(a.cfg.BindDN, a.cfg.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return entry, fmt.Errorf("%w: ldap service bind failed: %v", errBackendUnavailable, err)
+	}
+
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(a.cfg.Timeout.Seconds()), false, filter,
+		[]string{a.cfg.UsernameAttr, a.cfg.FullnameAttr, a.cfg.GroupAttr}, nil))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return entry, fmt.Errorf("%w: ldap search failed: %v", errBackendUnavailable, err)
+	}
+	switch {
+	case result == nil || len(result.Entries) == 0:
+		return entry, errUnknownUser
+	case len(result.Entries) > 1:
+		return entry, fmt.Errorf("ldap filter matched more than one entry for %q", username)
+	}
+
+	found := result.Entries[0]
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return entry, errInvalidCredentials
+		}
+		return entry, fmt.Errorf("%w: ldap user bind failed: %v", errBackendUnavailable, err)
+	}
+
+	entry.DN = found.DN
+	entry.Username = found.GetAttributeValue(a.cfg.UsernameAttr)
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	entry.Fullname = found.GetAttributeValue(a.cfg.FullnameAttr)
+	if entry.Fullname == "" {
+		entry.Fullname = entry.Username
+	}
+	for _, group := range found.GetAttributeValues(a.cfg.GroupAttr) {
+		entry.Groups = append(entry.Groups, group)
+		// memberOf berisi DN lengkap, CN ikut disimpan supaya env cukup berisi nama grup
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			entry.Groups = append(entry.Groups, dn.RDNs[0].Attributes[0].Value)
+		}
+	}
+	return entry, nil
+}
+
+func (a *ldapAuthenticator) Authenticate(r *http.Request, db *sql.DB, username, password string) (User, error) {
+	entry, err := a.lookup(username, password)
+	if err != nil {
+		return User{}, err
+	}
+	role, division, ok := a.cfg.Groups.mapGroups(entry.Groups)
+	if !ok {
+		return User{}, errGroupNotAllowed
+	}
+	if len(entry.Username) > 50 {
+		return User{}, fmt.Errorf("ldap username %q is too long", entry.Username)
+	}
+
+	if err := a.provision(r, db, entry, role, division); err != nil {
+		return User{}, err
+	}
+	recordAudit(db, r, auditLoginLDAP, entry.Username, "dn="+entry.DN)
+	return getUserByUsername(db, entry.Username)
+}
+
+// Membuat akun lokal saat pertama login (just-in-time provisioning) dan
+// menyamakan role serta divisi dengan grup di setiap login
+func (a *ldapAuthenticator) provision(r *http.Request, db *sql.DB, entry ldapEntry, role, division string) error {
+	var id int
+	var dn sql.NullString
+	var accountType string
+	err := db.QueryRow("SELECT id, ldap_dn, account_type FROM users WHERE username = ?", entry.Username).
+		Scan(&id, &dn, &accountType)
+	if err == sql.ErrNoRows {
+		_, err = db.Exec(`
+			INSERT INTO users (username, fullname, password, role, division, status, ldap_dn)
+			VALUES (?, ?, '', ?, ?, ?, ?)`,
+			entry.Username, entry.Fullname, role, division, userStatusActive, entry.DN)
+		if err == nil {
+			recordAudit(db, r, auditUserProvisioned, entry.Username, "source=ldap role="+role)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if accountType == accountService || (!dn.Valid && !a.cfg.LinkExisting) {
+		return errUsernameTaken
+	}
+
+	// Password lokal dihapus saat akun pertama kali ditautkan supaya
+	// password lama tidak bisa dipakai lagi
+	_, err = db.Exec(`
+		UPDATE users SET password = IF(ldap_dn IS NULL, '', password), ldap_dn = ?,
+			role = ?, division = IF(? = '', division, ?)
+		WHERE id = ?`,
+		entry.DN, role, division, division, id)
+	return err
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeLDAP adalah server LDAP minimal di dalam proses yang hanya melayani
+// Bind, Search dan Unbind, cukup untuk menguji ldapAuthenticator
+type fakeLDAP struct {
+	ln net.Listener
+
+	mu        sync.Mutex
+	passwords map[string]string // DN -> password
+	entries   []fakeLDAPEntry
+	filters   []string // filter search yang diterima, sudah di-decompile
+}
+
+type fakeLDAPEntry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+const (
+	testLDAPBaseDN  = "DC=kantor,DC=local"
+	testLDAPService = "CN=svc-sibakar,OU=Service,DC=kantor,DC=local"
+	testLDAPBudiDN  = "CN=Budi Santoso,OU=Staff,DC=kantor,DC=local"
+)
+
+func newFakeLDAP(t *testing.T) *fakeLDAP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeLDAP{
+		ln: ln,
+		passwords: map[string]string{
+			testLDAPService: "svc-pass",
+			testLDAPBudiDN:  "budi-pass",
+		},
+		entries: []fakeLDAPEntry{{
+			dn: testLDAPBudiDN,
+			attrs: map[string][]string{
+				"sAMAccountName": {"budi"},
+				"displayName":    {"Budi Santoso"},
+				"memberOf": {
+					"CN=SIBAKAR Admins,OU=Groups,DC=kantor,DC=local",
+					"CN=Divisi TI,OU=Groups,DC=kantor,DC=local",
+				},
+			},
+		}},
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeLDAP) url() string {
+	return "ldap://" + s.ln.Addr().String()
+}
+
+func (s *fakeLDAP) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeLDAP) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID := packet.Children[0].Value
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := ber.DecodeString(op.Children[1].Data.Bytes())
+			password := ber.DecodeString(op.Children[2].Data.Bytes())
+			s.mu.Lock()
+			want, ok := s.passwords[dn]
+			s.mu.Unlock()
+			code := ldap.LDAPResultSuccess
+			if dn != "" && (!ok || want != password) {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(ldapMessage(msgID, ldapResult(ldap.ApplicationBindResponse, code)).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			s.mu.Lock()
+			s.filters = append(s.filters, filter)
+			s.mu.Unlock()
+			for _, e := range s.match(op.Children[6]) {
+				conn.Write(ldapMessage(msgID, e.packet()).Bytes())
+			}
+			conn.Write(ldapMessage(msgID, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+// Entri yang cocok dengan semua equalityMatch di filter. Filter lain
+// (substring, or, not) tidak dipakai ldapAuthenticator.
+func (s *fakeLDAP) match(filter *ber.Packet) []fakeLDAPEntry {
+	var found []fakeLDAPEntry
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.matches(filter) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func (e fakeLDAPEntry) matches(filter *ber.Packet) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !e.matches(child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterEqualityMatch:
+		attr := ber.DecodeString(filter.Children[0].Data.Bytes())
+		value := ber.DecodeString(filter.Children[1].Data.Bytes())
+		if strings.EqualFold(attr, "objectClass") {
+			return strings.EqualFold(value, "user")
+		}
+		for name, values := range e.attrs {
+			if strings.EqualFold(name, attr) {
+				for _, v := range values {
+					if strings.EqualFold(v, value) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (e fakeLDAPEntry) packet() *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+	attrs := ber.NewSequence("Attributes")
+	for name, values := range e.attrs {
+		attr := ber.NewSequence("Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+func ldapMessage(msgID interface{}, op *ber.Packet) *ber.Packet {
+	msg := ber.NewSequence("LDAP Message")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "Message ID"))
+	msg.AppendChild(op)
+	return msg
+}
+
+func ldapResult(tag ber.Tag, code int) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	p.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return p
+}
+
+func testLDAPConfig(url string) LDAPConfig {
+	return LDAPConfig{
+		URL:          url,
+		BindDN:       testLDAPService,
+		BindPassword: "svc-pass",
+		BaseDN:       testLDAPBaseDN,
+		UserFilter:   "(&(objectClass=user)(sAMAccountName={username}))",
+		UsernameAttr: "sAMAccountName",
+		FullnameAttr: "displayName",
+		GroupAttr:    "memberOf",
+		Groups: groupMapping{
+			AdminGroups:   []string{"SIBAKAR Admins"},
+			DivisionMap:   map[string]string{"CN=Divisi TI,OU=Groups,DC=kantor,DC=local": "TI"},
+			DivisionOrder: []string{"CN=Divisi TI,OU=Groups,DC=kantor,DC=local"},
+		},
+		Timeout: 2 * time.Second,
+	}
+}
+
+// Alamat yang pasti menolak koneksi
+func unreachableLDAPURL(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return "ldap://" + addr
+}
+
+func TestLDAPLookup(t *testing.T) {
+	dir := newFakeLDAP(t)
+	a := &ldapAuthenticator{cfg: testLDAPConfig(dir.url())}
+
+	entry, err := a.lookup("budi", "budi-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.DN != testLDAPBudiDN || entry.Username != "budi" || entry.Fullname != "Budi Santoso" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	// memberOf disimpan sebagai DN lengkap dan CN
+	want := []string{
+		"CN=SIBAKAR Admins,OU=Groups,DC=kantor,DC=local", "SIBAKAR Admins",
+		"CN=Divisi TI,OU=Groups,DC=kantor,DC=local", "Divisi TI",
+	}
+	if strings.Join(entry.Groups, "|") != strings.Join(want, "|") {
+		t.Fatalf("groups = %q, want %q", entry.Groups, want)
+	}
+	// Admin dicocokkan lewat CN, divisi lewat DN lengkap
+	role, division, ok := a.cfg.Groups.mapGroups(entry.Groups)
+	if role != roleAdmin || division != "TI" || !ok {
+		t.Fatalf("mapGroups = %q, %q, %v", role, division, ok)
+	}
+
+	for _, tc := range []struct {
+		name, username, password string
+		want                     error
+	}{
+		{"wrong password", "budi", "salah", errInvalidCredentials},
+		{"empty password", "budi", "", errInvalidCredentials},
+		{"unknown user", "siti", "apa-saja", errUnknownUser},
+	} {
+		if _, err := a.lookup(tc.username, tc.password); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestLDAPLookupEscapesFilter(t *testing.T) {
+	dir := newFakeLDAP(t)
+	a := &ldapAuthenticator{cfg: testLDAPConfig(dir.url())}
+
+	// Tanpa escape, filter ini menjadi (sAMAccountName=*) dan cocok dengan siapa saja
+	if _, err := a.lookup("*)(sAMAccountName=*", "budi-pass"); !errors.Is(err, errUnknownUser) {
+		t.Fatalf("err = %v, want errUnknownUser", err)
+	}
+	dir.mu.Lock()
+	defer dir.mu.Unlock()
+	want := `(&(objectClass=user)(sAMAccountName=\2a\29\28sAMAccountName=\2a))`
+	if len(dir.filters) != 1 || dir.filters[0] != want {
+		t.Fatalf("filters = %q, want %q", dir.filters, want)
+	}
+}
+
+func TestLDAPLookupUnreachable(t *testing.T) {
+	a := &ldapAuthenticator{cfg: testLDAPConfig(unreachableLDAPURL(t))}
+	if _, err := a.lookup("budi", "budi-pass"); !errors.Is(err, errBackendUnavailable) {
+		t.Fatalf("err = %v, want errBackendUnavailable", err)
+	}
+
+	// Bind akun layanan gagal juga berarti direktori tidak bisa dipakai
+	dir := newFakeLDAP(t)
+	cfg := testLDAPConfig(dir.url())
+	cfg.BindPassword = "salah"
+	a = &ldapAuthenticator{cfg: cfg}
+	if _, err := a.lookup("budi", "budi-pass"); !errors.Is(err, errBackendUnavailable) {
+		t.Fatalf("err = %v, want errBackendUnavailable", err)
+	}
+}
+
+func TestLDAPProvision(t *testing.T) {
+	entry := ldapEntry{DN: testLDAPBudiDN, Username: "budi", Fullname: "Budi Santoso"}
+	existing := []string{"id", "ldap_dn", "account_type"}
+
+	for _, tc := range []struct {
+		name         string
+		linkExisting bool
+		rows         *sqlmock.Rows
+		want         error
+		expect       func(sqlmock.Sqlmock)
+	}{
+		{
+			name: "first login creates account",
+			rows: sqlmock.NewRows(existing),
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO users").
+					WithArgs("budi", "Budi Santoso", roleAdmin, "TI", userStatusActive, testLDAPBudiDN).
+					WillReturnResult(sqlmock.NewResult(7, 1))
+				expectAudit(mock, auditUserProvisioned)
+			},
+		},
+		{
+			name: "linked account syncs role and division",
+			rows: sqlmock.NewRows(existing).AddRow(7, testLDAPBudiDN, "user"),
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users SET password").
+					WithArgs(testLDAPBudiDN, roleAdmin, "TI", "TI", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "existing local account is not taken over",
+			rows: sqlmock.NewRows(existing).AddRow(7, nil, "user"),
+			want: errUsernameTaken,
+		},
+		{
+			name:         "existing local account is linked when allowed",
+			linkExisting: true,
+			rows:         sqlmock.NewRows(existing).AddRow(7, nil, "user"),
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE users SET password").
+					WithArgs(testLDAPBudiDN, roleAdmin, "TI", "TI", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:         "service account is never linked",
+			linkExisting: true,
+			rows:         sqlmock.NewRows(existing).AddRow(7, nil, accountService),
+			want:         errUsernameTaken,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.ExpectQuery("SELECT id, ldap_dn, account_type FROM users").WithArgs("budi").WillReturnRows(tc.rows)
+			if tc.expect != nil {
+				tc.expect(mock)
+			}
+			db := setupDatabase()
+			defer db.Close()
+
+			cfg := testLDAPConfig("")
+			cfg.LinkExisting = tc.linkExisting
+			a := &ldapAuthenticator{cfg: cfg}
+			err := a.provision(httptest.NewRequest("POST", "/login", nil), db, entry, roleAdmin, "TI")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestChainAuthenticator(t *testing.T) {
+	hash, err := hashPassword("lokal-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	localAdmin := func() *sqlmock.Rows {
+		return sqlmock.NewRows(userColumns).AddRow(1, "admin", "Admin", hash, roleAdmin, userStatusActive, "user", false)
+	}
+	req := httptest.NewRequest("POST", "/login", nil)
+
+	t.Run("wrong directory password stops the chain", func(t *testing.T) {
+		dir := newFakeLDAP(t)
+		useMockDB(t) // local tidak boleh menyentuh database
+		db := setupDatabase()
+		defer db.Close()
+
+		chain := chainAuthenticator{&ldapAuthenticator{cfg: testLDAPConfig(dir.url())}, localAuthenticator{}}
+		if _, err := chain.Authenticate(req, db, "budi", "salah"); !errors.Is(err, errInvalidCredentials) {
+			t.Fatalf("err = %v, want errInvalidCredentials", err)
+		}
+	})
+
+	t.Run("unreachable directory falls through to local", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery("SELECT id, username, fullname, password").WithArgs("admin").WillReturnRows(localAdmin())
+		db := setupDatabase()
+		defer db.Close()
+
+		chain := chainAuthenticator{&ldapAuthenticator{cfg: testLDAPConfig(unreachableLDAPURL(t))}, localAuthenticator{}}
+		user, err := chain.Authenticate(req, db, "admin", "lokal-pass")
+		if err != nil || user.Username != "admin" {
+			t.Fatalf("user = %+v, err = %v", user, err)
+		}
+	})
+
+	t.Run("unknown directory user falls through to local", func(t *testing.T) {
+		dir := newFakeLDAP(t)
+		mock := useMockDB(t)
+		mock.ExpectQuery("SELECT id, username, fullname, password").WithArgs("admin").WillReturnRows(localAdmin())
+		db := setupDatabase()
+		defer db.Close()
+
+		chain := chainAuthenticator{&ldapAuthenticator{cfg: testLDAPConfig(dir.url())}, localAuthenticator{}}
+		user, err := chain.Authenticate(req, db, "admin", "lokal-pass")
+		if err != nil || user.Username != "admin" {
+			t.Fatalf("user = %+v, err = %v", user, err)
+		}
+	})
+
+	t.Run("username taken stops the chain", func(t *testing.T) {
+		dir := newFakeLDAP(t)
+		mock := useMockDB(t)
+		mock.ExpectQuery("SELECT id, ldap_dn, account_type FROM users").WithArgs("budi").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "ldap_dn", "account_type"}).AddRow(7, nil, "user"))
+		db := setupDatabase()
+		defer db.Close()
+
+		chain := chainAuthenticator{&ldapAuthenticator{cfg: testLDAPConfig(dir.url())}, localAuthenticator{}}
+		if _, err := chain.Authenticate(req, db, "budi", "budi-pass"); !errors.Is(err, errUsernameTaken) {
+			t.Fatalf("err = %v, want errUsernameTaken", err)
+		}
+	})
+
+	t.Run("directory user outside allowed groups stops the chain", func(t *testing.T) {
+		dir := newFakeLDAP(t)
+		useMockDB(t)
+		db := setupDatabase()
+		defer db.Close()
+
+		cfg := testLDAPConfig(dir.url())
+		cfg.Groups = groupMapping{AllowedGroups: []string{"SIBAKAR Users"}}
+		chain := chainAuthenticator{&ldapAuthenticator{cfg: cfg}, localAuthenticator{}}
+		if _, err := chain.Authenticate(req, db, "budi", "budi-pass"); !errors.Is(err, errGroupNotAllowed) {
+			t.Fatalf("err = %v, want errGroupNotAllowed", err)
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LimiterStore menyimpan token bucket dan hitungan login gagal. Default
+// disimpan di memori; pakai RATE_LIMIT_STORE=database jika server berjalan
+// lebih dari satu instance supaya batasnya berlaku bersama.
+type LimiterStore interface {
+	// Take mengambil satu token dari bucket. Jika kosong, mengembalikan
+	// false dan lama waktu sampai token berikutnya tersedia.
+	Take(ctx context.Context, key string, limit bucketLimit) (bool, time.Duration, error)
+	// RecordFailure menambah hitungan gagal dan mengunci akun jika batas tercapai
+	RecordFailure(ctx context.Context, username string, policy lockoutPolicy) (loginFailures, error)
+	Failures(ctx context.Context, username string) (loginFailures, error)
+	ResetFailures(ctx context.Context, username string) error
+	// ListFailures mengembalikan akun yang masih punya hitungan gagal aktif
+	ListFailures(ctx context.Context, policy lockoutPolicy) ([]loginFailures, error)
+	// Prune menghapus bucket dan hitungan yang sudah kedaluwarsa
+	Prune(ctx context.Context, olderThan time.Duration) error
+}
+
+// bucketLimit: Burst token, terisi penuh kembali dalam waktu Window
+type bucketLimit struct {
+	Burst  int
+	Window time.Duration
+}
+
+func (b bucketLimit) refillPerSecond() float64 {
+	return float64(b.Burst) / b.Window.Seconds()
+}
+
+type lockoutPolicy struct {
+	Threshold int           // jumlah gagal sebelum akun dikunci
+	Window    time.Duration // hitungan gagal direset jika tidak ada percobaan selama ini
+	Duration  time.Duration // lama akun dikunci
+}
+
+type loginFailures struct {
+	Username    string
+	Count       int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+func (f loginFailures) Locked(now time.Time) bool {
+	return now.Before(f.LockedUntil)
+}
+
+// Hitungan dianggap basi jika kunci sudah lewat atau percobaan terakhir
+// sudah di luar window
+func (f loginFailures) expired(now time.Time, policy lockoutPolicy) bool {
+	if !f.LockedUntil.IsZero() {
+		return !f.Locked(now)
+	}
+	return now.Sub(f.LastFailure) > policy.Window
+}
+
+func (f loginFailures) next(now time.Time, policy lockoutPolicy) loginFailures {
+	if f.expired(now, policy) {
+		f.Count = 0
+		f.LockedUntil = time.Time{}
+	}
+	f.Count++
+	f.LastFailure = now
+	if f.Count >= policy.Threshold {
+		f.LockedUntil = now.Add(policy.Duration)
+	}
+	return f
+}
+
+// Menghitung isi bucket setelah diisi ulang sejak updated, lalu mengambil satu token
+func takeToken(tokens float64, updated, now time.Time, limit bucketLimit) (float64, bool, time.Duration) {
+	rate := limit.refillPerSecond()
+	tokens = math.Min(float64(limit.Burst), tokens+now.Sub(updated).Seconds()*rate)
+	if tokens < 1 {
+		wait := time.Duration((1 - tokens) / rate * float64(time.Second))
+		return tokens, false, wait
+	}
+	return tokens - 1, true, 0
+}
+
+func newLimiterStore(kind string, db *sql.DB) LimiterStore {
+	if kind == "database" {
+		return &dbLimiterStore{db: db}
+	}
+	return newMemoryLimiterStore()
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type memoryLimiterStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*memoryBucket
+	failures map[string]loginFailures
+}
+
+func newMemoryLimiterStore() *memoryLimiterStore {
+	return &memoryLimiterStore{buckets: map[string]*memoryBucket{}, failures: map[string]loginFailures{}}
+}
+
+func (s *memoryLimiterStore) Take(ctx context.Context, key string, limit bucketLimit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	tokens, allowed, wait := takeToken(b.tokens, b.updated, now, limit)
+	b.tokens, b.updated = tokens, now
+	return allowed, wait, nil
+}
+
+func (s *memoryLimiterStore) RecordFailure(ctx context.Context, username string, policy lockoutPolicy) (loginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.failures[username]
+	f.Username = username
+	f = f.next(time.Now(), policy)
+	s.failures[username] = f
+	return f, nil
+}
+
+func (s *memoryLimiterStore) Failures(ctx context.Context, username string) (loginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures[username], nil
+}
+
+func (s *memoryLimiterStore) ResetFailures(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, username)
+	return nil
+}
+
+func (s *memoryLimiterStore) ListFailures(ctx context.Context, policy lockoutPolicy) ([]loginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	list := []loginFailures{}
+	for _, f := range s.failures {
+		if !f.expired(now, policy) {
+			list = append(list, f)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastFailure.After(list[j].LastFailure) })
+	return list, nil
+}
+
+func (s *memoryLimiterStore) Prune(ctx context.Context, olderThan time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	for key, b := range s.buckets {
+		if b.updated.Before(cutoff) {
+			delete(s.buckets, key)
+		}
+	}
+	for username, f := range s.failures {
+		if f.LastFailure.Before(cutoff) && f.LockedUntil.Before(cutoff) {
+			delete(s.failures, username)
+		}
+	}
+	return nil
+}
+
+// dbLimiterStore menyimpan state di tabel rate_limit_buckets dan
+// login_failures. Waktu disimpan sebagai Unix milidetik supaya perhitungan
+// token tidak bergantung pada zona waktu atau parsing DATETIME.
+type dbLimiterStore struct {
+	db *sql.DB
+}
+
+func (s *dbLimiterStore) Take(ctx context.Context, key string, limit bucketLimit) (bool, time.Duration, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO rate_limit_buckets (bucket_key, tokens, updated_at) VALUES (?, ?, ?)",
+		key, limit.Burst, now.UnixMilli())
+	if err != nil {
+		return false, 0, err
+	}
+
+	var tokens float64
+	var updated int64
+	err = tx.QueryRowContext(ctx, "SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = ? FOR UPDATE", key).
+		Scan(&tokens, &updated)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens, allowed, wait := takeToken(tokens, time.UnixMilli(updated), now, limit)
+	_, err = tx.ExecContext(ctx, "UPDATE rate_limit_buckets SET tokens = ?, updated_at = ? WHERE bucket_key = ?",
+		tokens, now.UnixMilli(), key)
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, wait, tx.Commit()
+}
+
+func (s *dbLimiterStore) RecordFailure(ctx context.Context, username string, policy lockoutPolicy) (loginFailures, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return loginFailures{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO login_failures (username, failures, last_failure_at, locked_until) VALUES (?, 0, 0, 0)", username)
+	if err != nil {
+		return loginFailures{}, err
+	}
+	f, err := scanLoginFailures(tx.QueryRowContext(ctx,
+		"SELECT username, failures, last_failure_at, locked_until FROM login_failures WHERE username = ? FOR UPDATE", username))
+	if err != nil {
+		return loginFailures{}, err
+	}
+
+	f = f.next(time.Now(), policy)
+	_, err = tx.ExecContext(ctx, "UPDATE login_failures SET failures = ?, last_failure_at = ?, locked_until = ? WHERE username = ?",
+		f.Count, f.LastFailure.UnixMilli(), unixMilliOrZero(f.LockedUntil), username)
+	if err != nil {
+		return loginFailures{}, err
+	}
+	return f, tx.Commit()
+}
+
+func (s *dbLimiterStore) Failures(ctx context.Context, username string) (loginFailures, error) {
+	f, err := scanLoginFailures(s.db.QueryRowContext(ctx,
+		"SELECT username, failures, last_failure_at, locked_until FROM login_failures WHERE username = ?", username))
+	if err == sql.ErrNoRows {
+		return loginFailures{}, nil
+	}
+	return f, err
+}
+
+func (s *dbLimiterStore) ResetFailures(ctx context.Context, username string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE username = ?", username)
+	return err
+}
+
+func (s *dbLimiterStore) ListFailures(ctx context.Context, policy lockoutPolicy) ([]loginFailures, error) {
+	now := time.Now()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, failures, last_failure_at, locked_until FROM login_failures
+		WHERE locked_until > ? OR last_failure_at > ?
+		ORDER BY last_failure_at DESC`, now.UnixMilli(), now.Add(-policy.Window).UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []loginFailures{}
+	for rows.Next() {
+		f, err := scanLoginFailures(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !f.expired(now, policy) {
+			list = append(list, f)
+		}
+	}
+	return list, rows.Err()
+}
+
+func (s *dbLimiterStore) Prune(ctx context.Context, olderThan time.Duration) error {
+	cutoff := time.Now().Add(-olderThan).UnixMilli()
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < ?", cutoff); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_failures WHERE last_failure_at < ? AND locked_until < ?", cutoff, cutoff)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLoginFailures(row rowScanner) (loginFailures, error) {
+	var f loginFailures
+	var last, locked int64
+	if err := row.Scan(&f.Username, &f.Count, &last, &locked); err != nil {
+		return f, err
+	}
+	if last > 0 {
+		f.LastFailure = time.UnixMilli(last)
+	}
+	if locked > 0 {
+		f.LockedUntil = time.UnixMilli(locked)
+	}
+	return f, nil
+}
+
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTakeToken(t *testing.T) {
+	// 10 token per menit: satu token terisi setiap 6 detik
+	limit := bucketLimit{Burst: 10, Window: time.Minute}
+	start := time.Unix(1700000000, 0)
+
+	for _, tc := range []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		left    float64
+		allowed bool
+		wait    time.Duration
+	}{
+		{"full bucket", 10, 0, 9, true, 0},
+		{"refill is capped at burst", 10, time.Hour, 9, true, 0},
+		{"last token", 1, 0, 0, true, 0},
+		{"empty bucket", 0, 0, 0, false, 6 * time.Second},
+		{"partly refilled", 0, 3 * time.Second, 0.5, false, 3 * time.Second},
+		{"refilled one token", 0, 6 * time.Second, 0, true, 0},
+		{"refilled after a while", 2, 30 * time.Second, 6, true, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			left, allowed, wait := takeToken(tc.tokens, start, start.Add(tc.elapsed), limit)
+			if allowed != tc.allowed || math.Abs(left-tc.left) > 1e-9 || (wait-tc.wait).Abs() > time.Millisecond {
+				t.Errorf("takeToken = %v, %v, %v, want %v, %v, %v", left, allowed, wait, tc.left, tc.allowed, tc.wait)
+			}
+		})
+	}
+}
+
+func TestLoginFailuresNext(t *testing.T) {
+	policy := lockoutPolicy{Threshold: 3, Window: 15 * time.Minute, Duration: 10 * time.Minute}
+	now := time.Unix(1700000000, 0)
+
+	for _, tc := range []struct {
+		name    string
+		before  loginFailures
+		count   int
+		expired bool
+		locked  bool
+	}{
+		{"first failure", loginFailures{}, 1, true, false},
+		{"inside window", loginFailures{Count: 1, LastFailure: now.Add(-time.Minute)}, 2, false, false},
+		{"reaches threshold", loginFailures{Count: 2, LastFailure: now.Add(-time.Minute)}, 3, false, true},
+		{"window passed", loginFailures{Count: 2, LastFailure: now.Add(-16 * time.Minute)}, 1, true, false},
+		{"still locked", loginFailures{Count: 3, LastFailure: now.Add(-20 * time.Minute), LockedUntil: now.Add(time.Minute)}, 4, false, true},
+		{"lock expired", loginFailures{Count: 3, LastFailure: now.Add(-time.Minute), LockedUntil: now.Add(-time.Second)}, 1, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.before.expired(now, policy); got != tc.expired {
+				t.Errorf("expired = %v, want %v", got, tc.expired)
+			}
+			f := tc.before.next(now, policy)
+			if f.Count != tc.count || !f.LastFailure.Equal(now) {
+				t.Errorf("next = %+v, want count %d at %v", f, tc.count, now)
+			}
+			if f.Locked(now) != tc.locked {
+				t.Errorf("locked = %v, want %v", f.Locked(now), tc.locked)
+			}
+			if tc.locked && tc.before.LockedUntil.IsZero() && !f.LockedUntil.Equal(now.Add(policy.Duration)) {
+				t.Errorf("locked until %v, want %v", f.LockedUntil, now.Add(policy.Duration))
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterStoreLockout(t *testing.T) {
+	ctx := context.Background()
+	policy := lockoutPolicy{Threshold: 3, Window: 15 * time.Minute, Duration: 10 * time.Minute}
+	store := newMemoryLimiterStore()
+
+	for i := 1; i <= policy.Threshold; i++ {
+		f, err := store.RecordFailure(ctx, "budi", policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Count != i || f.Locked(time.Now()) != (i == policy.Threshold) {
+			t.Fatalf("failure %d: %+v", i, f)
+		}
+	}
+	if f, _ := store.Failures(ctx, "budi"); !f.Locked(time.Now()) {
+		t.Fatal("account not locked after reaching the threshold")
+	}
+	if f, _ := store.Failures(ctx, "siti"); f.Count != 0 || f.Locked(time.Now()) {
+		t.Errorf("other account affected: %+v", f)
+	}
+	if list, _ := store.ListFailures(ctx, policy); len(list) != 1 || list[0].Username != "budi" {
+		t.Errorf("ListFailures = %+v", list)
+	}
+
+	// Kunci sudah lewat: hitungan mulai dari awal dan tidak lagi terdaftar
+	f := store.failures["budi"]
+	f.LockedUntil = time.Now().Add(-time.Second)
+	store.failures["budi"] = f
+	if list, _ := store.ListFailures(ctx, policy); len(list) != 0 {
+		t.Errorf("expired lockout still listed: %+v", list)
+	}
+	if f, _ := store.RecordFailure(ctx, "budi", policy); f.Count != 1 || f.Locked(time.Now()) {
+		t.Errorf("failure after lock expiry = %+v", f)
+	}
+
+	if err := store.ResetFailures(ctx, "budi"); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := store.Failures(ctx, "budi"); f.Count != 0 {
+		t.Errorf("failures after reset = %+v", f)
+	}
+}
+
+func TestMemoryLimiterStoreTake(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryLimiterStore()
+	limit := bucketLimit{Burst: 2, Window: time.Hour}
+
+	for i, want := range []bool{true, true, false} {
+		allowed, wait, err := store.Take(ctx, "login:ip:10.0.0.1", limit)
+		if err != nil || allowed != want {
+			t.Fatalf("take %d = %v, %v", i, allowed, err)
+		}
+		if !allowed && (wait < 29*time.Minute || wait > 30*time.Minute) {
+			t.Errorf("wait = %v, want about 30m", wait)
+		}
+	}
+	// Bucket lain tidak terpengaruh
+	if allowed, _, _ := store.Take(ctx, "login:ip:10.0.0.2", limit); !allowed {
+		t.Error("separate key throttled")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Logging terstruktur dengan log/slog. Format dan level diatur lewat env:
+//
+//	LOG_FORMAT=text|json (default text)
+//	LOG_LEVEL=debug|info|warn|error (default info)
+//
+// Request ID dan nama job diambil otomatis dari context, jadi cukup pakai
+// slog.InfoContext(r.Context(), ...) di handler. Nilai sensitif (password,
+// token, email, nomor telepon) disamarkan sebelum ditulis.
+
+const jobNameKey contextKey = "job"
+
+func setupLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	if getEnv("LOG_FORMAT", "text") == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// contextHandler menambahkan request_id dan job dari context ke setiap log
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id, ok := ctx.Value(requestIDKey).(string); ok {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	if job, ok := ctx.Value(jobNameKey).(string); ok {
+		rec.AddAttrs(slog.String("job", job))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Key yang nilainya tidak boleh muncul di log sama sekali
+var secretKeyParts = []string{"password", "token", "secret", "authorization", "cookie"}
+
+var (
+	logEmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Nomor HP Indonesia (08..., 628..., +628...) dan nomor internasional berawalan +
+	logPhonePattern = regexp.MustCompile(`(?:\+62|62|0)8[0-9]{7,11}|\+[1-9][0-9]{7,14}`)
+)
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return slog.String(a.Key, "[REDACTED]")
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		// Error dari database bisa berisi data, misalnya "Duplicate entry 'a@b.com'"
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+func redactString(s string) string {
+	s = logEmailPattern.ReplaceAllString(s, "[EMAIL]")
+	return logPhonePattern.ReplaceAllString(s, "[PHONE]")
+}
+
+// Menulis log lalu keluar, dipakai untuk error saat start
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// statusRecorder mencatat status dan jumlah byte response untuk access log
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriter.Write(b)
+	sr.bytes += n
+	return n, err
+}
+
+// Export CSV/XLSX memakai Flush untuk streaming
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// Middleware access log: satu baris per request dengan status dan latency.
+// Query string tidak dicatat karena bisa berisi token.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		case r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/metrics":
+			// Probe dan scrape datang setiap beberapa detik
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("ip", clientIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
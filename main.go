@@ -1,381 +1,486 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/rs/cors"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
 	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Fullname string `json:"fullname"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Fullname string `json:"fullname" validate:"required,max=100"`
+	Password string `json:"password,omitempty" validate:"required,max=72"`
+	Role     string `json:"role" validate:"required,oneof=admin anggota"`
+	Division string `json:"division" validate:"max=100"`
+	Status   string `json:"status,omitempty"` // active, atau pending selama menunggu persetujuan admin
+	// user, atau service untuk service account yang hanya memakai API token
+	AccountType string `json:"account_type,omitempty"`
+	// true jika login butuh kode TOTP
+	TwoFactor bool `json:"two_factor_enabled"`
 }
 
+// Response login berisi token JWT dan data pengguna. Jika akun memakai 2FA,
+// response hanya berisi challenge_token untuk POST /login/2fa.
+type LoginResponse struct {
+	Token              string `json:"token,omitempty"`
+	User               *User  `json:"user,omitempty"`
+	TwoFactorRequired  bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken     string `json:"challenge_token,omitempty"`
+	ChallengeExpiresAt string `json:"challenge_expires_at,omitempty"`
+}
+
+// Payload untuk login
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Driver dan DSN database, test menggantinya dengan sqlmock
+var (
+	dbDriver = "mysql"
+	dbDSN    = "root:@tcp(127.0.0.1:3306)/sibakar" // Sesuaikan dengan pengaturan DB Anda
+)
+
 // Setup database connection
 func setupDatabase() *sql.DB {
-	dsn := "root:@tcp(127.0.0.1:3306)/sibakar" // Sesuaikan dengan pengaturan DB Anda
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open(dbDriver, dbDSN)
 	if err != nil {
-		log.Fatal(err)
+		fatal("invalid database configuration", err)
 	}
 	return db
 }
 
-// Register user handler
-func registerHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// Login user handler
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	var user LoginRequest
+	if !decodeJSON(w, r, &user) {
 		return
 	}
-
-	//validasi role
-	if user.Role != "admin" && user.Role != "anggota" {
-		http.Error(w, "Invalid role", http.StatusBadRequest)
+	if errs := validateStruct(user); len(errs) > 0 {
+		writeValidationError(w, r, errs)
 		return
 	}
 
 	db := setupDatabase()
 	defer db.Close()
 
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+	storedUser, err := authenticator.Authenticate(r, db, user.Username, user.Password)
+	switch {
+	case errors.Is(err, errUnknownUser), errors.Is(err, errInvalidCredentials):
+		loginFailed(w, r, db, user.Username)
 		return
-	}
-	user.Password = string(hashedPassword) // Simpan hash ke database
-
-	if err := registerUser(db, user); err != nil {
-		http.Error(w, "Error registering user", http.StatusConflict)
+	case errors.Is(err, errGroupNotAllowed):
+		metricLogins.Inc("failure")
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Your account is not in a group allowed to use this application")
 		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
-}
-
-func registerUser(db *sql.DB, user User) error {
-	_, err := db.Exec("INSERT INTO users (username, fullname, password) VALUES (?, ?, ?)", user.Username, user.Fullname, user.Password)
-	return err
-}
-
-// Login user handler
-func loginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case errors.Is(err, errUsernameTaken):
+		metricLogins.Inc("failure")
+		writeError(w, r, http.StatusConflict, codeConflict, "An account with this username already exists, ask an admin to link it")
+		return
+	case errors.Is(err, errBackendUnavailable):
+		slog.ErrorContext(r.Context(), "auth backend unavailable", "error", err)
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "Login service is unavailable, please try again later")
+		return
+	case err != nil:
+		writeInternalError(w, r, err)
 		return
 	}
 
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Password benar tetapi akun memakai 2FA: login dilanjutkan di POST /login/2fa.
+	// Hitungan gagal baru direset setelah kode TOTP benar.
+	if storedUser.TwoFactor {
+		challenge, expiresAt, err := createLoginChallenge(db, storedUser.ID)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, LoginResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     challenge,
+			ChallengeExpiresAt: expiresAt.Format(time.RFC3339),
+		})
 		return
 	}
 
-	db := setupDatabase()
-	defer db.Close()
+	loginSucceeded(r, user.Username)
+	completeLogin(w, r, db, storedUser, false)
+}
 
-	// Pastikan variabel storedUser dideklarasikan di sini
-	storedUser, err := getUserByUsername(db, user.Username)
+// Membuat sesi dan token JWT lalu menulis response login. Claim mfa
+// menandai token yang didapat lewat verifikasi TOTP.
+func completeLogin(w http.ResponseWriter, r *http.Request, db *sql.DB, user User, mfa bool) {
+	sessionID, err := createSession(r, db, user.ID)
 	if err != nil {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		writeInternalError(w, r, err)
 		return
 	}
-
-	// Debugging untuk memeriksa nilai storedUser
-	fmt.Println("Stored User:", storedUser)
-
-	// storedUser, err := getUserByUsername(db, user.Username)
-	// if err != nil || !checkPasswordHash(user.Password, storedUser.Password) {
-	// 	http.Error(w, "Invalid username or password", http.StatusUnauthorized)
-	// 	return
-	// }
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": storedUser.Username,
-		"role":     storedUser.Role,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte("your_secret_key"))
+	tokenString, err := tokenIssuer.Issue(r.Context(), user, sessionID, mfa)
 	if err != nil {
-		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"token": tokenString,
-		"user":  storedUser,
-	})
+	metricLogins.Inc("success")
+	user.Password = ""
+	writeJSON(w, http.StatusOK, LoginResponse{Token: tokenString, User: &user})
 }
 
 func getUserByUsername(db *sql.DB, username string) (User, error) {
 	var user User
-	err := db.QueryRow("SELECT id, username, fullname, password, role FROM users WHERE username = ?", username).Scan(&user.ID, &user.Username, &user.Fullname, &user.Password, &user.Role)
+	err := db.QueryRow("SELECT id, username, fullname, password, role, status, account_type, totp_enabled FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &user.Fullname, &user.Password, &user.Role, &user.Status, &user.AccountType, &user.TwoFactor)
 	return user, err
 }
 
-// func checkPasswordHash(password, hash string) bool {
-// 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-// 	return err == nil
-// }
+const (
+	usernameKey contextKey = "username"
+	claimsKey   contextKey = "claims"
+)
+
+// Username dari token yang sudah diverifikasi oleh verifyToken atau verifyAdminRole
+func currentUsername(r *http.Request) string {
+	username, _ := r.Context().Value(usernameKey).(string)
+	return username
+}
+
+// Claim token yang sudah diverifikasi, nil untuk route publik
+func currentClaims(r *http.Request) *AccessClaims {
+	claims, _ := r.Context().Value(claimsKey).(*AccessClaims)
+	return claims
+}
+
+func withClaims(r *http.Request, claims *AccessClaims) *http.Request {
+	ctx := context.WithValue(r.Context(), usernameKey, claims.Username)
+	return r.WithContext(context.WithValue(ctx, claimsKey, claims))
+}
 
 // Middleware untuk verifikasi token
 func verifyToken(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Ambil token dari header Authorization
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, "Token is missing", http.StatusUnauthorized)
-			return
-		}
-
-		// Menghilangkan "Bearer " jika ada di depan token
-		parts := strings.Split(tokenString, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid token format", http.StatusUnauthorized)
-			return
-		}
-		tokenString = parts[1]
-
-		// Verifikasi token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte("your_secret_key"), nil // Kunci rahasia yang sama dengan saat pembuatan token
-		})
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		claims, ok := bearerClaims(w, r)
+		if !ok {
 			return
 		}
 
-		// Token valid, lanjutkan ke handler berikutnya
-		next.ServeHTTP(w, r)
+		// Token valid, simpan username untuk handler lalu lanjutkan ke handler berikutnya
+		next.ServeHTTP(w, withClaims(r, claims))
 	})
 }
 
+var userListSpec = listSpec{
+	Table:       "users",
+	Sortable:    map[string]string{"id": "id", "username": "username", "fullname": "fullname", "role": "role"},
+	DefaultSort: "id",
+	// Filter: ?role=admin|anggota&division=&status=active|pending&account_type=user|service
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		p.FilterParam(r, "role", "role")
+		p.FilterParam(r, "division", "division")
+		p.FilterParam(r, "status", "status")
+		p.FilterParam(r, "account_type", "account_type")
+	},
+}
+
 // Menambahkan Endpoint untuk Mendapatkan Data Pengguna
 func getUsersHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePageRequest(r, userListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
 	db := setupDatabase()
 	defer db.Close()
 
-	rows, err := db.Query("SELECT id, username, fullname FROM users")
+	result, err := page.Query(db, "id, username, fullname, role, division, status, account_type", func() (interface{}, []interface{}) {
+		user := &User{}
+		return user, []interface{}{&user.ID, &user.Username, &user.Fullname, &user.Role, &user.Division, &user.Status, &user.AccountType}
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	var users []User
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Fullname); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		users = append(users, user)
+	writePage(w, r, result)
+}
+
+// Endpoint untuk mengambil satu pengguna berdasarkan ID
+func getUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID := pathID(r, "id")
+
+	db := setupDatabase()
+	defer db.Close()
+
+	var user User
+	err := db.QueryRow("SELECT id, username, fullname, role, division FROM users WHERE id = ?", userID).Scan(&user.ID, &user.Username, &user.Fullname, &user.Role, &user.Division)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	writeJSON(w, http.StatusOK, user)
 }
 
 // Endpoint untuk menghapus data pengguna
 func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("id")
+	userID := pathID(r, "id")
 	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
-	}
-
-	logID := r.URL.Query().Get("id")
-	if logID == "" {
-		http.Error(w, "Log activity ID is required", http.StatusBadRequest)
+		writeValidationError(w, r, map[string]string{"id": "is required"})
 		return
 	}
 
 	db := setupDatabase()
 	defer db.Close()
 
-	_, err := db.Exec("DELETE FROM logactivity WHERE id = ?", logID)
+	result, err := db.Exec("DELETE FROM users WHERE id = ?", userID)
 	if err != nil {
-		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "User not found")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Log activity deleted successfully"))
+	writeMessage(w, http.StatusOK, "User deleted successfully")
+}
+
+// Satu baris dari tabel logactivity
+type LogActivity struct {
+	ID           int    `json:"id"`
+	Namalengkap  string `json:"namalengkap"`
+	NamaDivisi   string `json:"nama_divisi"`
+	SelectedSeat string `json:"selected_seat"`
+	Status       string `json:"status"`
+	CreatedAt    string `json:"created_at"`
+}
+
+var logActivityListSpec = listSpec{
+	Table: "logactivity",
+	Sortable: map[string]string{
+		"id":            "id",
+		"namalengkap":   "namalengkap",
+		"nama_divisi":   "nama_divisi",
+		"selected_seat": "selected_seat",
+		"status":        "status",
+		"created_at":    "created_at",
+	},
+	DefaultSort: "id",
+	// Filter: ?nama_divisi=&status=&seat=&from=YYYY-MM-DD&to=YYYY-MM-DD
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		p.FilterParam(r, "nama_divisi", "nama_divisi")
+		p.FilterParam(r, "status", "status")
+		p.FilterParam(r, "seat", "selected_seat")
+		p.FilterDateRange(r, "created_at", errs)
+	},
 }
 
 // Handler untuk kirim data dari tabel logactivity
 func getLogActivityHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePageRequest(r, logActivityListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
 	db := setupDatabase()
 	defer db.Close()
 
-	rows, err := db.Query("SELECT id, namalengkap, nama_divisi, selected_seat, status FROM logactivity")
+	result, err := page.Query(db, "id, namalengkap, nama_divisi, selected_seat, status, CAST(created_at AS CHAR)", func() (interface{}, []interface{}) {
+		entry := &LogActivity{}
+		return entry, []interface{}{&entry.ID, &entry.Namalengkap, &entry.NamaDivisi, &entry.SelectedSeat, &entry.Status, &entry.CreatedAt}
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeInternalError(w, r, err)
 		return
 	}
-	defer rows.Close()
-
-	var logs []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var namalengkap, namaDivisi, selectedSeat, status string
-		if err := rows.Scan(&id, &namalengkap, &namaDivisi, &selectedSeat, &status); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		logs = append(logs, map[string]interface{}{
-			"id":            id,
-			"namalengkap":   namalengkap,
-			"nama_divisi":   namaDivisi,
-			"selected_seat": selectedSeat,
-			"status":        status,
-		})
-	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(logs)
+	writePage(w, r, result)
 }
 
 // Handler untuk hapus data log
 func deleteLogActivityHandler(w http.ResponseWriter, r *http.Request) {
-	logID := r.URL.Query().Get("id")
+	logID := pathID(r, "id")
 	if logID == "" {
-		http.Error(w, "Log activity ID is required", http.StatusBadRequest)
+		writeValidationError(w, r, map[string]string{"id": "is required"})
 		return
 	}
 
 	db := setupDatabase()
 	defer db.Close()
 
-	_, err := db.Exec("DELETE FROM logactivity WHERE id = ?", logID)
+	if !authorizeBooking(w, r, db, logID) {
+		return
+	}
+
+	// Log tidak dihapus permanen, tapi dipindahkan ke arsip supaya bisa dipulihkan
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	columns := strings.Join(logActivityColumns, ", ")
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO logactivity_archive (%[1]s, archive_reason)
+		SELECT %[1]s, 'deleted' FROM logactivity WHERE id = ?`, columns), logID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	result, err := tx.Exec("DELETE FROM logactivity WHERE id = ?", logID)
 	if err != nil {
-		http.Error(w, "Failed to delete log activity", http.StatusInternalServerError)
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Log activity not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	writeMessage(w, http.StatusOK, "Log activity deleted successfully")
 }
 
 // Middleware untuk memverifikasi role admin
 func verifyAdminRole(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, "Token is missing", http.StatusUnauthorized)
-			return
-		}
-
-		parts := strings.Split(tokenString, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid token format", http.StatusUnauthorized)
-			return
-		}
-		tokenString = parts[1]
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte("your_secret_key"), nil
-		})
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		claims, ok := bearerClaims(w, r)
+		if !ok {
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		// Verifikasi apakah role pengguna adalah "admin"
+		if claims.Role != roleAdmin {
+			writeError(w, r, http.StatusForbidden, codeForbidden, "Forbidden: Insufficient privileges")
 			return
 		}
 
-		// Verifikasi apakah role pengguna adalah "admin"
-		role, ok := claims["role"].(string)
-		if !ok || role != "admin" {
-			http.Error(w, "Forbidden: Insufficient privileges", http.StatusForbidden)
+		// Admin wajib login dengan 2FA (ADMIN_2FA_REQUIRED)
+		if twoFactorConfig.AdminRequired && !claims.MFA {
+			writeError(w, r, http.StatusForbidden, codeTwoFactorRequired,
+				"Admin access requires two-factor authentication: enrol via POST /me/2fa/setup, then log in again")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, withClaims(r, claims))
 	})
 }
 
 func main() {
+	setupLogger()
+
+	// Subcommand CLI, contoh: go run . import-users -dry-run users.csv
+	if len(os.Args) > 1 && os.Args[1] == "import-users" {
+		os.Exit(runImportUsersCommand(os.Args[2:]))
+	}
+
+	// Jalankan migrasi skema sebelum server menerima request
+	db := setupDatabase()
+	if err := runMigrations(db); err != nil {
+		fatal("migration failed", err)
+	}
+	db.Close()
+
+	// Koneksi terpisah untuk job background yang berjalan sepanjang umur proses
+	jobDB := setupDatabase()
+	defer jobDB.Close()
+	registerDBPool("jobs", jobDB)
+	authLimiter = newLimiterStore(authGuard.Store, jobDB)
+	auth, err := newAuthenticator(getEnvList("AUTH_BACKENDS", []string{authBackendLocal}))
+	if err != nil {
+		fatal("invalid AUTH_BACKENDS", err)
+	}
+	authenticator = auth
+	if err := loadBreachedPasswordsFile(getEnv("BREACHED_PASSWORDS_FILE", "")); err != nil {
+		fatal("failed to load BREACHED_PASSWORDS_FILE", err)
+	}
+	// Kunci JWT harus ada sebelum login pertama
+	signingKeys = newKeyring(jobDB)
+	if err := signingKeys.ensure(context.Background()); err != nil {
+		fatal("failed to prepare jwt signing keys", err)
+	}
+	cutover, err := legacyTokenCutover(jobDB)
+	if err != nil {
+		fatal("failed to read legacy token cutover", err)
+	}
+	tokens := newJWTTokens(signingKeys, tokenConfig, cutover)
+	tokenIssuer = tokens
+	tokenVerifier = bearerTokens{jwt: sessionTokens{jwt: tokens, db: jobDB}, apiTokens: &apiTokens{db: jobDB}}
+	scheduler, err := newScheduler(jobDB, defaultJobs())
+	if err != nil {
+		fatal("invalid job schedule", err)
+	}
+	jobScheduler = scheduler
+	if schedulerEnabled {
+		jobScheduler.Start()
+	}
+
+	router := newRouter()
+
+	// Dokumen OpenAPI dibuat dari tabel routes, kelengkapannya dicek di openapi_test.go
+	openAPIDocument = buildOpenAPI(routes)
+
 	// Konfigurasi CORS dengan lebih banyak opsi
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"}, // Ganti dengan domain frontend Anda
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID", "Deprecation", "Link"},
 		AllowCredentials: true,
-		Debug:            true,
-	}).Handler(http.DefaultServeMux)
-
-	// Menambahkan route untuk event dengan metode HTTP yang berbeda
-	http.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			createEventHandler(w, r) // POST untuk membuat event
-		} else if r.Method == http.MethodGet {
-			getEventsHandler(w, r) // GET untuk mengambil semua event
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // Menghandle metode yang tidak diizinkan
-		}
-	})
-
-	// Route untuk menghapus event
-	http.HandleFunc("/events/delete", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodDelete {
-			deleteEventHandler(w, r) // DELETE untuk menghapus event
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // Menghandle metode yang tidak diizinkan
-		}
-	})
-
-	// Route untuk memperbarui event
-	http.HandleFunc("/events/update", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut {
-			updateEventHandler(w, r) // PUT untuk memperbarui event
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // Menghandle metode yang tidak diizinkan
-		}
-	})
+	}).Handler(withRequestID(withAccessLog(router)))
+
+	server := &http.Server{Addr: ":8080", Handler: corsHandler}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("server is running", "addr", "http://localhost:8080")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("server stopped", err)
+	case <-ctx.Done():
+		// Sinyal kedua langsung menghentikan proses
+		stop()
+	}
 
-	// Menambahkan route
-	http.HandleFunc("/register", registerHandler)
-	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/booking", bookingHandler)
-	http.HandleFunc("/occupied-seats", getOccupiedSeatsHandler)
-	http.HandleFunc("/users", getUsersHandler)
-	http.HandleFunc("/users/delete", deleteUserHandler)
-	http.HandleFunc("/logactivity", getLogActivityHandler)
-	http.HandleFunc("/logactivity/delete", deleteLogActivityHandler)
-	http.HandleFunc("/admin/users", verifyAdminRole(getUsersHandler))
-
-	http.HandleFunc("/contact", ContactHandler)
-	http.HandleFunc("/api/contact", getContactsHandlers)
-
-	fmt.Println("Server is running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", corsHandler))
+	// Graceful shutdown: /readyz gagal dulu selama SHUTDOWN_DRAIN_DELAY supaya
+	// load balancer berhenti mengirim traffic, baru request yang tersisa ditunggu
+	shuttingDown.Store(true)
+	drain := getEnvDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second)
+	slog.Info("shutting down", "drain_delay", drain.String())
+	time.Sleep(drain)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("graceful shutdown failed", "error", err)
+	}
+	if schedulerEnabled {
+		jobScheduler.Stop()
+	}
+	slog.Info("server stopped")
 }
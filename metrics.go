@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrik dalam format teks Prometheus, ditulis sendiri tanpa library
+// client supaya tidak menambah dependency. Hanya counter, gauge dan
+// histogram yang dibutuhkan aplikasi ini.
+
+var (
+	metricHTTPRequests = newCounterVec("sibakar_http_requests_total",
+		"HTTP requests per route, method and status code.", "route", "method", "status")
+	metricHTTPDuration = newHistogramVec("sibakar_http_request_duration_seconds",
+		"HTTP request latency per route and method.", defaultBuckets, "route", "method")
+	metricBookings = newCounterVec("sibakar_bookings_total",
+		"Booking attempts by outcome (created, conflict, rejected_time_policy, invalid, error).", "outcome")
+	metricLogins = newCounterVec("sibakar_logins_total",
+		"Login attempts by result (success, failure, locked, rate_limited).", "result")
+	metricRateLimited = newCounterVec("sibakar_rate_limited_total",
+		"Requests rejected by the login/register rate limiter per bucket.", "limit", "bucket")
+	metricJobRuns = newCounterVec("sibakar_job_runs_total",
+		"Scheduled job runs by job and status.", "job", "status")
+	metricJobDuration = newHistogramVec("sibakar_job_duration_seconds",
+		"Scheduled job run duration.", []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900}, "job")
+	metricJobLastSuccess = newGaugeVec("sibakar_job_last_success_timestamp_seconds",
+		"Unix time of the last successful run per job.", "job")
+	metricLegacyTokens = newCounterVec("sibakar_legacy_tokens_accepted_total",
+		"Access tokens from the old jwt-go code path accepted during the compatibility window.")
+)
+
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Pool database yang hidup sepanjang proses, didaftarkan di main. Handler
+// HTTP membuka pool sendiri per request lewat setupDatabase dan tidak ikut
+// terhitung di metrik pool.
+var (
+	metricPoolsMu sync.Mutex
+	metricPools   = map[string]*sql.DB{}
+)
+
+func registerDBPool(name string, db *sql.DB) {
+	metricPoolsMu.Lock()
+	defer metricPoolsMu.Unlock()
+	metricPools[name] = db
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+type counterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	series     map[string]*sample
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, series: map[string]*sample{}}
+}
+
+func (c *counterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *counterVec) Add(v float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := strings.Join(values, "\xff")
+	s, ok := c.series[key]
+	if !ok {
+		s = &sample{labels: values}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	for _, s := range sortedSamples(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, s.labels), formatFloat(s.value))
+	}
+}
+
+type gaugeVec struct {
+	counterVec
+}
+
+func newGaugeVec(name, help string, labels ...string) *gaugeVec {
+	return &gaugeVec{counterVec{name: name, help: help, labels: labels, series: map[string]*sample{}}}
+}
+
+func (g *gaugeVec) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[strings.Join(values, "\xff")] = &sample{labels: values, value: v}
+}
+
+func (g *gaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, s := range sortedSamples(g.series) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, s.labels), formatFloat(s.value))
+	}
+}
+
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, tidak kumulatif
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+}
+
+func (h *histogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := strings.Join(values, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		// Salin label supaya append untuk "le" tidak menimpa slice milik series
+		names := append(append([]string{}, h.labels...), "le")
+		values := append(append([]string{}, s.labels...), "")
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatFloat(upper)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labels), s.count)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sortedSamples(series map[string]*sample) []*sample {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]*sample, len(keys))
+	for i, key := range keys {
+		samples[i] = series[key]
+	}
+	return samples
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Mencatat jumlah request dan latency per route. Route diambil dari pattern
+// di tabel routes, bukan path asli, supaya jumlah series tetap kecil.
+func instrumentRoute(rt route, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metricHTTPRequests.Inc(rt.Path, rt.Method, strconv.Itoa(rec.status))
+		metricHTTPDuration.Observe(time.Since(start).Seconds(), rt.Path, rt.Method)
+	}
+}
+
+// Gauge yang dihitung saat scrape: statistik pool database dan kursi terisi
+func writeScrapeGauges(ctx context.Context, w io.Writer) {
+	metricPoolsMu.Lock()
+	names := make([]string, 0, len(metricPools))
+	for name := range metricPools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pools := make([]*sql.DB, len(names))
+	for i, name := range names {
+		pools[i] = metricPools[name]
+	}
+	jobsDB, hasJobsDB := metricPools["jobs"]
+	metricPoolsMu.Unlock()
+
+	poolGauges := []struct {
+		name, help, typ string
+		value           func(sql.DBStats) float64
+	}{
+		{"sibakar_db_open_connections", "Open connections per long-lived pool (request handlers are not included).", "gauge", func(s sql.DBStats) float64 { return float64(s.OpenConnections) }},
+		{"sibakar_db_in_use_connections", "Connections currently in use per long-lived pool.", "gauge", func(s sql.DBStats) float64 { return float64(s.InUse) }},
+		{"sibakar_db_idle_connections", "Idle connections per long-lived pool.", "gauge", func(s sql.DBStats) float64 { return float64(s.Idle) }},
+		{"sibakar_db_wait_count_total", "Total number of waits for a connection per long-lived pool.", "counter", func(s sql.DBStats) float64 { return float64(s.WaitCount) }},
+		{"sibakar_db_wait_duration_seconds_total", "Total time spent waiting for a connection per long-lived pool.", "counter", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }},
+	}
+	for _, g := range poolGauges {
+		writeHeader(w, g.name, g.help, g.typ)
+		for i, db := range pools {
+			fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels([]string{"pool"}, []string{names[i]}), formatFloat(g.value(db.Stats())))
+		}
+	}
+
+	if !hasJobsDB {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var occupied int
+	err := jobsDB.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT selected_seat) FROM logactivity
+		WHERE booked_for = CURDATE() AND status = 'occupied' AND cancelled_at IS NULL`).Scan(&occupied)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to count occupied seats for metrics", "error", err)
+		return
+	}
+	writeHeader(w, "sibakar_occupied_seats", "Seats occupied today.", "gauge")
+	fmt.Fprintf(w, "sibakar_occupied_seats %d\n", occupied)
+}
+
+type metricWriter interface {
+	write(w io.Writer)
+}
+
+var registeredMetrics = []metricWriter{
+	metricHTTPRequests,
+	metricHTTPDuration,
+	metricBookings,
+	metricLogins,
+	metricRateLimited,
+	metricJobRuns,
+	metricJobDuration,
+	metricJobLastSuccess,
+	metricLegacyTokens,
+}
+
+// Handler untuk GET /metrics. Jika METRICS_TOKEN diisi, scraper harus
+// mengirim header Authorization: Bearer <token>.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	token := getEnv("METRICS_TOKEN", "")
+	if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid metrics token")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range registeredMetrics {
+		m.write(w)
+	}
+	writeScrapeGauges(r.Context(), w)
+}
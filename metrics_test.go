@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsToken(t *testing.T) {
+	t.Setenv("METRICS_TOKEN", "rahasia")
+	for header, want := range map[string]int{
+		"":                   http.StatusUnauthorized,
+		"Bearer salah":       http.StatusUnauthorized,
+		"Bearer rahasia-nya": http.StatusUnauthorized,
+		"Bearer rahasia":     http.StatusOK,
+	} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		metricsHandler(rec, r)
+		if rec.Code != want {
+			t.Errorf("Authorization %q: status = %d, want %d", header, rec.Code, want)
+		}
+		if rec.Code == http.StatusOK && !strings.Contains(rec.Body.String(), "sibakar_http_requests_total") {
+			t.Errorf("metrics body is missing request counters")
+		}
+	}
+}
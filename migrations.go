@@ -0,0 +1,481 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// Migration berisi satu perubahan skema yang dijalankan sekali saja
+type Migration struct {
+	Version int
+	Name    string
+	SQL     []string
+}
+
+// Daftar migrasi, urut berdasarkan Version. Jangan ubah migrasi yang sudah dirilis,
+// tambahkan migrasi baru di akhir.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "contacts_spam_protection",
+		SQL: []string{
+			`ALTER TABLE contacts
+				ADD COLUMN spam_score INT NOT NULL DEFAULT 0,
+				ADD COLUMN flagged TINYINT(1) NOT NULL DEFAULT 0,
+				ADD COLUMN ip_address VARCHAR(45) NOT NULL DEFAULT '',
+				ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "logactivity_user",
+		SQL: []string{
+			// Pemilik booking; NULL untuk data lama sebelum booking terikat akun
+			"ALTER TABLE logactivity ADD COLUMN user_id INT NULL",
+			"CREATE INDEX idx_logactivity_user ON logactivity (user_id)",
+		},
+	},
+	{
+		Version: 3,
+		Name:    "list_filter_indexes",
+		SQL: []string{
+			"CREATE INDEX idx_logactivity_divisi ON logactivity (nama_divisi)",
+			"CREATE INDEX idx_logactivity_status ON logactivity (status)",
+			"CREATE INDEX idx_logactivity_created_at ON logactivity (created_at)",
+			"CREATE INDEX idx_users_role ON users (role)",
+			"CREATE INDEX idx_contacts_email ON contacts (email)",
+		},
+	},
+	{
+		Version: 4,
+		Name:    "seat_analytics",
+		SQL: []string{
+			`CREATE TABLE IF NOT EXISTS seats (
+				code VARCHAR(20) PRIMARY KEY,
+				zone VARCHAR(50) NOT NULL DEFAULT '',
+				floor VARCHAR(20) NOT NULL DEFAULT ''
+			)`,
+			`ALTER TABLE logactivity
+				ADD COLUMN booked_for DATE NULL,
+				ADD COLUMN checked_in_at TIMESTAMP NULL,
+				ADD COLUMN cancelled_at TIMESTAMP NULL`,
+			"UPDATE logactivity SET booked_for = DATE(created_at) WHERE booked_for IS NULL",
+			"CREATE INDEX idx_logactivity_booked_for ON logactivity (booked_for)",
+			`CREATE TABLE IF NOT EXISTS analytics_daily (
+				day DATE NOT NULL,
+				selected_seat VARCHAR(20) NOT NULL,
+				nama_divisi VARCHAR(100) NOT NULL,
+				bookings INT NOT NULL DEFAULT 0,
+				cancellations INT NOT NULL DEFAULT 0,
+				check_ins INT NOT NULL DEFAULT 0,
+				no_shows INT NOT NULL DEFAULT 0,
+				lead_seconds BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (day, selected_seat, nama_divisi)
+			)`,
+			`CREATE TABLE IF NOT EXISTS analytics_hourly (
+				day DATE NOT NULL,
+				hour TINYINT NOT NULL,
+				bookings INT NOT NULL DEFAULT 0,
+				PRIMARY KEY (day, hour)
+			)`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "logactivity_active_seat",
+		SQL: []string{
+			// Booking ganda dari sebelum index ini ada: yang lebih baru dibatalkan
+			// supaya unique index bisa dibuat
+			`UPDATE logactivity a
+				JOIN logactivity b ON b.selected_seat = a.selected_seat AND b.booked_for = a.booked_for AND b.id < a.id
+					AND b.status = 'occupied' AND b.cancelled_at IS NULL
+				SET a.status = 'available', a.cancelled_at = NOW()
+				WHERE a.status = 'occupied' AND a.cancelled_at IS NULL`,
+			// MySQL tidak punya partial index, jadi booking yang tidak aktif
+			// dibuat NULL dan tidak ikut dibandingkan oleh unique index
+			`ALTER TABLE logactivity
+				ADD COLUMN active_seat VARCHAR(20) AS (IF(status = 'occupied' AND cancelled_at IS NULL, selected_seat, NULL)) STORED`,
+			"CREATE UNIQUE INDEX uniq_logactivity_active_seat ON logactivity (active_seat, booked_for)",
+		},
+	},
+	{
+		Version: 6,
+		Name:    "user_import",
+		SQL: []string{
+			`ALTER TABLE users
+				ADD COLUMN division VARCHAR(100) NOT NULL DEFAULT '',
+				ADD COLUMN must_change_password TINYINT(1) NOT NULL DEFAULT 0`,
+			"CREATE INDEX idx_users_division ON users (division)",
+			`CREATE TABLE IF NOT EXISTS user_invitations (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_user_invitations_user (user_id)
+			)`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "logactivity_archive",
+		SQL: []string{
+			// Kolom harus sama dengan logactivity; migrasi yang menambah kolom
+			// di logactivity juga harus menambahkannya di sini
+			"CREATE TABLE IF NOT EXISTS logactivity_archive LIKE logactivity",
+			// Arsip boleh berisi booking ganda untuk kursi dan tanggal yang sama
+			`ALTER TABLE logactivity_archive
+				DROP INDEX uniq_logactivity_active_seat,
+				DROP COLUMN active_seat`,
+			`ALTER TABLE logactivity_archive
+				ADD COLUMN archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				ADD COLUMN archive_reason VARCHAR(20) NOT NULL DEFAULT 'retention'`,
+			`CREATE TABLE IF NOT EXISTS archive_runs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				target VARCHAR(10) NOT NULL,
+				location VARCHAR(255) NOT NULL DEFAULT '',
+				from_date DATE NULL,
+				to_date DATE NOT NULL,
+				row_count INT NOT NULL DEFAULT 0,
+				restored_rows INT NOT NULL DEFAULT 0,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			// Rentang hasil restore yang dilewati job retention sampai hold_until
+			`CREATE TABLE IF NOT EXISTS archive_holds (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				from_date DATE NOT NULL,
+				to_date DATE NOT NULL,
+				hold_until DATETIME NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_archive_holds_until (hold_until)
+			)`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "job_runs",
+		SQL: []string{
+			`CREATE TABLE IF NOT EXISTS job_runs (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				job_name VARCHAR(50) NOT NULL,
+				trigger_type VARCHAR(10) NOT NULL,
+				scheduled_for DATETIME NULL,
+				started_at DATETIME NOT NULL,
+				finished_at DATETIME NULL,
+				status VARCHAR(10) NOT NULL,
+				duration_ms BIGINT NOT NULL DEFAULT 0,
+				error TEXT NULL,
+				instance VARCHAR(100) NOT NULL DEFAULT '',
+				INDEX idx_job_runs_job (job_name, id)
+			)`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "notifications",
+		SQL: []string{
+			`CREATE TABLE IF NOT EXISTS notification_settings (
+				user_id INT PRIMARY KEY,
+				language CHAR(2) NOT NULL DEFAULT 'id',
+				email VARCHAR(254) NOT NULL DEFAULT '',
+				webhook_url VARCHAR(500) NOT NULL DEFAULT '',
+				email_verified_at DATETIME NULL,
+				email_token_hash CHAR(64) NULL,
+				email_token_expires_at DATETIME NULL,
+				email_token_sent_at DATETIME NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS notification_preferences (
+				user_id INT NOT NULL,
+				type VARCHAR(30) NOT NULL,
+				channel VARCHAR(10) NOT NULL,
+				enabled TINYINT(1) NOT NULL,
+				PRIMARY KEY (user_id, type, channel)
+			)`,
+			`CREATE TABLE IF NOT EXISTS notification_outbox (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				type VARCHAR(30) NOT NULL,
+				channel VARCHAR(10) NOT NULL,
+				data TEXT NOT NULL,
+				status VARCHAR(10) NOT NULL DEFAULT 'pending',
+				attempts INT NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				last_error TEXT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				sent_at TIMESTAMP NULL,
+				INDEX idx_outbox_pending (status, next_attempt_at)
+			)`,
+			`CREATE TABLE IF NOT EXISTS notifications (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				type VARCHAR(30) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				body TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				read_at TIMESTAMP NULL,
+				INDEX idx_notifications_user (user_id, id)
+			)`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "webhooks",
+		SQL: []string{
+			`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				url VARCHAR(500) NOT NULL,
+				secret VARCHAR(64) NOT NULL,
+				event_types VARCHAR(500) NOT NULL,
+				description VARCHAR(255) NOT NULL DEFAULT '',
+				active TINYINT(1) NOT NULL DEFAULT 1,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				subscription_id INT NOT NULL,
+				event_type VARCHAR(50) NOT NULL,
+				event_id VARCHAR(32) NOT NULL,
+				payload MEDIUMTEXT NOT NULL,
+				status VARCHAR(10) NOT NULL DEFAULT 'pending',
+				attempts INT NOT NULL DEFAULT 0,
+				next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				response_code INT NULL,
+				response_body TEXT NULL,
+				last_error TEXT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				delivered_at TIMESTAMP NULL,
+				INDEX idx_webhook_deliveries_pending (status, next_attempt_at),
+				INDEX idx_webhook_deliveries_subscription (subscription_id, id)
+			)`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "auth_guard",
+		SQL: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				event VARCHAR(50) NOT NULL,
+				username VARCHAR(191) NULL,
+				actor VARCHAR(191) NULL,
+				ip_address VARCHAR(45) NOT NULL,
+				detail VARCHAR(500) NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_audit_log_event (event, id),
+				INDEX idx_audit_log_username (username, id)
+			)`,
+			// Dipakai jika RATE_LIMIT_STORE=database, waktu dalam Unix milidetik
+			`CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+				bucket_key VARCHAR(191) PRIMARY KEY,
+				tokens DOUBLE NOT NULL,
+				updated_at BIGINT NOT NULL,
+				INDEX idx_rate_limit_buckets_updated (updated_at)
+			)`,
+			`CREATE TABLE IF NOT EXISTS login_failures (
+				username VARCHAR(191) PRIMARY KEY,
+				failures INT NOT NULL DEFAULT 0,
+				last_failure_at BIGINT NOT NULL DEFAULT 0,
+				locked_until BIGINT NOT NULL DEFAULT 0
+			)`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "registration_modes",
+		SQL: []string{
+			// Akun yang sudah ada tetap aktif
+			`ALTER TABLE users ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active'`,
+			"CREATE INDEX idx_users_status ON users (status)",
+			`CREATE TABLE IF NOT EXISTS app_settings (
+				name VARCHAR(100) PRIMARY KEY,
+				value VARCHAR(255) NOT NULL,
+				updated_by VARCHAR(191) NOT NULL DEFAULT '',
+				updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS registration_invites (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				code_hash CHAR(64) NOT NULL UNIQUE,
+				role VARCHAR(20) NOT NULL,
+				division VARCHAR(100) NOT NULL DEFAULT '',
+				note VARCHAR(255) NOT NULL DEFAULT '',
+				created_by VARCHAR(191) NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				used_at TIMESTAMP NULL,
+				used_by INT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "password_history",
+		SQL: []string{
+			// Hash argon2id lebih panjang dari hash bcrypt (60 karakter)
+			"ALTER TABLE users MODIFY password VARCHAR(255) NOT NULL",
+			`CREATE TABLE IF NOT EXISTS password_history (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				password_hash VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_password_history_user (user_id, id)
+			)`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "two_factor",
+		SQL: []string{
+			`ALTER TABLE users
+				ADD COLUMN totp_secret VARCHAR(64) NULL,
+				ADD COLUMN totp_pending_secret VARCHAR(64) NULL,
+				ADD COLUMN totp_enabled TINYINT(1) NOT NULL DEFAULT 0,
+				ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0`,
+			`CREATE TABLE IF NOT EXISTS recovery_codes (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				code_hash CHAR(64) NOT NULL,
+				used_at TIMESTAMP NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY uniq_recovery_codes_user_hash (user_id, code_hash)
+			)`,
+			`CREATE TABLE IF NOT EXISTS login_challenges (
+				token_hash CHAR(64) PRIMARY KEY,
+				user_id INT NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				expires_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_login_challenges_expires (expires_at)
+			)`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "jwt_keys",
+		SQL: []string{
+			// Waktu dalam Unix milidetik, sama seperti tabel rate limit
+			`CREATE TABLE IF NOT EXISTS jwt_keys (
+				kid VARCHAR(64) PRIMARY KEY,
+				algorithm VARCHAR(10) NOT NULL,
+				private_key TEXT NOT NULL,
+				not_before BIGINT NOT NULL,
+				retires_at BIGINT NOT NULL,
+				expires_at BIGINT NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "api_tokens",
+		SQL: []string{
+			`ALTER TABLE users ADD COLUMN account_type VARCHAR(20) NOT NULL DEFAULT 'user'`,
+			`CREATE TABLE IF NOT EXISTS api_tokens (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				user_id INT NOT NULL,
+				name VARCHAR(100) NOT NULL,
+				token_prefix VARCHAR(16) NOT NULL,
+				token_hash CHAR(64) NOT NULL UNIQUE,
+				scopes VARCHAR(1000) NOT NULL,
+				mfa TINYINT(1) NOT NULL DEFAULT 0,
+				created_by VARCHAR(191) NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				last_used_at TIMESTAMP NULL,
+				revoked_at TIMESTAMP NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_api_tokens_user (user_id)
+			)`,
+		},
+	},
+	{
+		Version: 17,
+		Name:    "oidc",
+		SQL: []string{
+			// issuer|sub dari IdP, NULL untuk akun lokal
+			`ALTER TABLE users ADD COLUMN oidc_subject VARCHAR(255) NULL UNIQUE`,
+			`CREATE TABLE IF NOT EXISTS oidc_logins (
+				state_hash CHAR(64) PRIMARY KEY,
+				code_verifier VARCHAR(128) NOT NULL,
+				nonce VARCHAR(64) NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_oidc_logins_expires (expires_at)
+			)`,
+		},
+	},
+	{
+		Version: 18,
+		Name:    "ldap_users",
+		SQL: []string{
+			// DN di direktori untuk akun yang login lewat LDAP, NULL untuk akun lokal
+			`ALTER TABLE users ADD COLUMN ldap_dn VARCHAR(500) NULL`,
+		},
+	},
+	{
+		Version: 19,
+		Name:    "user_sessions",
+		SQL: []string{
+			// Token yang terbit sebelum waktu ini ditolak ("log out everywhere")
+			`ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMP NULL`,
+			`CREATE TABLE IF NOT EXISTS user_sessions (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				sid VARCHAR(43) CHARACTER SET ascii COLLATE ascii_bin NOT NULL UNIQUE,
+				user_id INT NOT NULL,
+				device VARCHAR(100) NOT NULL,
+				ip VARCHAR(45) NOT NULL,
+				user_agent VARCHAR(255) NOT NULL,
+				last_seen_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL,
+				revoked_at TIMESTAMP NULL,
+				revoked_by VARCHAR(191) NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_user_sessions_user (user_id),
+				INDEX idx_user_sessions_expires (expires_at)
+			)`,
+		},
+	},
+}
+
+// Menjalankan semua migrasi yang belum tercatat di tabel schema_migrations
+func runMigrations(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return fmt.Errorf("failed to scan migration version: %v", err)
+		}
+		applied[version] = true
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		for _, stmt := range m.SQL {
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return fmt.Errorf("failed to record migration %d: %v", m.Version, err)
+		}
+		slog.Info("applied migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
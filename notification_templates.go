@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// Jenis notifikasi yang bisa diatur pengguna di preferensi
+const (
+	notifyBookingConfirmed = "booking_confirmed"
+	notifyBookingCancelled = "booking_cancelled"
+	notifyBookingReminder  = "booking_reminder"
+	notifyEventChanged     = "event_changed"
+	notifyEventCancelled   = "event_cancelled"
+)
+
+// Link verifikasi alamat email, tidak bisa diatur di preferensi
+const notifyEmailVerification = "email_verification"
+
+var notificationTypes = []string{
+	notifyBookingConfirmed,
+	notifyBookingCancelled,
+	notifyBookingReminder,
+	notifyEventChanged,
+	notifyEventCancelled,
+}
+
+var notificationLanguages = []string{"id", "en"}
+
+type messageTemplate struct {
+	Subject string
+	Body    string
+}
+
+// Template pesan per bahasa. Data yang tersedia: name, seat, date,
+// booking_id, event_name, event_time, dan link serta expires_at untuk
+// verifikasi email.
+var messageTemplates = map[string]map[string]messageTemplate{
+	"id": {
+		notifyBookingConfirmed: {
+			Subject: "Booking kursi {{.seat}} untuk {{.date}} berhasil",
+			Body:    "Halo {{.name}},\n\nKursi {{.seat}} sudah dipesan untuk tanggal {{.date}} (booking #{{.booking_id}}). Jangan lupa check-in saat tiba di kantor.",
+		},
+		notifyBookingCancelled: {
+			Subject: "Booking kursi {{.seat}} untuk {{.date}} dibatalkan",
+			Body:    "Halo {{.name}},\n\nBooking #{{.booking_id}} untuk kursi {{.seat}} pada {{.date}} telah dibatalkan dan kursi kembali tersedia.",
+		},
+		notifyBookingReminder: {
+			Subject: "Pengingat: check-in kursi {{.seat}} hari ini",
+			Body:    "Halo {{.name}},\n\nAnda memesan kursi {{.seat}} untuk hari ini ({{.date}}) tetapi belum check-in. Kursi yang tidak di-check-in akan dilepas secara otomatis.",
+		},
+		notifyEventChanged: {
+			Subject: "Perubahan event: {{.event_name}}",
+			Body:    "Event {{.event_name}} telah diperbarui. Waktu: {{.event_time}}.",
+		},
+		notifyEventCancelled: {
+			Subject: "Event dibatalkan: {{.event_name}}",
+			Body:    "Event {{.event_name}} ({{.event_time}}) telah dibatalkan.",
+		},
+		notifyEmailVerification: {
+			Subject: "Verifikasi alamat email notifikasi",
+			Body:    "Halo {{.name}},\n\nBuka link berikut untuk mulai menerima notifikasi di alamat ini: {{.link}}\n\nLink berlaku sampai {{.expires_at}}. Abaikan email ini jika Anda tidak memintanya.",
+		},
+	},
+	"en": {
+		notifyBookingConfirmed: {
+			Subject: "Seat {{.seat}} booked for {{.date}}",
+			Body:    "Hello {{.name}},\n\nSeat {{.seat}} is booked for {{.date}} (booking #{{.booking_id}}). Remember to check in when you arrive at the office.",
+		},
+		notifyBookingCancelled: {
+			Subject: "Booking for seat {{.seat}} on {{.date}} cancelled",
+			Body:    "Hello {{.name}},\n\nBooking #{{.booking_id}} for seat {{.seat}} on {{.date}} has been cancelled and the seat is available again.",
+		},
+		notifyBookingReminder: {
+			Subject: "Reminder: check in to seat {{.seat}} today",
+			Body:    "Hello {{.name}},\n\nYou booked seat {{.seat}} for today ({{.date}}) but have not checked in yet. Seats without a check-in are released automatically.",
+		},
+		notifyEventChanged: {
+			Subject: "Event updated: {{.event_name}}",
+			Body:    "The event {{.event_name}} has been updated. Time: {{.event_time}}.",
+		},
+		notifyEventCancelled: {
+			Subject: "Event cancelled: {{.event_name}}",
+			Body:    "The event {{.event_name}} ({{.event_time}}) has been cancelled.",
+		},
+		notifyEmailVerification: {
+			Subject: "Verify your notification email address",
+			Body:    "Hello {{.name}},\n\nOpen this link to start receiving notifications at this address: {{.link}}\n\nThe link is valid until {{.expires_at}}. Ignore this email if you did not request it.",
+		},
+	},
+}
+
+// Template di-parse sekali saat start, template yang salah langsung panic
+var parsedTemplates = parseMessageTemplates()
+
+func parseMessageTemplates() map[string]map[string][2]*template.Template {
+	parsed := make(map[string]map[string][2]*template.Template)
+	for lang, byType := range messageTemplates {
+		parsed[lang] = make(map[string][2]*template.Template)
+		for typ, tmpl := range byType {
+			name := lang + "/" + typ
+			parsed[lang][typ] = [2]*template.Template{
+				template.Must(template.New(name + "/subject").Option("missingkey=zero").Parse(tmpl.Subject)),
+				template.Must(template.New(name + "/body").Option("missingkey=zero").Parse(tmpl.Body)),
+			}
+		}
+	}
+	return parsed
+}
+
+// Membuat subject dan isi pesan, bahasa yang tidak dikenal memakai bahasa Indonesia
+func renderMessage(lang, typ string, data map[string]string) (Message, error) {
+	byType, ok := parsedTemplates[lang]
+	if !ok {
+		byType = parsedTemplates["id"]
+	}
+	tmpl, ok := byType[typ]
+	if !ok {
+		return Message{}, fmt.Errorf("no template for notification type %q", typ)
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl[0].Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl[1].Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Type: typ, Subject: subject.String(), Body: body.String(), Data: data}, nil
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notifikasi tidak dikirim langsung dari handler. Handler hanya menulis ke
+// tabel notification_outbox, lalu job "notifications" mengirimnya lewat
+// Notifier yang sesuai dan mencoba lagi jika gagal. Dengan begitu pesan
+// tidak hilang walaupun server restart atau server SMTP sedang down.
+
+const (
+	outboxPending = "pending"
+	outboxSent    = "sent"
+	outboxFailed  = "failed"
+)
+
+var (
+	notifyMaxAttempts = getEnvInt("NOTIFY_MAX_ATTEMPTS", 6)
+
+	// Alamat email baru harus diverifikasi lewat link sebelum dipakai
+	emailVerifyBaseURL  = getEnv("EMAIL_VERIFY_BASE_URL", "http://localhost:5173/verify-email")
+	emailVerifyTTL      = getEnvDuration("EMAIL_VERIFY_TTL", 24*time.Hour)
+	emailVerifyCooldown = time.Minute
+)
+
+// Notifikasi untuk semua pengguna ditulis sebagai satu baris outbox dengan
+// channel ini, lalu dipecah per pengguna oleh job pengirim
+const channelBroadcast = "broadcast"
+
+// Dipenuhi *sql.DB dan *sql.Tx
+type notifyStore interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// InboxNotification adalah notifikasi in-app milik pengguna
+type InboxNotification struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+	ReadAt    string `json:"read_at,omitempty"`
+}
+
+// NotificationSettings berisi bahasa, alamat tujuan dan preferensi per jenis
+// notifikasi. EmailVerified hanya dibaca, diisi lewat link verifikasi.
+type NotificationSettings struct {
+	Language      string                   `json:"language" validate:"required,oneof=id en"`
+	Email         string                   `json:"email" validate:"email,max=254"`
+	EmailVerified bool                     `json:"email_verified"`
+	WebhookURL    string                   `json:"webhook_url" validate:"https,max=500"`
+	Preferences   []NotificationPreference `json:"preferences"`
+}
+
+// Payload POST /me/notification-preferences/verify-email
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type NotificationPreference struct {
+	Type    string `json:"type" validate:"required,oneof=booking_confirmed booking_cancelled booking_reminder event_changed event_cancelled"`
+	Channel string `json:"channel" validate:"required,oneof=inbox email webhook"`
+	Enabled bool   `json:"enabled"`
+}
+
+func loadRecipient(db notifyStore, userID int) (Recipient, error) {
+	var to Recipient
+	err := db.QueryRow(`
+		SELECT u.id, u.username, u.fullname, COALESCE(s.language, 'id'), COALESCE(s.email, ''),
+			s.email_verified_at IS NOT NULL, COALESCE(s.webhook_url, '')
+		FROM users u
+		LEFT JOIN notification_settings s ON s.user_id = u.id
+		WHERE u.id = ?`, userID).
+		Scan(&to.UserID, &to.Username, &to.Fullname, &to.Language, &to.Email, &to.EmailVerified, &to.WebhookURL)
+	return to, err
+}
+
+// Preferensi lengkap (semua jenis x semua channel). Tanpa baris di
+// notification_preferences, semua channel aktif.
+func loadPreferences(db notifyStore, userID int) ([]NotificationPreference, error) {
+	rows, err := db.Query("SELECT type, channel, enabled FROM notification_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	saved := make(map[string]bool)
+	for rows.Next() {
+		var typ, channel string
+		var enabled bool
+		if err := rows.Scan(&typ, &channel, &enabled); err != nil {
+			return nil, err
+		}
+		saved[typ+"/"+channel] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	prefs := make([]NotificationPreference, 0, len(notificationTypes)*len(notificationChannels))
+	for _, typ := range notificationTypes {
+		for _, channel := range notificationChannels {
+			enabled, ok := saved[typ+"/"+channel]
+			if !ok {
+				enabled = true
+			}
+			prefs = append(prefs, NotificationPreference{Type: typ, Channel: channel, Enabled: enabled})
+		}
+	}
+	return prefs, nil
+}
+
+// Memasukkan notifikasi ke outbox untuk setiap channel yang aktif bagi pengguna
+func enqueueNotification(db notifyStore, userID int, typ string, data map[string]string) error {
+	to, err := loadRecipient(db, userID)
+	if err != nil {
+		return err
+	}
+	prefs, err := loadPreferences(db, userID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	emailEnabled := loadSMTPConfig().Host != "" && to.Email != "" && to.EmailVerified
+	for _, pref := range prefs {
+		if pref.Type != typ || !pref.Enabled {
+			continue
+		}
+		if (pref.Channel == channelEmail && !emailEnabled) || (pref.Channel == channelWebhook && to.WebhookURL == "") {
+			continue
+		}
+		_, err := db.Exec("INSERT INTO notification_outbox (user_id, type, channel, data) VALUES (?, ?, ?, ?)",
+			userID, typ, pref.Channel, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Penerima notifikasi booking adalah akun yang membuat booking
+// (logactivity.user_id). Booking lama yang dibuat sebelum kolom itu ada
+// tidak mendapat notifikasi.
+func notifyBookingOwner(db *sql.DB, userID sql.NullInt64, fullname, typ string, data map[string]string) error {
+	if !userID.Valid {
+		return nil
+	}
+	data["name"] = fullname
+	return enqueueNotification(db, int(userID.Int64), typ, data)
+}
+
+// Notifikasi untuk semua pengguna, misalnya perubahan event. Handler hanya
+// menulis satu baris, pemecahan per pengguna dilakukan job pengirim.
+func notifyAllUsers(db *sql.DB, typ string, data map[string]string) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO notification_outbox (user_id, type, channel, data) VALUES (0, ?, ?, ?)",
+		typ, channelBroadcast, string(payload))
+	return err
+}
+
+// Memecah broadcast menjadi notifikasi per pengguna aktif (bukan service
+// account atau akun yang menunggu persetujuan). Semua baris ditulis dalam
+// satu transaksi, jadi retry tidak membuat notifikasi ganda.
+func fanOutBroadcast(ctx context.Context, db *sql.DB, item outboxItem) error {
+	var data map[string]string
+	if err := json.Unmarshal([]byte(item.Data), &data); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM users WHERE account_type = 'user' AND status = 'active'")
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := enqueueNotification(tx, id, item.Type, data); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE notification_outbox SET status = ?, attempts = attempts + 1, sent_at = NOW(), last_error = NULL WHERE id = ?",
+		outboxSent, item.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Kegagalan notifikasi tidak boleh menggagalkan request utama, cukup dicatat
+func logNotifyError(r *http.Request, err error) {
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to queue notification", "error", err)
+	}
+}
+
+type outboxItem struct {
+	ID       int64
+	UserID   int
+	Type     string
+	Channel  string
+	Data     string
+	Attempts int
+}
+
+// Job pengirim outbox. Pesan yang gagal dicoba lagi dengan jeda 1, 2, 4, ...
+// menit (maksimal 1 jam) sampai NOTIFY_MAX_ATTEMPTS.
+func deliverNotifications(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, type, channel, data, attempts FROM notification_outbox
+		WHERE status = ? AND next_attempt_at <= NOW()
+		ORDER BY id
+		LIMIT 200`, outboxPending)
+	if err != nil {
+		return err
+	}
+	var items []outboxItem
+	for rows.Next() {
+		var item outboxItem
+		if err := rows.Scan(&item.ID, &item.UserID, &item.Type, &item.Channel, &item.Data, &item.Attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+
+	notifiers := configuredNotifiers(db)
+	failed := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var sendErr error
+		if item.Channel == channelBroadcast {
+			// Baris broadcast ditandai terkirim di dalam transaksi fan-out
+			sendErr = fanOutBroadcast(ctx, db, item)
+		} else if sendErr = sendOutboxItem(ctx, db, notifiers, item); sendErr == nil {
+			_, err = db.ExecContext(ctx, "UPDATE notification_outbox SET status = ?, attempts = attempts + 1, sent_at = NOW(), last_error = NULL WHERE id = ?",
+				outboxSent, item.ID)
+		}
+		if sendErr != nil {
+			failed++
+			err = markOutboxFailure(ctx, db, item, sendErr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notifications failed, will retry", failed, len(items))
+	}
+	return nil
+}
+
+// Menjadwalkan retry, atau menandai gagal setelah NOTIFY_MAX_ATTEMPTS
+func markOutboxFailure(ctx context.Context, db *sql.DB, item outboxItem, sendErr error) error {
+	attempts := item.Attempts + 1
+	status := outboxPending
+	if attempts >= notifyMaxAttempts {
+		status = outboxFailed
+	}
+	backoff := retryBackoff(item.Attempts, time.Minute, time.Hour)
+	_, err := db.ExecContext(ctx, `
+		UPDATE notification_outbox
+		SET status = ?, attempts = ?, last_error = ?, next_attempt_at = NOW() + INTERVAL ? SECOND
+		WHERE id = ?`, status, attempts, sendErr.Error(), int(backoff.Seconds()), item.ID)
+	return err
+}
+
+// Jeda retry eksponensial: base, 2*base, 4*base, ... dibatasi max
+func retryBackoff(attempts int, base, max time.Duration) time.Duration {
+	if attempts > 30 {
+		return max
+	}
+	backoff := base << uint(attempts)
+	if backoff > max || backoff <= 0 {
+		return max
+	}
+	return backoff
+}
+
+func sendOutboxItem(ctx context.Context, db *sql.DB, notifiers map[string]Notifier, item outboxItem) error {
+	notifier, ok := notifiers[item.Channel]
+	if !ok {
+		return fmt.Errorf("channel %s is not configured", item.Channel)
+	}
+	to, err := loadRecipient(db, item.UserID)
+	if err != nil {
+		return err
+	}
+	// Alamat bisa diganti setelah pesan masuk outbox
+	if item.Channel == channelEmail && item.Type != notifyEmailVerification && !to.EmailVerified {
+		return fmt.Errorf("email address of user %d is not verified", item.UserID)
+	}
+	var data map[string]string
+	if err := json.Unmarshal([]byte(item.Data), &data); err != nil {
+		return err
+	}
+	msg, err := renderMessage(to.Language, item.Type, data)
+	if err != nil {
+		return err
+	}
+	return notifier.Send(ctx, to, msg)
+}
+
+func currentUserID(db *sql.DB, r *http.Request) (int, error) {
+	var id int
+	err := db.QueryRow("SELECT id FROM users WHERE username = ?", currentUsername(r)).Scan(&id)
+	return id, err
+}
+
+var notificationListSpec = listSpec{
+	Table:       "notifications",
+	Sortable:    map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "id",
+	// Hanya notifikasi milik pengguna yang login. Filter: ?unread=true
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		p.Filter("user_id = (SELECT id FROM users WHERE username = ?)", currentUsername(r))
+		switch r.URL.Query().Get("unread") {
+		case "":
+		case "true":
+			p.Filter("read_at IS NULL")
+		case "false":
+			p.Filter("read_at IS NOT NULL")
+		default:
+			errs["unread"] = "must be true or false"
+		}
+	},
+}
+
+// Handler untuk GET /me/notifications, notifikasi terbaru lebih dulu
+func getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePageRequest(r, notificationListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if r.URL.Query().Get("sort") == "" {
+		page.Desc = true
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := page.Query(db, "id, type, subject, body, CAST(created_at AS CHAR), COALESCE(CAST(read_at AS CHAR), '')", func() (interface{}, []interface{}) {
+		n := &InboxNotification{}
+		return n, []interface{}{&n.ID, &n.Type, &n.Subject, &n.Body, &n.CreatedAt, &n.ReadAt}
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writePage(w, r, result)
+}
+
+// Handler untuk POST /me/notifications/{id}/read
+func markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec(`
+		UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+		WHERE id = ? AND user_id = (SELECT id FROM users WHERE username = ?)`, r.PathValue("id"), currentUsername(r))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// Bisa juga karena sudah dibaca sebelumnya, cek keberadaannya
+		var exists int
+		err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE id = ? AND user_id = (SELECT id FROM users WHERE username = ?)",
+			r.PathValue("id"), currentUsername(r)).Scan(&exists)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if exists == 0 {
+			writeError(w, r, http.StatusNotFound, codeNotFound, "Notification not found")
+			return
+		}
+	}
+
+	writeMessage(w, http.StatusOK, "Notification marked as read")
+}
+
+// Handler untuk GET /me/notification-preferences
+func getNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	userID, err := currentUserID(db, r)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "User no longer exists")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	settings, err := loadNotificationSettings(db, userID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func loadNotificationSettings(db *sql.DB, userID int) (NotificationSettings, error) {
+	to, err := loadRecipient(db, userID)
+	if err != nil {
+		return NotificationSettings{}, err
+	}
+	prefs, err := loadPreferences(db, userID)
+	if err != nil {
+		return NotificationSettings{}, err
+	}
+	return NotificationSettings{Language: to.Language, Email: to.Email, EmailVerified: to.EmailVerified, WebhookURL: to.WebhookURL, Preferences: prefs}, nil
+}
+
+// Handler untuk PUT /me/notification-preferences. Preferensi yang tidak
+// dikirim tidak berubah.
+func putNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings NotificationSettings
+	if !decodeJSON(w, r, &settings) {
+		return
+	}
+	errs := validateStruct(settings)
+	for i, pref := range settings.Preferences {
+		for field, msg := range validateStruct(pref) {
+			errs[fmt.Sprintf("preferences[%d].%s", i, field)] = msg
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	userID, err := currentUserID(db, r)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "User no longer exists")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	current, err := loadRecipient(db, userID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	emailChanged := !strings.EqualFold(settings.Email, current.Email)
+	if emailChanged && settings.Email != "" {
+		var recent bool
+		err := db.QueryRow("SELECT COUNT(*) > 0 FROM notification_settings WHERE user_id = ? AND email_token_sent_at > ?",
+			userID, time.Now().Add(-emailVerifyCooldown).Format(jobTimeLayout)).Scan(&recent)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if recent {
+			writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "A verification email was just sent, please wait a minute before changing the address again")
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO notification_settings (user_id, language, email, webhook_url) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE language = VALUES(language), email = VALUES(email), webhook_url = VALUES(webhook_url)`,
+		userID, settings.Language, settings.Email, settings.WebhookURL)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if emailChanged {
+		if err := startEmailVerification(tx, current, settings.Email); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+	for _, pref := range settings.Preferences {
+		_, err = tx.Exec(`
+			INSERT INTO notification_preferences (user_id, type, channel, enabled) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)`,
+			userID, pref.Type, pref.Channel, pref.Enabled)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	updated, err := loadNotificationSettings(db, userID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// Alamat email baru belum terverifikasi. Link verifikasi dikirim ke alamat
+// itu lewat outbox; notifikasi lain baru dikirim setelah link dibuka.
+func startEmailVerification(tx *sql.Tx, to Recipient, email string) error {
+	if email == "" || loadSMTPConfig().Host == "" {
+		_, err := tx.Exec(`
+			UPDATE notification_settings
+			SET email_verified_at = NULL, email_token_hash = NULL, email_token_expires_at = NULL
+			WHERE user_id = ?`, to.UserID)
+		return err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(emailVerifyTTL)
+	_, err = tx.Exec(`
+		UPDATE notification_settings
+		SET email_verified_at = NULL, email_token_hash = ?, email_token_expires_at = ?, email_token_sent_at = NOW()
+		WHERE user_id = ?`, sha256Hex(token), expiresAt.Format(jobTimeLayout), to.UserID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]string{
+		"name":       to.Fullname,
+		"link":       emailVerifyBaseURL + "?token=" + token,
+		"expires_at": expiresAt.Format("2006-01-02 15:04"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO notification_outbox (user_id, type, channel, data) VALUES (?, ?, ?, ?)",
+		to.UserID, notifyEmailVerification, channelEmail, string(payload))
+	return err
+}
+
+// Handler untuk POST /me/notification-preferences/verify-email
+func verifyNotificationEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec(`
+		UPDATE notification_settings
+		SET email_verified_at = NOW(), email_token_hash = NULL, email_token_expires_at = NULL
+		WHERE user_id = (SELECT id FROM users WHERE username = ?) AND email_token_hash = ? AND email_token_expires_at > NOW()`,
+		currentUsername(r), sha256Hex(req.Token))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Verification link is invalid or has expired")
+		return
+	}
+
+	writeMessage(w, http.StatusOK, "Email address verified")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestNotifyAllUsersWritesOneBroadcast(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectExec(`INSERT INTO notification_outbox \(user_id, type, channel, data\) VALUES \(0, \?, \?, \?\)`).
+		WithArgs(notifyEventChanged, channelBroadcast, `{"event_name":"Rapat"}`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	db := setupDatabase()
+	defer db.Close()
+	if err := notifyAllUsers(db, notifyEventChanged, map[string]string{"event_name": "Rapat"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBroadcastFanOutToActiveUsers(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT id, user_id, type, channel, data, attempts FROM notification_outbox").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "type", "channel", "data", "attempts"}).
+			AddRow(9, 0, notifyEventCancelled, channelBroadcast, `{"event_name":"Rapat"}`, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id FROM users WHERE account_type = 'user' AND status = 'active'`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(4))
+	for _, id := range []int{3, 4} {
+		mock.ExpectQuery("SELECT u.id, u.username").WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "fullname", "language", "email", "email_verified", "webhook_url"}).
+				AddRow(id, "budi", "Budi", "id", "", false, ""))
+		mock.ExpectQuery("SELECT type, channel, enabled FROM notification_preferences").WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"type", "channel", "enabled"}))
+		// Hanya inbox: email belum diatur dan webhook kosong
+		mock.ExpectExec("INSERT INTO notification_outbox").WithArgs(id, notifyEventCancelled, channelInbox, `{"event_name":"Rapat"}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectExec("UPDATE notification_outbox SET status").WithArgs(outboxSent, 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	db := setupDatabase()
+	defer db.Close()
+	if err := deliverNotifications(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var recipientColumns = []string{"id", "username", "fullname", "language", "email", "email_verified", "webhook_url"}
+
+func TestUnverifiedEmailGetsNoNotifications(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT u.id, u.username").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(recipientColumns).AddRow(5, "budi", "Budi", "id", "korban@example.com", false, ""))
+	mock.ExpectQuery("SELECT type, channel, enabled FROM notification_preferences").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "channel", "enabled"}))
+	mock.ExpectExec("INSERT INTO notification_outbox").WithArgs(5, notifyBookingConfirmed, channelInbox, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	db := setupDatabase()
+	defer db.Close()
+	if err := enqueueNotification(db, 5, notifyBookingConfirmed, map[string]string{"seat": "A1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangingEmailSendsVerificationLink(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT id FROM users WHERE username").WithArgs("budi").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery("SELECT u.id, u.username").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(recipientColumns).AddRow(5, "budi", "Budi", "id", "lama@example.com", true, ""))
+	mock.ExpectQuery("SELECT COUNT").WithArgs(5, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"recent"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO notification_settings").WithArgs(5, "id", "baru@example.com", "").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	tokenHash := &captureArg{}
+	mock.ExpectExec("UPDATE notification_settings\\s+SET email_verified_at = NULL, email_token_hash = \\?").
+		WithArgs(tokenHash, sqlmock.AnyArg(), 5).WillReturnResult(sqlmock.NewResult(0, 1))
+	link := &captureArg{}
+	mock.ExpectExec("INSERT INTO notification_outbox").WithArgs(5, notifyEmailVerification, channelEmail, link).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT u.id, u.username").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(recipientColumns).AddRow(5, "budi", "Budi", "id", "baru@example.com", false, ""))
+	mock.ExpectQuery("SELECT type, channel, enabled FROM notification_preferences").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"type", "channel", "enabled"}))
+
+	r := httptest.NewRequest("PUT", "/me/notification-preferences", strings.NewReader(`{"language":"id","email":"baru@example.com"}`))
+	rec := httptest.NewRecorder()
+	putNotificationSettingsHandler(rec, withClaims(r, &AccessClaims{Username: "budi"}))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"email_verified":false`) {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	// Token di link cocok dengan hash yang disimpan
+	token := link.value[strings.Index(link.value, "?token=")+len("?token=") : strings.Index(link.value, `","name"`)]
+	if sha256Hex(token) != tokenHash.value {
+		t.Fatalf("link %s does not match the stored token hash", link.value)
+	}
+}
+
+func TestVerifyEmailRejectsUnknownToken(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectExec("UPDATE notification_settings\\s+SET email_verified_at = NOW\\(\\)").
+		WithArgs("budi", sha256Hex("salah")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	r := httptest.NewRequest("POST", "/me/notification-preferences/verify-email", strings.NewReader(`{"token":"salah"}`))
+	rec := httptest.NewRecorder()
+	verifyNotificationEmailHandler(rec, withClaims(r, &AccessClaims{Username: "budi"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	channelInbox   = "inbox"
+	channelEmail   = "email"
+	channelWebhook = "webhook"
+)
+
+var notificationChannels = []string{channelInbox, channelEmail, channelWebhook}
+
+// Message adalah notifikasi yang sudah di-render sesuai bahasa penerima
+type Message struct {
+	Type    string            `json:"type"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data"`
+}
+
+// Recipient berisi data penerima dan alamat untuk setiap channel
+type Recipient struct {
+	UserID     int
+	Username   string
+	Fullname   string
+	Language   string
+	Email      string
+	WebhookURL string
+	// Email hanya dipakai setelah pemiliknya membuka link verifikasi
+	EmailVerified bool
+}
+
+// Notifier mengirim pesan lewat satu channel. Error dari Send membuat
+// pesan dicoba lagi oleh outbox.
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, to Recipient, msg Message) error
+}
+
+// Channel yang aktif di server ini. Email hanya aktif jika SMTP_HOST diisi.
+func configuredNotifiers(db *sql.DB) map[string]Notifier {
+	notifiers := map[string]Notifier{
+		channelInbox:   &inboxNotifier{db: db},
+		channelWebhook: &webhookNotifier{client: newUserWebhookClient()},
+	}
+	if cfg := loadSMTPConfig(); cfg.Host != "" {
+		notifiers[channelEmail] = &smtpNotifier{cfg: cfg}
+	}
+	return notifiers
+}
+
+// inboxNotifier menyimpan notifikasi di database untuk ditampilkan di aplikasi
+type inboxNotifier struct {
+	db *sql.DB
+}
+
+func (n *inboxNotifier) Channel() string { return channelInbox }
+
+func (n *inboxNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	_, err := n.db.ExecContext(ctx, "INSERT INTO notifications (user_id, type, subject, body) VALUES (?, ?, ?, ?)",
+		to.UserID, msg.Type, msg.Subject, msg.Body)
+	return err
+}
+
+type smtpConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func loadSMTPConfig() smtpConfig {
+	return smtpConfig{
+		Host:     getEnv("SMTP_HOST", ""),
+		Port:     getEnv("SMTP_PORT", "587"),
+		Username: getEnv("SMTP_USER", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("SMTP_FROM", "no-reply@sibakar.local"),
+	}
+}
+
+// smtpNotifier mengirim email teks biasa lewat server SMTP
+type smtpNotifier struct {
+	cfg smtpConfig
+}
+
+func (n *smtpNotifier) Channel() string { return channelEmail }
+
+func (n *smtpNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.Email == "" {
+		return fmt.Errorf("recipient has no email address")
+	}
+
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	}
+
+	// Subject di-encode supaya karakter non-ASCII aman di header
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to.Email)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	addr := net.JoinHostPort(n.cfg.Host, n.cfg.Port)
+	return smtp.SendMail(addr, auth, n.cfg.From, []string{to.Email}, []byte(b.String()))
+}
+
+// webhookNotifier mengirim pesan sebagai JSON ke URL milik pengguna
+// (misalnya incoming webhook Slack atau Teams)
+type webhookNotifier struct {
+	client *http.Client
+}
+
+// Client untuk webhook pengguna. URL diisi oleh pengguna sendiri, jadi
+// koneksi ke loopback, link-local dan jaringan privat ditolak saat dial,
+// setelah DNS di-resolve, supaya server tidak bisa dipakai untuk mengakses
+// layanan internal. Redirect juga harus tetap ke https.
+func newUserWebhookClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: rejectInternalAddress}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		// Tanpa proxy dari environment, alamat tujuan harus dicek langsung
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 10 * time.Second},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("webhook redirected to non-https URL")
+			}
+			if len(via) >= 5 {
+				return fmt.Errorf("webhook redirected too many times")
+			}
+			return nil
+		},
+	}
+}
+
+// Dipanggil dialer untuk setiap alamat IP hasil resolve
+func rejectInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("webhook address %s is not a public address", host)
+	}
+	return nil
+}
+
+// 100.64.0.0/10 (carrier-grade NAT) tidak termasuk net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+func (n *webhookNotifier) Channel() string { return channelWebhook }
+
+func (n *webhookNotifier) Send(ctx context.Context, to Recipient, msg Message) error {
+	if to.WebhookURL == "" {
+		return fmt.Errorf("recipient has no webhook URL")
+	}
+	// URL http yang tersimpan sebelum aturan https tetap tidak dikirimi
+	if u, err := url.Parse(to.WebhookURL); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":     msg.Type,
+		"subject":  msg.Subject,
+		"body":     msg.Body,
+		"text":     msg.Subject + "\n\n" + msg.Body,
+		"data":     msg.Data,
+		"username": to.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookNotifierRejectsInternalTargets(t *testing.T) {
+	var hits int
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer srv.Close()
+
+	n := &webhookNotifier{client: newUserWebhookClient()}
+	msg := Message{Type: notifyBookingConfirmed, Subject: "Booking", Body: "Kursi A1"}
+	for _, tc := range []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com/hook", "must use https"},
+		{srv.URL, "not a public address"},
+		{strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), "not a public address"},
+	} {
+		err := n.Send(context.Background(), Recipient{Username: "budi", WebhookURL: tc.url}, msg)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Send(%s) error = %v, want %q", tc.url, err, tc.want)
+		}
+	}
+	if hits != 0 {
+		t.Fatalf("internal webhook target received %d requests", hits)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.10":     false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::ffff:127.0.0.1": false,
+		"::ffff:10.0.0.1":  false,
+	} {
+		if got := isPublicIP(net.ParseIP(addr)); got != want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Single sign-on lewat OpenID Connect (authorization code flow dengan
+// PKCE). Aktif jika OIDC_ISSUER diisi. Diatur lewat env:
+//
+//	OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET
+//	OIDC_REDIRECT_URL     halaman callback di frontend yang meneruskan code dan state
+//	OIDC_SCOPES           default "openid profile email groups"
+//	OIDC_USERNAME_CLAIM   claim untuk username (default preferred_username, cadangan email)
+//	OIDC_GROUPS_CLAIM     claim berisi daftar grup (default groups)
+//	OIDC_ADMIN_GROUPS     grup yang menjadi admin, dipisah koma
+//	OIDC_ALLOWED_GROUPS   jika diisi, hanya anggota grup ini (atau grup admin) yang boleh masuk
+//	OIDC_DIVISION_MAP     grup ke divisi, contoh "grp-finance=Keuangan,grp-it=TI"
+//	OIDC_LINK_EXISTING    true untuk menautkan akun lokal dengan username yang sama (default false)
+//	OIDC_TRUST_MFA        true jika claim amr dari IdP (mfa, otp, hwk) dianggap 2FA (default true)
+type OIDCConfig struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	UsernameClaim  string
+	GroupsClaim    string
+	Groups         groupMapping
+	LinkExisting   bool
+	TrustMFA       bool
+	StateTTL       time.Duration
+	DiscoveryRetry time.Duration
+}
+
+func loadOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		Issuer:         getEnv("OIDC_ISSUER", ""),
+		ClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		ClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:    getEnv("OIDC_REDIRECT_URL", "http://localhost:5173/auth/callback"),
+		Scopes:         strings.Fields(getEnv("OIDC_SCOPES", "openid profile email groups")),
+		UsernameClaim:  getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		GroupsClaim:    getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		Groups:         loadGroupMapping("OIDC"),
+		LinkExisting:   getEnv("OIDC_LINK_EXISTING", "false") == "true",
+		TrustMFA:       getEnv("OIDC_TRUST_MFA", "true") == "true",
+		StateTTL:       getEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+		DiscoveryRetry: 30 * time.Second,
+	}
+}
+
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+var oidcConfig = loadOIDCConfig()
+
+const (
+	auditLoginOIDC       = "login.oidc"
+	auditUserProvisioned = "user.provisioned"
+)
+
+// oidcClient menyimpan hasil discovery IdP. Discovery dilakukan saat
+// pertama dipakai dan diulang jika gagal, jadi IdP yang sedang mati tidak
+// membuat server gagal start.
+type oidcClient struct {
+	cfg OIDCConfig
+
+	mu          sync.Mutex
+	provider    *oidc.Provider
+	lastAttempt time.Time
+}
+
+var ssoClient = &oidcClient{cfg: oidcConfig}
+
+func (c *oidcClient) discover(ctx context.Context) (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	if time.Since(c.lastAttempt) < c.cfg.DiscoveryRetry {
+		return nil, fmt.Errorf("OIDC discovery failed recently, retrying after %s", c.cfg.DiscoveryRetry)
+	}
+	c.lastAttempt = time.Now()
+	provider, err := oidc.NewProvider(ctx, c.cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %v", c.cfg.Issuer, err)
+	}
+	c.provider = provider
+	return provider, nil
+}
+
+func (c *oidcClient) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.cfg.ClientID,
+		ClientSecret: c.cfg.ClientSecret,
+		RedirectURL:  c.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       c.cfg.Scopes,
+	}
+}
+
+// Identitas dari ID token yang sudah diverifikasi
+type oidcIdentity struct {
+	Subject  string // issuer + "|" + sub, unik lintas IdP
+	Username string
+	Fullname string
+	Groups   []string
+	MFA      bool
+}
+
+// Menukar code dengan token, memverifikasi ID token (tanda tangan, aud,
+// exp, nonce) lalu membaca claim yang dibutuhkan
+func (c *oidcClient) exchange(ctx context.Context, code, verifier, nonce string) (oidcIdentity, error) {
+	var id oidcIdentity
+	provider, err := c.discover(ctx)
+	if err != nil {
+		return id, err
+	}
+	token, err := c.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return id, fmt.Errorf("code exchange failed: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return id, fmt.Errorf("token response has no id_token")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: c.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return id, fmt.Errorf("invalid id_token: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return id, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return id, err
+	}
+	id.Subject = idToken.Issuer + "|" + idToken.Subject
+	id.Username, _ = claims[c.cfg.UsernameClaim].(string)
+	if id.Username == "" {
+		id.Username, _ = claims["email"].(string)
+	}
+	id.Fullname, _ = claims["name"].(string)
+	if id.Fullname == "" {
+		id.Fullname = id.Username
+	}
+	id.Groups = stringList(claims[c.cfg.GroupsClaim])
+	if c.cfg.TrustMFA {
+		for _, amr := range stringList(claims["amr"]) {
+			if amr == "mfa" || amr == "otp" || amr == "hwk" {
+				id.MFA = true
+			}
+		}
+	}
+	return id, nil
+}
+
+// Claim grup bisa berupa array atau satu string
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Response GET /auth/oidc/login
+type OIDCLoginResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	ExpiresAt        string `json:"expires_at"`
+}
+
+// Payload POST /auth/oidc/callback, diteruskan frontend dari redirect IdP
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// Handler untuk GET /auth/oidc/login. state, nonce dan code verifier PKCE
+// disimpan di server, frontend cukup membuka authorization_url.
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcConfig.Enabled() {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Single sign-on is not configured")
+		return
+	}
+	provider, err := ssoClient.discover(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "OIDC provider unavailable", "error", err)
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, "Identity provider is unavailable, please try again later")
+		return
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+	expiresAt := time.Now().Add(oidcConfig.StateTTL)
+
+	db := setupDatabase()
+	defer db.Close()
+
+	_, err = db.Exec("INSERT INTO oidc_logins (state_hash, code_verifier, nonce, expires_at) VALUES (?, ?, ?, ?)",
+		sha256Hex(state), verifier, nonce, expiresAt.Format(jobTimeLayout))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	url := ssoClient.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	writeJSON(w, http.StatusOK, OIDCLoginResponse{AuthorizationURL: url, ExpiresAt: expiresAt.Format(time.RFC3339)})
+}
+
+// Handler untuk POST /auth/oidc/callback
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcConfig.Enabled() {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Single sign-on is not configured")
+		return
+	}
+	var req OIDCCallbackRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	// state hanya bisa dipakai sekali
+	var verifier, nonce string
+	err := db.QueryRow("SELECT code_verifier, nonce FROM oidc_logins WHERE state_hash = ? AND expires_at > NOW()", sha256Hex(req.State)).
+		Scan(&verifier, &nonce)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Login session is invalid or expired, please start again")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	// DELETE yang berhasil menandai state sudah diklaim, callback lain
+	// dengan state yang sama mendapat 0 baris
+	result, err := db.Exec("DELETE FROM oidc_logins WHERE state_hash = ? AND expires_at > NOW()", sha256Hex(req.State))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Login session is invalid or expired, please start again")
+		return
+	}
+
+	identity, err := ssoClient.exchange(r.Context(), req.Code, verifier, nonce)
+	if err != nil {
+		slog.WarnContext(r.Context(), "OIDC login failed", "error", err)
+		metricLogins.Inc("failure")
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Single sign-on failed")
+		return
+	}
+	role, division, allowed := oidcConfig.Groups.mapGroups(identity.Groups)
+	if !allowed {
+		metricLogins.Inc("failure")
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Your account is not in a group allowed to use this application")
+		return
+	}
+
+	user, err := provisionOIDCUser(w, r, db, identity, role, division)
+	if err != nil {
+		return
+	}
+	recordAudit(db, r, auditLoginOIDC, user.Username, "subject="+identity.Subject)
+
+	// 2FA lokal tetap berlaku kecuali IdP sudah melakukan MFA
+	if user.TwoFactor && !identity.MFA {
+		challenge, expiresAt, err := createLoginChallenge(db, user.ID)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, LoginResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     challenge,
+			ChallengeExpiresAt: expiresAt.Format(time.RFC3339),
+		})
+		return
+	}
+	completeLogin(w, r, db, user, identity.MFA)
+}
+
+// Mencari akun berdasarkan subject IdP, membuat akun baru jika belum ada
+// (just-in-time provisioning), lalu menyamakan role dan divisi dengan grup.
+// Menulis response error sendiri dan mengembalikan error jika gagal.
+func provisionOIDCUser(w http.ResponseWriter, r *http.Request, db *sql.DB, id oidcIdentity, role, division string) (User, error) {
+	var user User
+	var username string
+	err := db.QueryRow("SELECT username FROM users WHERE oidc_subject = ?", id.Subject).Scan(&username)
+	if err == sql.ErrNoRows {
+		username, err = linkOrCreateOIDCUser(w, r, db, id, role, division)
+		if err != nil {
+			return user, err
+		}
+	} else if err != nil {
+		writeInternalError(w, r, err)
+		return user, err
+	}
+
+	_, err = db.Exec("UPDATE users SET role = ?, division = IF(? = '', division, ?) WHERE username = ?",
+		role, division, division, username)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return user, err
+	}
+	user, err = getUserByUsername(db, username)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return user, err
+	}
+	if user.Status != userStatusActive {
+		writeError(w, r, http.StatusForbidden, codeAccountPending, "Account is awaiting admin approval")
+		return user, fmt.Errorf("account pending")
+	}
+	return user, nil
+}
+
+func linkOrCreateOIDCUser(w http.ResponseWriter, r *http.Request, db *sql.DB, id oidcIdentity, role, division string) (string, error) {
+	if id.Username == "" || len(id.Username) > 50 {
+		err := fmt.Errorf("identity provider returned an unusable username %q", id.Username)
+		slog.WarnContext(r.Context(), "OIDC login failed", "error", err)
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Identity provider did not return a usable username")
+		return "", err
+	}
+
+	var existingID int
+	var subject sql.NullString
+	err := db.QueryRow("SELECT id, oidc_subject FROM users WHERE username = ?", id.Username).Scan(&existingID, &subject)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Exec(`
+			INSERT INTO users (username, fullname, password, role, division, status, oidc_subject)
+			VALUES (?, ?, '', ?, ?, ?, ?)`,
+			id.Username, id.Fullname, role, division, userStatusActive, id.Subject)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return "", err
+		}
+		recordAudit(db, r, auditUserProvisioned, id.Username, "role="+role)
+		return id.Username, nil
+	case err != nil:
+		writeInternalError(w, r, err)
+		return "", err
+	case subject.Valid || !oidcConfig.LinkExisting:
+		// Username sudah dipakai akun lokal atau identitas IdP lain
+		writeError(w, r, http.StatusConflict, codeConflict, "An account with this username already exists, ask an admin to link it")
+		return "", fmt.Errorf("username taken")
+	}
+
+	if _, err := db.Exec("UPDATE users SET oidc_subject = ? WHERE id = ?", id.Subject, existingID); err != nil {
+		writeInternalError(w, r, err)
+		return "", err
+	}
+	return id.Username, nil
+}
+
+func pruneOIDCLogins(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM oidc_logins WHERE expires_at < NOW()")
+	return err
+}
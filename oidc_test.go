@@ -0,0 +1,458 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP adalah identity provider OIDC di dalam proses: discovery, JWKS,
+// endpoint authorize yang langsung redirect dengan code, dan endpoint token
+// yang memeriksa PKCE sebelum menerbitkan id_token.
+type fakeIdP struct {
+	srv *httptest.Server
+	key signingKey
+
+	mu         sync.Mutex
+	grants     map[string]fakeGrant
+	tokenCalls int
+	// Claim tambahan atau pengganti untuk id_token berikutnya
+	claims map[string]interface{}
+}
+
+type fakeGrant struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+const (
+	testOIDCClientID = "sibakar-test"
+	testOIDCRedirect = "http://app.test/auth/callback"
+	testOIDCSubject  = "user-1"
+)
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{
+		key:    signingKey{ID: "idp-key", Algorithm: algRS256, Private: priv},
+		grants: map[string]fakeGrant{},
+		claims: map[string]interface{}{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                idp.srv.URL,
+			"authorization_endpoint":                idp.srv.URL + "/authorize",
+			"token_endpoint":                        idp.srv.URL + "/token",
+			"jwks_uri":                              idp.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{algRS256},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, JWKSet{Keys: []JWK{publicJWK(idp.key)}})
+	})
+	mux.HandleFunc("GET /authorize", idp.authorize)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func (idp *fakeIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testOIDCClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	code, _ := randomToken(16)
+	idp.mu.Lock()
+	idp.grants[code] = fakeGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+	idp.mu.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.tokenCalls++
+
+	r.ParseForm()
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostForm.Get("client_id")
+	}
+	grant, found := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !found || clientID != testOIDCClientID || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != grant.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                idp.srv.URL,
+		"aud":                testOIDCClientID,
+		"sub":                testOIDCSubject,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              grant.nonce,
+		"preferred_username": "budi",
+		"name":               "Budi Santoso",
+		"groups":             []string{"sibakar-admins", "grp-it"},
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = idp.key.ID
+	signed, err := idToken.SignedString(idp.key.Private)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "idp-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+// Mengarahkan konfigurasi OIDC ke fake IdP selama test berjalan
+func useFakeOIDC(t *testing.T, idp *fakeIdP) {
+	t.Helper()
+	prevConfig, prevClient := oidcConfig, ssoClient
+	oidcConfig = OIDCConfig{
+		Issuer:        idp.srv.URL,
+		ClientID:      testOIDCClientID,
+		ClientSecret:  "secret",
+		RedirectURL:   testOIDCRedirect,
+		Scopes:        []string{"openid", "profile", "groups"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		Groups: groupMapping{
+			AdminGroups:   []string{"sibakar-admins"},
+			AllowedGroups: []string{"sibakar-users"},
+			DivisionMap:   map[string]string{"grp-it": "TI", "grp-finance": "Keuangan"},
+			DivisionOrder: []string{"grp-it", "grp-finance"},
+		},
+		TrustMFA:       true,
+		StateTTL:       10 * time.Minute,
+		DiscoveryRetry: time.Second,
+	}
+	ssoClient = &oidcClient{cfg: oidcConfig}
+	t.Cleanup(func() { oidcConfig, ssoClient = prevConfig, prevClient })
+}
+
+// Hasil GET /auth/oidc/login yang sudah melewati halaman authorize IdP
+type oidcLoginAttempt struct {
+	code, state, verifier, nonce string
+}
+
+// Menjalankan GET /auth/oidc/login lalu mengikuti authorization_url ke
+// fake IdP, seperti yang dilakukan browser
+func startOIDCLogin(t *testing.T, idp *fakeIdP, mock sqlmock.Sqlmock) oidcLoginAttempt {
+	t.Helper()
+	stateHash, verifier, nonce := &captureArg{}, &captureArg{}, &captureArg{}
+	mock.ExpectExec("INSERT INTO oidc_logins").
+		WithArgs(stateHash, verifier, nonce, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := httptest.NewRecorder()
+	oidcLoginHandler(rec, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %d, body %s", rec.Code, rec.Body)
+	}
+	var resp OIDCLoginResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	authURL, err := url.Parse(resp.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(verifier.value))
+	if got := authURL.Query().Get("code_challenge"); got != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("code_challenge %q does not match the stored verifier", got)
+	}
+	if authURL.Query().Get("nonce") != nonce.value {
+		t.Fatalf("nonce in authorization URL does not match the stored nonce")
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(resp.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(callback.String(), testOIDCRedirect) {
+		t.Fatalf("authorize redirect = %q (status %d)", res.Header.Get("Location"), res.StatusCode)
+	}
+	state := callback.Query().Get("state")
+	if sha256Hex(state) != stateHash.value {
+		t.Fatal("state returned by the IdP does not match the stored state hash")
+	}
+	return oidcLoginAttempt{code: callback.Query().Get("code"), state: state, verifier: verifier.value, nonce: nonce.value}
+}
+
+// Ekspektasi klaim state di callback
+func expectStateClaim(mock sqlmock.Sqlmock, attempt oidcLoginAttempt) {
+	mock.ExpectQuery("SELECT code_verifier, nonce FROM oidc_logins").
+		WithArgs(sha256Hex(attempt.state)).
+		WillReturnRows(sqlmock.NewRows([]string{"code_verifier", "nonce"}).AddRow(attempt.verifier, attempt.nonce))
+	mock.ExpectExec("DELETE FROM oidc_logins").
+		WithArgs(sha256Hex(attempt.state)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func postOIDCCallback(code, state string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(OIDCCallbackRequest{Code: code, State: state})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/auth/oidc/callback", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	oidcCallbackHandler(rec, req)
+	return rec
+}
+
+func decodeLogin(t *testing.T, rec *httptest.ResponseRecorder) LoginResponse {
+	t.Helper()
+	var resp LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestOIDCLoginProvisionsNewUser(t *testing.T) {
+	idp := newFakeIdP(t)
+	useFakeOIDC(t, idp)
+	useStubIssuer(t)
+	mock := useMockDB(t)
+
+	attempt := startOIDCLogin(t, idp, mock)
+	expectStateClaim(mock, attempt)
+	subject := idp.srv.URL + "|" + testOIDCSubject
+	mock.ExpectQuery("SELECT username FROM users WHERE oidc_subject").
+		WithArgs(subject).
+		WillReturnRows(sqlmock.NewRows([]string{"username"}))
+	mock.ExpectQuery("SELECT id, oidc_subject FROM users WHERE username").
+		WithArgs("budi").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "oidc_subject"}))
+	// Grup sibakar-admins menjadi admin, grp-it menjadi divisi TI
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("budi", "Budi Santoso", roleAdmin, "TI", userStatusActive, subject).
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	expectAudit(mock, auditUserProvisioned)
+	mock.ExpectExec("UPDATE users SET role").
+		WithArgs(roleAdmin, "TI", "TI", "budi").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, fullname, password, role, status, account_type, totp_enabled FROM users")).
+		WithArgs("budi").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(7, "budi", "Budi Santoso", "", roleAdmin, userStatusActive, "user", false))
+	expectAudit(mock, auditLoginOIDC)
+	mock.ExpectExec("INSERT INTO user_sessions").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rec := postOIDCCallback(attempt.code, attempt.state)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, body %s", rec.Code, rec.Body)
+	}
+	resp := decodeLogin(t, rec)
+	if resp.Token != "token:budi:mfa=false" || resp.User == nil || resp.User.Role != roleAdmin {
+		t.Fatalf("unexpected login response %+v", resp)
+	}
+}
+
+func TestOIDCLoginRejectsWrongPKCEVerifier(t *testing.T) {
+	idp := newFakeIdP(t)
+	useFakeOIDC(t, idp)
+	mock := useMockDB(t)
+
+	attempt := startOIDCLogin(t, idp, mock)
+	attempt.verifier = "a-verifier-that-does-not-match-the-challenge-0123456789"
+	expectStateClaim(mock, attempt)
+
+	rec := postOIDCCallback(attempt.code, attempt.state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	useFakeOIDC(t, idp)
+	mock := useMockDB(t)
+
+	attempt := startOIDCLogin(t, idp, mock)
+	idp.claims["nonce"] = "nonce-from-another-login"
+	expectStateClaim(mock, attempt)
+
+	rec := postOIDCCallback(attempt.code, attempt.state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestOIDCCallbackRejectsUnknownOrExpiredState(t *testing.T) {
+	idp := newFakeIdP(t)
+	useFakeOIDC(t, idp)
+	mock := useMockDB(t)
+
+	attempt := startOIDCLogin(t, idp, mock)
+	// State kedaluwarsa tidak lolos filter expires_at > NOW()
+	mock.ExpectQuery("SELECT code_verifier, nonce FROM oidc_logins").
+		WithArgs(sha256Hex(attempt.state)).
+		WillReturnRows(sqlmock.NewRows([]string{"code_verifier", "nonce"}))
+
+	rec := postOIDCCallback(attempt.code, attempt.state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+	if idp.tokenCalls != 0 {
+		t.Fatal("code was exchanged for an unknown state")
+	}
+}
+
+func TestOIDCCallbackRejectsStateClaimedTwice(t *testing.T) {
+	idp := newFakeIdP(t)
+	useFakeOIDC(t, idp)
+	mock := useMockDB(t)
+
+	attempt := startOIDCLogin(t, idp, mock)
+	// Callback lain sudah menghapus state di antara SELECT dan DELETE
+	mock.ExpectQuery("SELECT code_verifier, nonce FROM oidc_logins").
+		WithArgs(sha256Hex(attempt.state)).
+		WillReturnRows(sqlmock.NewRows([]string{"code_verifier", "nonce"}).AddRow(attempt.verifier, attempt.nonce))
+	mock.ExpectExec("DELETE FROM oidc_logins").
+		WithArgs(sha256Hex(attempt.state)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rec := postOIDCCallback(attempt.code, attempt.state)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+	if idp.tokenCalls != 0 {
+		t.Fatal("code was exchanged for a state that was already claimed")
+	}
+}
+
+func TestOIDCLoginRejectsUserOutsideAllowedGroups(t *testing.T) {
+	idp := newFakeIdP(t)
+	useFakeOIDC(t, idp)
+	mock := useMockDB(t)
+
+	attempt := startOIDCLogin(t, idp, mock)
+	idp.claims["groups"] = []string{"contractors"}
+	expectStateClaim(mock, attempt)
+
+	rec := postOIDCCallback(attempt.code, attempt.state)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+}
+
+// Akun yang sudah tertaut dengan 2FA lokal: amr mfa dari IdP melewati
+// challenge TOTP, tanpa amr tetap diminta kode
+func TestOIDCLoginTwoFactorAndAMR(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		amr       []string
+		challenge bool
+	}{
+		{"amr mfa skips local 2FA", []string{"pwd", "mfa"}, false},
+		{"password only needs local 2FA", []string{"pwd"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			useFakeOIDC(t, idp)
+			useStubIssuer(t)
+			mock := useMockDB(t)
+
+			attempt := startOIDCLogin(t, idp, mock)
+			idp.claims["amr"] = tc.amr
+			idp.claims["groups"] = []string{"sibakar-users", "grp-finance"}
+			expectStateClaim(mock, attempt)
+			mock.ExpectQuery("SELECT username FROM users WHERE oidc_subject").
+				WithArgs(idp.srv.URL + "|" + testOIDCSubject).
+				WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("budi"))
+			mock.ExpectExec("UPDATE users SET role").
+				WithArgs(roleMember, "Keuangan", "Keuangan", "budi").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, fullname, password, role, status, account_type, totp_enabled FROM users")).
+				WithArgs("budi").
+				WillReturnRows(sqlmock.NewRows(userColumns).AddRow(7, "budi", "Budi Santoso", "", roleMember, userStatusActive, "user", true))
+			expectAudit(mock, auditLoginOIDC)
+			if tc.challenge {
+				mock.ExpectExec("INSERT INTO login_challenges").WillReturnResult(sqlmock.NewResult(1, 1))
+			} else {
+				mock.ExpectExec("INSERT INTO user_sessions").WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			rec := postOIDCCallback(attempt.code, attempt.state)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			resp := decodeLogin(t, rec)
+			if tc.challenge {
+				if !resp.TwoFactorRequired || resp.ChallengeToken == "" || resp.Token != "" {
+					t.Fatalf("expected a two-factor challenge, got %+v", resp)
+				}
+			} else if resp.Token != "token:budi:mfa=true" {
+				t.Fatalf("expected an MFA token, got %+v", resp)
+			}
+		})
+	}
+}
+
+func TestOIDCGroupMapping(t *testing.T) {
+	m := groupMapping{
+		AdminGroups:   []string{"sibakar-admins"},
+		AllowedGroups: []string{"sibakar-users"},
+		DivisionMap:   map[string]string{"grp-it": "TI", "grp-finance": "Keuangan"},
+		DivisionOrder: []string{"grp-it", "grp-finance"},
+	}
+	for _, tc := range []struct {
+		groups   []string
+		role     string
+		division string
+		ok       bool
+	}{
+		{[]string{"sibakar-users"}, roleMember, "", true},
+		{[]string{"Sibakar-Admins"}, roleAdmin, "", true},
+		{[]string{"sibakar-users", "grp-finance", "grp-it"}, roleMember, "TI", true},
+		{[]string{"grp-finance"}, "", "", false},
+		{nil, "", "", false},
+	} {
+		role, division, ok := m.mapGroups(tc.groups)
+		if role != tc.role || division != tc.division || ok != tc.ok {
+			t.Errorf("mapGroups(%v) = %q, %q, %v; want %q, %q, %v", tc.groups, role, division, ok, tc.role, tc.division, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed docs/index.html
+var docsPage []byte
+
+// Dokumen OpenAPI dibuat sekali saat start (lihat main) dari tabel routes
+var openAPIDocument map[string]interface{}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// Membuat dokumen OpenAPI 3 dari tabel routes. Schema komponen dibuat dari
+// struct Go (tag json dan validate) agar selalu sama dengan kode.
+func buildOpenAPI(routes []route) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	// Error envelope dipakai oleh semua endpoint, daftarkan di awal
+	errorRef := schemaRef(reflect.TypeOf(errorEnvelope{}), schemas)
+
+	for _, rt := range routes {
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"tags":        []string{rt.Tag},
+			"operationId": operationID(rt),
+		}
+		if rt.Successor != "" {
+			op["deprecated"] = true
+			op["description"] = "Deprecated, gunakan " + rt.Successor
+		}
+		if rt.Auth != "" {
+			op["security"] = []map[string][]string{{"bearerAuth": {}}}
+			// Scope yang dibutuhkan jika dipanggil dengan API token
+			if scope := routeScope(rt); scope != "" {
+				op["x-api-token-scope"] = scope
+			}
+		}
+
+		var params []map[string]interface{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(rt.Path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]string{"type": "string"},
+			})
+		}
+		for _, q := range rt.Query {
+			params = append(params, map[string]interface{}{
+				"name": q.Name, "in": "query", "description": q.Description,
+				"schema": map[string]string{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaRef(reflect.TypeOf(rt.Request), schemas)},
+				},
+			}
+		}
+
+		status := rt.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if rt.Response != nil {
+			schema := schemaRef(reflect.TypeOf(rt.Response), schemas)
+			if rt.List {
+				schema = pageSchema(schema)
+			}
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schema},
+			}
+		}
+		errorResponse := func(description string) map[string]interface{} {
+			return map[string]interface{}{
+				"description": description,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": errorRef},
+				},
+			}
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse("Error"),
+		}
+		if rt.Request != nil || len(rt.Query) > 0 {
+			responses["400"] = errorResponse("Validation error")
+		}
+		if rt.Auth != "" {
+			responses["401"] = errorResponse("Missing or invalid token")
+			responses["403"] = errorResponse("Insufficient privileges")
+		}
+		if rt.Limit != "" {
+			responses["429"] = errorResponse("Too many attempts or account temporarily locked, see Retry-After")
+		}
+		op["responses"] = responses
+
+		if paths[rt.Path] == nil {
+			paths[rt.Path] = map[string]interface{}{}
+		}
+		paths[rt.Path][strings.ToLower(rt.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "SIBAKAR API",
+			"version":     "1.0.0",
+			"description": "Backend API untuk sistem booking kursi SIBAKAR",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT",
+					"description": "JWT dari /login, atau API token sbk_... yang dibatasi x-api-token-scope"},
+			},
+		},
+	}
+}
+
+func operationID(rt route) string {
+	name := strings.ToLower(rt.Method) + pathParamPattern.ReplaceAllString(rt.Path, "By_$1")
+	return strings.NewReplacer("/", "_", ".", "_", "-", "_").Replace(name)
+}
+
+func pageSchema(item map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"data":        map[string]interface{}{"type": "array", "items": item},
+			"next_cursor": map[string]string{"type": "string"},
+			"total":       map[string]string{"type": "integer"},
+		},
+		"required": []string{"data"},
+	}
+}
+
+// Membuat schema untuk tipe Go. Struct bernama didaftarkan ke components
+// dan dirujuk dengan $ref.
+func schemaRef(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaRef(t.Elem(), schemas)
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = map[string]interface{}{} // cegah rekursi tak hingga
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := schemaRef(field.Type, schemas)
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			key, arg, _ := strings.Cut(rule, "=")
+			switch key {
+			case "required":
+				required = append(required, name)
+			case "min":
+				n, _ := strconv.Atoi(arg)
+				prop["minLength"] = n
+			case "max":
+				n, _ := strconv.Atoi(arg)
+				prop["maxLength"] = n
+			case "oneof":
+				prop["enum"] = strings.Fields(arg)
+			case "email":
+				prop["format"] = "email"
+			}
+		}
+		properties[name] = prop
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Handler untuk /openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPIDocument)
+}
+
+// Handler untuk /docs, halaman dokumentasi yang bisa dibuka tanpa internet
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
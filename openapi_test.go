@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// verifierFunc memetakan token test langsung ke claims
+type verifierFunc func(token string) (*AccessClaims, error)
+
+func (f verifierFunc) Verify(ctx context.Context, token string) (*AccessClaims, error) {
+	return f(token)
+}
+
+var testTokens = verifierFunc(func(token string) (*AccessClaims, error) {
+	switch token {
+	case "member":
+		return &AccessClaims{Username: "budi", Role: roleMember}, nil
+	case "admin":
+		return &AccessClaims{Username: "admin", Role: roleAdmin, MFA: true}, nil
+	}
+	return nil, errors.New("unknown test token")
+})
+
+// Operasi di dokumen OpenAPI dalam bentuk yang dilihat klien (hasil JSON)
+type documentedOperation struct {
+	Security   []map[string][]string `json:"security"`
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	Responses map[string]json.RawMessage `json:"responses"`
+	Summary   string                     `json:"summary"`
+}
+
+// Dokumen dibuat dari tabel routes, lalu setiap operasi diuji dengan request
+// sungguhan ke router: pattern yang menjawab, path param yang diterima
+// handler dan perlakuan terhadap request tanpa token harus sama dengan yang
+// tertulis di dokumen.
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]documentedOperation `json:"paths"`
+	}
+	raw, err := json.Marshal(buildOpenAPI(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Handler asli diganti stub yang melaporkan pattern dan path value yang diterima
+	reached := map[string]map[string]string{}
+	stubbed := make([]route, len(routes))
+	for i, rt := range routes {
+		rt.Handler = func(w http.ResponseWriter, r *http.Request) {
+			values := map[string]string{}
+			for _, m := range pathParamPattern.FindAllStringSubmatch(r.Pattern, -1) {
+				values[m[1]] = r.PathValue(m[1])
+			}
+			reached[r.Pattern] = values
+			w.WriteHeader(http.StatusNoContent)
+		}
+		stubbed[i] = rt
+	}
+	prevRoutes, prevVerifier := routes, tokenVerifier
+	routes, tokenVerifier = stubbed, testTokens
+	t.Cleanup(func() { routes, tokenVerifier = prevRoutes, prevVerifier })
+	router := newRouter()
+	mock := useMockDB(t)
+
+	// Setiap pattern di ServeMux harus terdokumentasi, dan sebaliknya
+	documented := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	var missing []string
+	for _, pattern := range registeredPatterns {
+		if !documented[pattern] {
+			missing = append(missing, pattern)
+		}
+		delete(documented, pattern)
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Errorf("routes missing from the OpenAPI document: %s", strings.Join(missing, ", "))
+	}
+	for pattern := range documented {
+		t.Errorf("OpenAPI documents %s but the router does not serve it", pattern)
+	}
+
+	activeRoutes := map[string]bool{}
+	for _, rt := range routes {
+		if rt.Auth == authActive {
+			activeRoutes[rt.Method+" "+rt.Path] = true
+		}
+	}
+
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			method = strings.ToUpper(method)
+			pattern := method + " " + path
+			if op.Summary == "" || len(op.Responses) == 0 {
+				t.Errorf("%s has no summary or responses", pattern)
+			}
+
+			// Path param di dokumen harus sama persis dengan wildcard di path
+			wantParams := map[string]string{}
+			target := pathParamPattern.ReplaceAllStringFunc(path, func(m string) string {
+				name := strings.Trim(m, "{}")
+				wantParams[name] = "v-" + name
+				return "v-" + name
+			})
+			gotParams := map[string]bool{}
+			for _, p := range op.Parameters {
+				if p.In == "path" {
+					gotParams[p.Name] = true
+				}
+			}
+			if len(gotParams) != len(wantParams) {
+				t.Errorf("%s documents path params %v, path has %v", pattern, gotParams, wantParams)
+			}
+			for name := range wantParams {
+				if !gotParams[name] {
+					t.Errorf("%s does not document path param %q", pattern, name)
+				}
+			}
+
+			secured := len(op.Security) > 0
+			// Tanpa token: endpoint ber-security harus menolak dengan 401,
+			// endpoint publik harus sampai ke handler
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+			if secured && rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s is documented as authenticated but answered %d without a token", pattern, rec.Code)
+				continue
+			}
+			if !secured && rec.Code != http.StatusNoContent {
+				t.Errorf("%s is documented as public but answered %d without a token", pattern, rec.Code)
+				continue
+			}
+
+			if secured {
+				if activeRoutes[pattern] {
+					mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM users WHERE username = ?")).
+						WithArgs("admin").
+						WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(userStatusActive))
+				}
+				delete(reached, pattern)
+				rec = httptest.NewRecorder()
+				req := httptest.NewRequest(method, target, nil)
+				req.Header.Set("Authorization", "Bearer admin")
+				router.ServeHTTP(rec, req)
+				if rec.Code != http.StatusNoContent {
+					t.Errorf("%s answered %d for an admin token", pattern, rec.Code)
+					continue
+				}
+			}
+
+			got, ok := reached[pattern]
+			if !ok {
+				t.Errorf("%s %s was served by another pattern", method, target)
+				continue
+			}
+			for name, want := range wantParams {
+				if got[name] != want {
+					t.Errorf("%s: handler received %s=%q, want %q", pattern, name, got[name], want)
+				}
+			}
+		}
+	}
+}
+
+// Endpoint admin harus menolak token anggota biasa
+func TestAdminRoutesRejectMembers(t *testing.T) {
+	prevVerifier := tokenVerifier
+	tokenVerifier = testTokens
+	t.Cleanup(func() { tokenVerifier = prevVerifier })
+	router := newRouter()
+
+	for _, rt := range routes {
+		if rt.Auth != authAdmin {
+			continue
+		}
+		target := pathParamPattern.ReplaceAllString(rt.Path, "1")
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(rt.Method, target, nil)
+		req.Header.Set("Authorization", "Bearer member")
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s answered %d for a member token, want 403", rt.Method, rt.Path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// listSpec mendefinisikan tabel dan kolom yang boleh dipakai untuk sorting
+// pada sebuah endpoint list. Nama sort dari client dipetakan ke nama kolom
+// agar input client tidak pernah masuk langsung ke SQL.
+type listSpec struct {
+	Table       string
+	Sortable    map[string]string
+	DefaultSort string
+	// Filters membaca filter khusus endpoint dari query string. Dipakai juga
+	// oleh export supaya filter list dan export selalu sama.
+	Filters func(r *http.Request, p *pageRequest, errs map[string]string)
+}
+
+// Posisi terakhir halaman sebelumnya (keyset pagination)
+type pageCursor struct {
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// pageRequest berisi parameter limit, sort, cursor dan filter dari query string
+type pageRequest struct {
+	spec   listSpec
+	Limit  int // 0 berarti tanpa batas, hanya untuk path lama
+	Sort   string
+	Desc   bool
+	Cursor *pageCursor
+	where  []string
+	args   []interface{}
+}
+
+// Page adalah envelope standar untuk semua endpoint list
+type Page struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Total      *int        `json:"total,omitempty"`
+}
+
+// Parsing ?limit=&sort=&cursor= dari request. Sort diawali "-" berarti descending,
+// contoh: ?sort=-created_at
+func parsePageRequest(r *http.Request, spec listSpec) (*pageRequest, map[string]string) {
+	errs := make(map[string]string)
+	q := r.URL.Query()
+	p := &pageRequest{spec: spec, Limit: defaultPageLimit, Sort: spec.DefaultSort}
+	// Path lama dulu mengembalikan semua data dalam satu array, tetap
+	// begitu kecuali client mengirim ?limit= sendiri
+	if isLegacyRequest(r) {
+		p.Limit = 0
+	}
+
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			errs["limit"] = fmt.Sprintf("must be a number between 1 and %d", maxPageLimit)
+		} else {
+			p.Limit = limit
+		}
+	}
+
+	if raw := q.Get("sort"); raw != "" {
+		p.Desc = strings.HasPrefix(raw, "-")
+		p.Sort = strings.TrimPrefix(raw, "-")
+		if _, ok := spec.Sortable[p.Sort]; !ok {
+			allowed := make([]string, 0, len(spec.Sortable))
+			for name := range spec.Sortable {
+				allowed = append(allowed, name)
+			}
+			sort.Strings(allowed)
+			errs["sort"] = "must be one of: " + strings.Join(allowed, ", ")
+		}
+	}
+
+	if raw := q.Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil {
+			errs["cursor"] = "is not valid"
+		} else {
+			p.Cursor = cursor
+		}
+	}
+
+	if spec.Filters != nil {
+		spec.Filters(r, p, errs)
+	}
+
+	return p, errs
+}
+
+// Filter menambahkan kondisi WHERE, contoh: p.Filter("status = ?", status)
+func (p *pageRequest) Filter(clause string, args ...interface{}) {
+	p.where = append(p.where, clause)
+	p.args = append(p.args, args...)
+}
+
+// FilterDateRange menambahkan filter ?from=YYYY-MM-DD&to=YYYY-MM-DD (inklusif)
+func (p *pageRequest) FilterDateRange(r *http.Request, column string, errs map[string]string) {
+	q := r.URL.Query()
+	if from := q.Get("from"); from != "" {
+		if _, err := time.Parse("2006-01-02", from); err != nil {
+			errs["from"] = "must be a date in YYYY-MM-DD format"
+		} else {
+			p.Filter(column+" >= ?", from)
+		}
+	}
+	if to := q.Get("to"); to != "" {
+		if day, err := time.Parse("2006-01-02", to); err != nil {
+			errs["to"] = "must be a date in YYYY-MM-DD format"
+		} else {
+			p.Filter(column+" < ?", day.AddDate(0, 0, 1).Format("2006-01-02"))
+		}
+	}
+}
+
+// FilterParam menambahkan filter kesamaan jika query parameter diisi
+func (p *pageRequest) FilterParam(r *http.Request, param, column string) {
+	if value := r.URL.Query().Get(param); value != "" {
+		p.Filter(column+" = ?", value)
+	}
+}
+
+func (p *pageRequest) whereSQL(extra ...string) string {
+	clauses := append(append([]string{}, p.where...), extra...)
+	if len(clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(clauses, " AND ")
+}
+
+// Query menjalankan SELECT untuk satu halaman. Fungsi scan mengembalikan item
+// baru beserta pointer tujuan Scan untuk kolom-kolom di columns.
+func (p *pageRequest) Query(db *sql.DB, columns string, scan func() (interface{}, []interface{})) (Page, error) {
+	sortColumn := p.spec.Sortable[p.Sort]
+	op, dir := ">", "ASC"
+	if p.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	args := append([]interface{}{}, p.args...)
+	var keyset []string
+	if p.Cursor != nil {
+		keyset = append(keyset, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortColumn, op))
+		args = append(args, p.Cursor.Value, p.Cursor.Value, p.Cursor.ID)
+	}
+
+	query := fmt.Sprintf("SELECT %s, CAST(%s AS CHAR), id FROM %s%s ORDER BY %s %s, id %s",
+		columns, sortColumn, p.spec.Table, p.whereSQL(keyset...), sortColumn, dir, dir)
+	if p.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", p.Limit+1)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	items := make([]interface{}, 0, p.Limit)
+	var last pageCursor
+	hasMore := false
+	for rows.Next() {
+		if p.Limit > 0 && len(items) == p.Limit {
+			hasMore = true
+			break
+		}
+		item, dest := scan()
+		var sortValue sql.NullString
+		var id int64
+		if err := rows.Scan(append(dest, &sortValue, &id)...); err != nil {
+			return Page{}, err
+		}
+		items = append(items, item)
+		last = pageCursor{Value: sortValue.String, ID: id}
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	page := Page{Data: items}
+	if hasMore {
+		page.NextCursor = encodeCursor(last)
+	}
+
+	// Total hanya dihitung di halaman pertama agar halaman berikutnya tetap cepat
+	if p.Cursor == nil {
+		var total int
+		if err := db.QueryRow("SELECT COUNT(*) FROM "+p.spec.Table+p.whereSQL(), p.args...).Scan(&total); err != nil {
+			return Page{}, err
+		}
+		page.Total = &total
+	}
+	return page, nil
+}
+
+// Stream menjalankan SELECT tanpa limit dan memanggil fn untuk setiap baris,
+// dipakai untuk export data yang besar tanpa memuat semuanya ke memori
+func (p *pageRequest) Stream(db *sql.DB, columns []string, fn func(values []string) error) error {
+	sortColumn := p.spec.Sortable[p.Sort]
+	dir := "ASC"
+	if p.Desc {
+		dir = "DESC"
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, id %s",
+		strings.Join(columns, ", "), p.spec.Table, p.whereSQL(), sortColumn, dir, dir)
+	rows, err := db.Query(query, p.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	raw := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	values := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i := range raw {
+			values[i] = raw[i].String
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func encodeCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(raw string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Kirim halaman hasil list. Path lama (deprecated) tetap menerima array
+// polos seperti sebelumnya agar frontend lama tidak rusak; jika client
+// memakai ?limit= di path lama, halaman berikutnya ditunjuk lewat header Link.
+func writePage(w http.ResponseWriter, r *http.Request, page Page) {
+	if isLegacyRequest(r) {
+		if page.NextCursor != "" {
+			next := *r.URL
+			q := next.Query()
+			q.Set("cursor", page.NextCursor)
+			next.RawQuery = q.Encode()
+			w.Header().Add("Link", "<"+next.RequestURI()+`>; rel="next"`)
+		}
+		writeJSON(w, http.StatusOK, page.Data)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
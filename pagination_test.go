@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Menjalankan satu list contacts dengan n baris hasil query, query yang
+// diharapkan dicocokkan dengan pattern
+func listTestPage(t *testing.T, target string, legacy bool, pattern string, n int) *httptest.ResponseRecorder {
+	t.Helper()
+	mock := useMockDB(t)
+	rows := sqlmock.NewRows([]string{"email", "sort", "id"})
+	for i := 1; i <= n; i++ {
+		rows.AddRow("a@example.com", i, i)
+	}
+	mock.ExpectQuery(pattern).WillReturnRows(rows)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM contacts`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+
+	r := httptest.NewRequest("GET", target, nil)
+	if legacy {
+		r = r.WithContext(context.WithValue(r.Context(), legacyRequestKey, true))
+	}
+	p, errs := parsePageRequest(r, listSpec{Table: "contacts", Sortable: map[string]string{"id": "id"}, DefaultSort: "id"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	db := setupDatabase()
+	defer db.Close()
+	page, err := p.Query(db, "email", func() (interface{}, []interface{}) {
+		var email string
+		return &email, []interface{}{&email}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	writePage(rec, r, page)
+	return rec
+}
+
+func TestLegacyListReturnsEverything(t *testing.T) {
+	n := maxPageLimit + 5
+	rec := listTestPage(t, "/api/contact", true, `ORDER BY id ASC, id ASC$`, n)
+	if got := strings.Count(rec.Body.String(), "a@example.com"); got != n {
+		t.Fatalf("legacy list returned %d items, want %d", got, n)
+	}
+	if link := rec.Header().Get("Link"); link != "" {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+}
+
+func TestLegacyListWithLimitLinksNextPage(t *testing.T) {
+	rec := listTestPage(t, "/api/contact?limit=2", true, `LIMIT 3$`, 3)
+	if !strings.HasPrefix(rec.Body.String(), "[") {
+		t.Fatalf("legacy list is not a bare array: %s", rec.Body)
+	}
+	link := rec.Header().Get("Link")
+	if !strings.HasPrefix(link, "</api/contact?cursor=") || !strings.Contains(link, "limit=2") || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("Link = %q", link)
+	}
+}
+
+func TestListUsesDefaultLimit(t *testing.T) {
+	rec := listTestPage(t, "/contacts", false, `LIMIT 51$`, 1)
+	if !strings.HasPrefix(rec.Body.String(), `{"data":`) {
+		t.Fatalf("list is not wrapped in a page envelope: %s", rec.Body)
+	}
+}
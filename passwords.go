@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Kebijakan dan hashing password. Diatur lewat env:
+//
+//	PASSWORD_MIN_LENGTH  panjang minimal (default 10)
+//	PASSWORD_HISTORY     jumlah password lama yang tidak boleh dipakai ulang (default 5)
+//	PASSWORD_HASH        bcrypt atau argon2id (default bcrypt)
+//	BCRYPT_COST          cost bcrypt (default 12)
+//	ARGON2_MEMORY_KB, ARGON2_TIME, ARGON2_THREADS  parameter argon2id
+//	BREACHED_PASSWORDS_FILE  daftar password bocor tambahan, satu per baris
+//
+// Jika algoritma atau parameter diubah, hash lama tetap bisa dipakai login
+// dan otomatis di-hash ulang dengan konfigurasi baru saat login berhasil.
+type PasswordConfig struct {
+	MinLength     int
+	History       int
+	Algorithm     string
+	BcryptCost    int
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+}
+
+const (
+	hashBcrypt   = "bcrypt"
+	hashArgon2id = "argon2id"
+)
+
+// bcrypt hanya memakai 72 byte pertama dari password
+const bcryptMaxBytes = 72
+
+func loadPasswordConfig() PasswordConfig {
+	return PasswordConfig{
+		MinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 10),
+		History:       getEnvInt("PASSWORD_HISTORY", 5),
+		Algorithm:     getEnv("PASSWORD_HASH", hashBcrypt),
+		BcryptCost:    getEnvInt("BCRYPT_COST", 12),
+		Argon2Memory:  uint32(getEnvInt("ARGON2_MEMORY_KB", 64*1024)),
+		Argon2Time:    uint32(getEnvInt("ARGON2_TIME", 3)),
+		Argon2Threads: uint8(getEnvInt("ARGON2_THREADS", 4)),
+	}
+}
+
+var passwordConfig = loadPasswordConfig()
+
+// Password yang pernah bocor. Daftar bawaan berisi sekitar 7 ribu password
+// teratas dari kebocoran publik; daftar yang lebih besar bisa ditambahkan
+// saat start lewat BREACHED_PASSWORDS_FILE.
+//
+//go:embed data/breached-passwords.txt
+var breachedPasswordsFile string
+
+var breachedPasswords = map[string]bool{}
+
+func init() {
+	addBreachedPasswords(strings.NewReader(breachedPasswordsFile))
+}
+
+// Menambahkan isi daftar (satu password per baris) ke breachedPasswords
+func addBreachedPasswords(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breachedPasswords[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// Memuat daftar kebocoran tambahan dari file, dipanggil sekali saat start
+func loadBreachedPasswordsFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return addBreachedPasswords(file)
+}
+
+// Mengecek password baru terhadap kebijakan, mengembalikan pesan error
+// untuk field password atau "" jika lolos
+func checkPasswordPolicy(password, username string) string {
+	if utf8.RuneCountInString(password) < passwordConfig.MinLength {
+		return fmt.Sprintf("must be at least %d characters", passwordConfig.MinLength)
+	}
+	if passwordConfig.Algorithm == hashBcrypt && len(password) > bcryptMaxBytes {
+		return fmt.Sprintf("must be at most %d bytes", bcryptMaxBytes)
+	}
+	if utf8.RuneCountInString(password) > 128 {
+		return "must be at most 128 characters"
+	}
+	lower := strings.ToLower(password)
+	if name := strings.ToLower(strings.TrimSpace(username)); len(name) >= 3 && strings.Contains(lower, name) {
+		return "must not contain the username"
+	}
+	if breachedPasswords[lower] {
+		return "appears in a list of breached passwords, choose another one"
+	}
+	return ""
+}
+
+// Membuat hash dengan algoritma yang sedang dikonfigurasi
+func hashPassword(password string) (string, error) {
+	if passwordConfig.Algorithm == hashArgon2id {
+		return hashArgon2(password, passwordConfig)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordConfig.BcryptCost)
+	return string(hash), err
+}
+
+// Format PHC: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func hashArgon2(password string, cfg PasswordConfig) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Time, cfg.Argon2Memory, cfg.Argon2Threads, 32)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		cfg.Argon2Memory, cfg.Argon2Time, cfg.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func parseArgon2Hash(hash string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != hashArgon2id {
+		return p, fmt.Errorf("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, fmt.Errorf("invalid argon2id parameters")
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, err
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// Mencocokkan password dengan hash bcrypt atau argon2id. needsRehash true
+// jika hash cocok tetapi dibuat dengan algoritma atau parameter lama.
+func verifyPassword(password, hash string) (ok, needsRehash bool) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		p, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false, false
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		if subtle.ConstantTimeCompare(key, p.key) != 1 {
+			return false, false
+		}
+		cfg := passwordConfig
+		return true, cfg.Algorithm != hashArgon2id ||
+			p.memory != cfg.Argon2Memory || p.time != cfg.Argon2Time || p.threads != cfg.Argon2Threads
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false, false
+	}
+	cost, _ := bcrypt.Cost([]byte(hash))
+	return true, passwordConfig.Algorithm != hashBcrypt || cost != passwordConfig.BcryptCost
+}
+
+// Hash ulang setelah login berhasil. Gagal di sini tidak menggagalkan login.
+func rehashPassword(r *http.Request, db *sql.DB, userID int, password string) {
+	hash, err := hashPassword(password)
+	if err == nil {
+		_, err = db.Exec("UPDATE users SET password = ? WHERE id = ?", hash, userID)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to rehash password", "error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "password rehashed", "user_id", userID, "algorithm", passwordConfig.Algorithm)
+}
+
+// true jika password sama dengan password saat ini atau salah satu dari
+// PASSWORD_HISTORY password sebelumnya
+func passwordReused(db *sql.DB, userID int, password string) (bool, error) {
+	hashes := []string{}
+	var current string
+	if err := db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&current); err != nil {
+		return false, err
+	}
+	hashes = append(hashes, current)
+
+	rows, err := db.Query("SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?",
+		userID, passwordConfig.History)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, hash := range hashes {
+		if ok, _ := verifyPassword(password, hash); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Mengganti password: hash lama masuk ke riwayat dan riwayat dipangkas
+// sesuai PASSWORD_HISTORY
+func setPassword(tx *sql.Tx, userID int, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO password_history (user_id, password_hash) SELECT id, password FROM users WHERE id = ? AND password <> ''", userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ?, must_change_password = 0 WHERE id = ?", hash, userID); err != nil {
+		return err
+	}
+	// Hapus riwayat di luar N terbaru
+	_, err = tx.Exec(`
+		DELETE FROM password_history WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM (SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?) keep
+		)`, userID, userID, passwordConfig.History)
+	return err
+}
+
+// Payload POST /me/password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+const auditPasswordChanged = "password.changed"
+
+// Handler untuk POST /me/password
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	user, err := getUserByUsername(db, currentUsername(r))
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Account no longer exists")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	// Percobaan password saat ini ikut dihitung oleh lockout login, supaya
+	// token yang dicuri tidak bisa dipakai menebak password
+	if !checkLockout(w, r, normalizeUsername(user.Username)) {
+		return
+	}
+	if ok, _ := verifyPassword(req.CurrentPassword, user.Password); !ok {
+		if _, err := authLimiter.RecordFailure(r.Context(), normalizeUsername(user.Username), authGuard.Lockout); err != nil {
+			slog.ErrorContext(r.Context(), "failed to record login failure", "error", err)
+		}
+		writeValidationError(w, r, map[string]string{"current_password": "is incorrect"})
+		return
+	}
+	if msg := checkPasswordPolicy(req.NewPassword, user.Username); msg != "" {
+		writeValidationError(w, r, map[string]string{"new_password": msg})
+		return
+	}
+	reused, err := passwordReused(db, user.ID, req.NewPassword)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if reused {
+		writeValidationError(w, r, map[string]string{
+			"new_password": fmt.Sprintf("must not match any of your last %d passwords", passwordConfig.History+1),
+		})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	if err := setPassword(tx, user.ID, req.NewPassword); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	// Token yang mungkin sudah dicuri tidak boleh tetap berlaku
+	if err := revokeOtherSessions(tx, user.ID, currentClaims(r).SessionID, user.Username); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditPasswordChanged, user.Username, "")
+
+	writeMessage(w, http.StatusOK, "Password changed")
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	for password, want := range map[string]string{
+		"Password123":          "appears in a list of breached passwords, choose another one",
+		"budi-rahasia-2026":    "must not contain the username",
+		"kopi-pagi-di-lantai3": "",
+	} {
+		if got := checkPasswordPolicy(password, "budi"); got != want {
+			t.Errorf("checkPasswordPolicy(%q) = %q, want %q", password, got, want)
+		}
+	}
+}
+
+func TestBreachedPasswordsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte("# komentar\nKopi-Pagi-Di-Lantai3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(breachedPasswords, "kopi-pagi-di-lantai3") })
+
+	if len(breachedPasswords) < 5000 {
+		t.Errorf("embedded list has %d entries", len(breachedPasswords))
+	}
+	if err := loadBreachedPasswordsFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkPasswordPolicy("kopi-pagi-di-lantai3", "budi"); got == "" {
+		t.Error("password from the extra list accepted")
+	}
+	if err := loadBreachedPasswordsFile(filepath.Join(t.TempDir(), "hilang.txt")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestVerifyPasswordNeedsRehash(t *testing.T) {
+	useFastHashing(t)
+	const password = "kopi-pagi-di-lantai3"
+	bcryptHash, err := hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHash, err := hashArgon2(password, passwordConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		hash   string
+		change func(*PasswordConfig)
+		rehash bool
+	}{
+		{"bcrypt unchanged", bcryptHash, func(*PasswordConfig) {}, false},
+		{"bcrypt cost raised", bcryptHash, func(c *PasswordConfig) { c.BcryptCost++ }, true},
+		{"bcrypt to argon2id", bcryptHash, func(c *PasswordConfig) { c.Algorithm = hashArgon2id }, true},
+		{"argon2id unchanged", argonHash, func(c *PasswordConfig) { c.Algorithm = hashArgon2id }, false},
+		{"argon2id memory", argonHash, func(c *PasswordConfig) { c.Algorithm, c.Argon2Memory = hashArgon2id, 128 }, true},
+		{"argon2id time", argonHash, func(c *PasswordConfig) { c.Algorithm, c.Argon2Time = hashArgon2id, 2 }, true},
+		{"argon2id threads", argonHash, func(c *PasswordConfig) { c.Algorithm, c.Argon2Threads = hashArgon2id, 2 }, true},
+		{"argon2id to bcrypt", argonHash, func(*PasswordConfig) {}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := passwordConfig
+			defer func() { passwordConfig = prev }()
+			tc.change(&passwordConfig)
+
+			ok, rehash := verifyPassword(password, tc.hash)
+			if !ok || rehash != tc.rehash {
+				t.Errorf("verifyPassword = %v, %v, want true, %v", ok, rehash, tc.rehash)
+			}
+			if ok, rehash := verifyPassword("salah", tc.hash); ok || rehash {
+				t.Errorf("wrong password: verifyPassword = %v, %v", ok, rehash)
+			}
+		})
+	}
+}
+
+func TestPasswordReused(t *testing.T) {
+	useFastHashing(t)
+	hashes := map[string]string{}
+	for _, password := range []string{"password-sekarang", "password-lama-1", "password-lama-2"} {
+		hash, err := hashPassword(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[password] = hash
+	}
+
+	for password, want := range map[string]bool{
+		"password-sekarang": true,
+		"password-lama-2":   true,
+		"password-baru":     false,
+	} {
+		t.Run(password, func(t *testing.T) {
+			mock := useMockDB(t)
+			mock.ExpectQuery("SELECT password FROM users WHERE id = ?").WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(hashes["password-sekarang"]))
+			mock.ExpectQuery("SELECT password_hash FROM password_history").WithArgs(7, passwordConfig.History).
+				WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).
+					AddRow(hashes["password-lama-1"]).AddRow(hashes["password-lama-2"]))
+
+			db := setupDatabase()
+			defer db.Close()
+			got, err := passwordReused(db, 7, password)
+			if err != nil || got != want {
+				t.Errorf("passwordReused = %v, %v, want %v", got, err, want)
+			}
+		})
+	}
+}
+
+func TestSetPasswordTrimsHistory(t *testing.T) {
+	useFastHashing(t)
+	passwordConfig.History = 3
+	hash := &captureArg{}
+	mock := useMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO password_history").WithArgs(7).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE users SET password = \\?, must_change_password = 0").WithArgs(hash, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Hanya N riwayat terbaru yang disimpan
+	mock.ExpectExec("DELETE FROM password_history WHERE user_id = \\? AND id NOT IN").WithArgs(7, 7, 3).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	db := setupDatabase()
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setPassword(tx, 7, "kopi-pagi-di-lantai3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := verifyPassword("kopi-pagi-di-lantai3", hash.value); !ok {
+		t.Error("stored hash does not match the new password")
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Mode pendaftaran mandiri, diatur admin lewat PUT /admin/registration:
+//
+//	closed    tidak bisa mendaftar sendiri, akun dibuat admin (import/undangan)
+//	invite    wajib memakai kode undangan sekali pakai dari admin
+//	approval  siapa saja boleh mendaftar, tetapi akun menunggu persetujuan admin
+//
+// Role tidak pernah dipilih sendiri oleh pendaftar: role berasal dari kode
+// undangan atau ditentukan admin saat menyetujui.
+const (
+	registrationClosed   = "closed"
+	registrationInvite   = "invite"
+	registrationApproval = "approval"
+)
+
+const (
+	userStatusActive  = "active"
+	userStatusPending = "pending"
+)
+
+const (
+	roleAdmin  = "admin"
+	roleMember = "anggota"
+)
+
+const (
+	auditUserRegistered  = "user.registered"
+	auditUserApproved    = "user.approved"
+	auditUserRejected    = "user.rejected"
+	auditInviteCreated   = "invite.created"
+	auditInviteRevoked   = "invite.revoked"
+	auditRegistrationSet = "registration.mode_changed"
+)
+
+// Payload POST /register
+type RegisterRequest struct {
+	Username   string `json:"username" validate:"required,min=3,max=50"`
+	Fullname   string `json:"fullname" validate:"required,max=100"`
+	Password   string `json:"password" validate:"required"`
+	Division   string `json:"division" validate:"max=100"`
+	InviteCode string `json:"invite_code" validate:"max=64"`
+}
+
+type RegistrationSettings struct {
+	Mode string `json:"mode" validate:"required,oneof=closed invite approval"`
+}
+
+// RegistrationInvite adalah kode undangan pendaftaran. Code hanya dikirim
+// sekali saat dibuat; database hanya menyimpan hash-nya.
+type RegistrationInvite struct {
+	ID        int64  `json:"id"`
+	Code      string `json:"code,omitempty"`
+	Role      string `json:"role"`
+	Division  string `json:"division"`
+	Note      string `json:"note,omitempty"`
+	CreatedBy string `json:"created_by"`
+	ExpiresAt string `json:"expires_at"`
+	UsedAt    string `json:"used_at,omitempty"`
+	UsedBy    string `json:"used_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CreateInviteRequest struct {
+	Role           string `json:"role" validate:"required,oneof=admin anggota"`
+	Division       string `json:"division" validate:"max=100"`
+	Note           string `json:"note" validate:"max=255"`
+	ExpiresInHours int    `json:"expires_in_hours"`
+}
+
+// Payload POST /admin/users/{id}/approve. Role dan divisi opsional,
+// default role anggota dan divisi yang diisi pendaftar.
+type ApproveUserRequest struct {
+	Role     string `json:"role" validate:"oneof=admin anggota"`
+	Division string `json:"division" validate:"max=100"`
+}
+
+// Mode dari tabel app_settings, atau REGISTRATION_MODE jika admin belum pernah mengubahnya
+func registrationMode(db *sql.DB) (string, error) {
+	return getSetting(db, "registration_mode", getEnv("REGISTRATION_MODE", registrationApproval))
+}
+
+func getSetting(db *sql.DB, name, fallback string) (string, error) {
+	var value string
+	err := db.QueryRow("SELECT value FROM app_settings WHERE name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	}
+	return value, err
+}
+
+func setSetting(db *sql.DB, name, value, updatedBy string) error {
+	_, err := db.Exec(`
+		INSERT INTO app_settings (name, value, updated_by) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value), updated_by = VALUES(updated_by)`, name, value, updatedBy)
+	return err
+}
+
+// Register user handler
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	errs := validateStruct(req)
+	if _, ok := errs["password"]; !ok {
+		if msg := checkPasswordPolicy(req.Password, req.Username); msg != "" {
+			errs["password"] = msg
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	mode, err := registrationMode(db)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	switch mode {
+	case registrationClosed:
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Self-registration is closed, please contact an administrator")
+		return
+	case registrationInvite:
+		if req.InviteCode == "" {
+			writeValidationError(w, r, map[string]string{"invite_code": "is required"})
+			return
+		}
+	}
+
+	hashedPassword, err := hashPassword(req.Password)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	user := User{
+		Username: req.Username,
+		Fullname: req.Fullname,
+		Password: hashedPassword,
+		Role:     roleMember,
+		Division: req.Division,
+		Status:   userStatusPending,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var inviteID int64
+	if mode == registrationInvite {
+		err = tx.QueryRow(`
+			SELECT id, role, division FROM registration_invites
+			WHERE code_hash = ? AND used_at IS NULL AND expires_at > NOW()
+			FOR UPDATE`, sha256Hex(req.InviteCode)).Scan(&inviteID, &user.Role, &user.Division)
+		if err == sql.ErrNoRows {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invite code is invalid or has expired")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		user.Status = userStatusActive
+	}
+
+	userID, err := registerUser(tx, user)
+	if errors.Is(err, errUsernameRegistered) {
+		writeError(w, r, http.StatusConflict, codeConflict, "Username is already registered")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	user.ID = int(userID)
+
+	if inviteID != 0 {
+		if _, err := tx.Exec("UPDATE registration_invites SET used_at = NOW(), used_by = ? WHERE id = ?", userID, inviteID); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	detail := "mode=" + mode
+	if inviteID != 0 {
+		detail += " invite=" + strconv.FormatInt(inviteID, 10)
+	}
+	recordAudit(db, r, auditUserRegistered, user.Username, detail)
+
+	user.Password = ""
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// execer dipenuhi *sql.DB dan *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+var errUsernameRegistered = errors.New("username is already registered")
+
+func registerUser(db execer, user User) (int64, error) {
+	result, err := db.Exec("INSERT INTO users (username, fullname, password, role, division, status) VALUES (?, ?, ?, ?, ?, ?)",
+		user.Username, user.Fullname, user.Password, user.Role, user.Division, user.Status)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		return 0, errUsernameRegistered
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Middleware untuk route dengan Auth "active": seperti verifyToken, tetapi
+// akun yang masih menunggu persetujuan admin ditolak. Status dibaca dari
+// database supaya persetujuan langsung berlaku tanpa login ulang.
+func verifyActiveUser(next http.HandlerFunc) http.HandlerFunc {
+	return verifyToken(func(w http.ResponseWriter, r *http.Request) {
+		db := setupDatabase()
+		defer db.Close()
+
+		var status string
+		err := db.QueryRow("SELECT status FROM users WHERE username = ?", currentUsername(r)).Scan(&status)
+		if err == sql.ErrNoRows {
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Account no longer exists")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		if status != userStatusActive {
+			writeError(w, r, http.StatusForbidden, codeAccountPending, "Account is awaiting admin approval")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler untuk GET /registration, dipakai frontend untuk menampilkan form yang sesuai
+func getRegistrationModeHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	mode, err := registrationMode(db)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RegistrationSettings{Mode: mode})
+}
+
+// Handler untuk PUT /admin/registration
+func updateRegistrationModeHandler(w http.ResponseWriter, r *http.Request) {
+	var settings RegistrationSettings
+	if !decodeJSON(w, r, &settings) {
+		return
+	}
+	if errs := validateStruct(settings); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	if err := setSetting(db, "registration_mode", settings.Mode, currentUsername(r)); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditRegistrationSet, "", "mode="+settings.Mode)
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// Handler untuk POST /admin/invites
+func createInviteHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateInviteRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	errs := validateStruct(req)
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = 72
+	}
+	if req.ExpiresInHours < 1 || req.ExpiresInHours > 24*30 {
+		errs["expires_in_hours"] = "must be between 1 and 720"
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	code, err := randomPassword(12)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec(`
+		INSERT INTO registration_invites (code_hash, role, division, note, created_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		sha256Hex(code), req.Role, req.Division, req.Note, currentUsername(r), expiresAt.Format(jobTimeLayout))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditInviteCreated, "", fmt.Sprintf("invite=%d role=%s", id, req.Role))
+
+	writeJSON(w, http.StatusCreated, RegistrationInvite{
+		ID:        id,
+		Code:      code,
+		Role:      req.Role,
+		Division:  req.Division,
+		Note:      req.Note,
+		CreatedBy: currentUsername(r),
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	})
+}
+
+var inviteListSpec = listSpec{
+	Table:       "registration_invites",
+	Sortable:    map[string]string{"id": "id", "expires_at": "expires_at"},
+	DefaultSort: "id",
+	// Filter: ?state=unused|used|expired
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		switch r.URL.Query().Get("state") {
+		case "":
+		case "unused":
+			p.Filter("used_at IS NULL AND expires_at > NOW()")
+		case "used":
+			p.Filter("used_at IS NOT NULL")
+		case "expired":
+			p.Filter("used_at IS NULL AND expires_at <= NOW()")
+		default:
+			errs["state"] = "must be one of: unused, used, expired"
+		}
+	},
+}
+
+// Handler untuk GET /admin/invites, terbaru lebih dulu
+func getInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePageRequest(r, inviteListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if r.URL.Query().Get("sort") == "" {
+		page.Desc = true
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := page.Query(db, `id, role, division, note, created_by, CAST(expires_at AS CHAR),
+		COALESCE(CAST(used_at AS CHAR), ''), COALESCE((SELECT username FROM users WHERE users.id = used_by), ''), CAST(created_at AS CHAR)`,
+		func() (interface{}, []interface{}) {
+			inv := &RegistrationInvite{}
+			return inv, []interface{}{&inv.ID, &inv.Role, &inv.Division, &inv.Note, &inv.CreatedBy, &inv.ExpiresAt, &inv.UsedAt, &inv.UsedBy, &inv.CreatedAt}
+		})
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writePage(w, r, result)
+}
+
+// Handler untuk DELETE /admin/invites/{id}, hanya undangan yang belum dipakai
+func revokeInviteHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec("DELETE FROM registration_invites WHERE id = ? AND used_at IS NULL", r.PathValue("id"))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Invite not found or already used")
+		return
+	}
+	recordAudit(db, r, auditInviteRevoked, "", "invite="+r.PathValue("id"))
+
+	writeMessage(w, http.StatusOK, "Invite revoked")
+}
+
+// Handler untuk POST /admin/users/{id}/approve
+func approveUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req ApproveUserRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if req.Role == "" {
+		req.Role = roleMember
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec(`
+		UPDATE users SET status = ?, role = ?, division = IF(? = '', division, ?)
+		WHERE id = ? AND status = ?`,
+		userStatusActive, req.Role, req.Division, req.Division, r.PathValue("id"), userStatusPending)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No pending user with this ID")
+		return
+	}
+
+	var user User
+	err = db.QueryRow("SELECT id, username, fullname, role, division, status FROM users WHERE id = ?", r.PathValue("id")).
+		Scan(&user.ID, &user.Username, &user.Fullname, &user.Role, &user.Division, &user.Status)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditUserApproved, user.Username, "role="+user.Role)
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Handler untuk POST /admin/users/{id}/reject, akun pending dihapus
+func rejectUserHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	var username string
+	err := db.QueryRow("SELECT username FROM users WHERE id = ? AND status = ?", r.PathValue("id"), userStatusPending).Scan(&username)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No pending user with this ID")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if _, err := db.Exec("DELETE FROM users WHERE id = ? AND status = ?", r.PathValue("id"), userStatusPending); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditUserRejected, username, "")
+
+	writeMessage(w, http.StatusOK, "Registration rejected")
+}
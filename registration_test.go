@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func expectRegistrationMode(mock sqlmock.Sqlmock, mode string) {
+	mock.ExpectQuery("SELECT value FROM app_settings WHERE name = ?").WithArgs("registration_mode").
+		WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow(mode))
+}
+
+func register(body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	registerHandler(rec, httptest.NewRequest("POST", "/register", strings.NewReader(body)))
+	return rec
+}
+
+const registerBody = `{"username":"budi","fullname":"Budi Santoso","password":"kopi-pagi-di-lantai3","division":"IT"`
+
+func TestRegisterClosed(t *testing.T) {
+	useFastHashing(t)
+	mock := useMockDB(t)
+	expectRegistrationMode(mock, registrationClosed)
+
+	if rec := register(registerBody + `}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRegisterApproval(t *testing.T) {
+	useFastHashing(t)
+	mock := useMockDB(t)
+	expectRegistrationMode(mock, registrationApproval)
+	mock.ExpectBegin()
+	// Role dari request tidak pernah dipakai, akun menunggu persetujuan
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("budi", "Budi Santoso", sqlmock.AnyArg(), roleMember, "IT", userStatusPending).
+		WillReturnResult(sqlmock.NewResult(12, 1))
+	mock.ExpectCommit()
+	expectAudit(mock, auditUserRegistered)
+
+	rec := register(registerBody + `,"role":"admin"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var user User
+	if err := json.Unmarshal(rec.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 12 || user.Status != userStatusPending || user.Role != roleMember || user.Password != "" {
+		t.Errorf("user = %+v", user)
+	}
+}
+
+func TestRegisterInvite(t *testing.T) {
+	useFastHashing(t)
+	invite := regexp.QuoteMeta("SELECT id, role, division FROM registration_invites")
+
+	t.Run("code required", func(t *testing.T) {
+		mock := useMockDB(t)
+		expectRegistrationMode(mock, registrationInvite)
+		if rec := register(registerBody + `}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invite_code") {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("unknown or used code", func(t *testing.T) {
+		mock := useMockDB(t)
+		expectRegistrationMode(mock, registrationInvite)
+		mock.ExpectBegin()
+		mock.ExpectQuery(invite).WithArgs(sha256Hex("kode-lama")).WillReturnRows(sqlmock.NewRows([]string{"id", "role", "division"}))
+		mock.ExpectRollback()
+		if rec := register(registerBody + `,"invite_code":"kode-lama"}`); rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("valid code", func(t *testing.T) {
+		mock := useMockDB(t)
+		expectRegistrationMode(mock, registrationInvite)
+		mock.ExpectBegin()
+		mock.ExpectQuery(invite).WithArgs(sha256Hex("kode-baru")).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "role", "division"}).AddRow(3, roleAdmin, "Keuangan"))
+		// Role dan divisi dari undangan, akun langsung aktif
+		mock.ExpectExec("INSERT INTO users").
+			WithArgs("budi", "Budi Santoso", sqlmock.AnyArg(), roleAdmin, "Keuangan", userStatusActive).
+			WillReturnResult(sqlmock.NewResult(12, 1))
+		mock.ExpectExec("UPDATE registration_invites SET used_at = NOW\\(\\), used_by = \\?").WithArgs(12, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectAudit(mock, auditUserRegistered)
+
+		rec := register(registerBody + `,"invite_code":"kode-baru"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+		var user User
+		json.Unmarshal(rec.Body.Bytes(), &user)
+		if user.Status != userStatusActive || user.Role != roleAdmin || user.Division != "Keuangan" {
+			t.Errorf("user = %+v", user)
+		}
+	})
+}
+
+func TestRegisterInsertErrors(t *testing.T) {
+	useFastHashing(t)
+	for _, tc := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"duplicate username", &mysql.MySQLError{Number: mysqlErrDuplicateEntry, Message: "Duplicate entry 'budi' for key 'username'"}, http.StatusConflict},
+		{"other mysql error", &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'division'"}, http.StatusInternalServerError},
+		{"connection lost", errors.New("invalid connection"), http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := useMockDB(t)
+			expectRegistrationMode(mock, registrationApproval)
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO users").WillReturnError(tc.err)
+			mock.ExpectRollback()
+
+			if rec := register(registerBody + `}`); rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestApprovePendingUser(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectExec("UPDATE users SET status = \\?, role = \\?").
+		WithArgs(userStatusActive, roleMember, "", "", "12", userStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT id, username, fullname, role, division, status FROM users WHERE id = ?").WithArgs("12").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "fullname", "role", "division", "status"}).
+			AddRow(12, "budi", "Budi Santoso", roleMember, "IT", userStatusActive))
+	expectAudit(mock, auditUserApproved)
+	// Akun yang sudah aktif atau tidak ada
+	mock.ExpectExec("UPDATE users SET status = \\?, role = \\?").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		req := httptest.NewRequest("POST", "/admin/users/12/approve", strings.NewReader(`{}`))
+		req.SetPathValue("id", "12")
+		rec := httptest.NewRecorder()
+		approveUserHandler(rec, req)
+		if rec.Code != want {
+			t.Errorf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+)
+
+// Kode error yang dikirim ke client di field "code"
+const (
+	codeBadRequest             = "bad_request"
+	codeValidation             = "validation_failed"
+	codeUnauthorized           = "unauthorized"
+	codeForbidden              = "forbidden"
+	codeNotFound               = "not_found"
+	codeMethodNotAllowed       = "method_not_allowed"
+	codeConflict               = "conflict"
+	codeRateLimited            = "rate_limited"
+	codeAccountLocked          = "account_locked"
+	codeAccountPending         = "account_pending"
+	codeTwoFactorRequired      = "two_factor_required"
+	codePasswordChangeRequired = "password_change_required"
+	codeInsufficientScope      = "insufficient_scope"
+	codeUnavailable            = "service_unavailable"
+	codeInternal               = "internal_error"
+)
+
+// APIError adalah format error standar untuk semua endpoint
+type APIError struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "request_id"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._\-]{1,64}$`)
+
+// Middleware untuk memberi setiap request sebuah ID, diambil dari header
+// X-Request-ID jika client sudah mengirimkannya
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// ID dari client hanya dipakai jika formatnya aman untuk ditulis ke log
+		requestID := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+func requestIDFrom(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// Kirim response JSON dengan status code tertentu
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// MessageResponse adalah response sukses sederhana tanpa data
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// Kirim pesan sukses sederhana, contoh: {"message": "Event deleted successfully"}
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, MessageResponse{Message: message})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeJSON(w, status, errorEnvelope{Error: APIError{
+		Code:      code,
+		Message:   message,
+		RequestID: requestIDFrom(r),
+	}})
+}
+
+// Error validasi dengan detail per field
+func writeValidationError(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	writeJSON(w, http.StatusBadRequest, errorEnvelope{Error: APIError{
+		Code:      codeValidation,
+		Message:   "Request validation failed",
+		Fields:    fields,
+		RequestID: requestIDFrom(r),
+	}})
+}
+
+// Error internal (misalnya dari database) dicatat di log server saja,
+// client hanya menerima pesan umum beserta request ID untuk pelacakan
+func writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "internal error", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeError(w, r, http.StatusInternalServerError, codeInternal, "Internal server error")
+}
+
+// Decode body JSON, kirim error bad_request jika body tidak valid
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid JSON body")
+		return false
+	}
+	return true
+}
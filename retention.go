@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Retensi logactivity: booking yang lebih lama dari RETENTION_MONTHS bulan
+// dipindahkan ke tabel logactivity_archive atau ke file JSONL terkompresi.
+// Rollup analitik untuk hari-hari tersebut dibuat dulu dan tetap disimpan.
+
+const (
+	archiveTargetTable = "table"
+	archiveTargetFile  = "file"
+)
+
+var (
+	retentionMonths = getEnvInt("RETENTION_MONTHS", 12)
+	archiveTarget   = getEnv("RETENTION_TARGET", archiveTargetTable)
+	archiveDir      = getEnv("ARCHIVE_DIR", "archive")
+	// Rentang yang di-restore ditahan selama ini supaya tidak langsung
+	// diarsipkan lagi oleh job retention malam berikutnya
+	restoreHold = getEnvDuration("ARCHIVE_RESTORE_HOLD", 90*24*time.Hour)
+)
+
+// Kondisi booking yang boleh diarsipkan: sebelum cutoff dan tidak berada
+// di rentang restore yang masih ditahan
+const archivableCondition = `booked_for < ? AND NOT EXISTS (
+	SELECT 1 FROM archive_holds h
+	WHERE logactivity.booked_for BETWEEN h.from_date AND h.to_date AND h.hold_until > NOW())`
+
+// Kolom logactivity yang dipindahkan ke arsip
+var logActivityColumns = []string{
+	"id", "namalengkap", "nama_divisi", "selected_seat", "status",
+	"created_at", "booked_for", "checked_in_at", "cancelled_at", "user_id",
+}
+
+// ArchiveRun adalah catatan satu kali proses pengarsipan
+type ArchiveRun struct {
+	ID           int    `json:"id"`
+	Target       string `json:"target"`
+	Location     string `json:"location,omitempty"`
+	FromDate     string `json:"from_date,omitempty"`
+	ToDate       string `json:"to_date"`
+	RowCount     int    `json:"row_count"`
+	RestoredRows int    `json:"restored_rows"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type RestoreRequest struct {
+	From string `json:"from" validate:"required,date"`
+	To   string `json:"to" validate:"required,date"`
+}
+
+type RestoreResult struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Restored  int    `json:"restored"`
+	HoldUntil string `json:"hold_until"`
+}
+
+// Tanggal pertama yang masih disimpan di logactivity. Rollup untuk hari
+// sebelum tanggal ini tidak boleh dihitung ulang karena data mentahnya
+// sudah diarsipkan.
+func retentionCutoff() time.Time {
+	today, _ := time.Parse(dateLayout, time.Now().Format(dateLayout))
+	return today.AddDate(0, -retentionMonths, 0)
+}
+
+// Memindahkan booking sebelum cutoff ke arsip
+func archiveLogActivity(db *sql.DB, cutoff time.Time) (ArchiveRun, error) {
+	run := ArchiveRun{Target: archiveTarget, ToDate: cutoff.AddDate(0, 0, -1).Format(dateLayout)}
+	cutoffDate := cutoff.Format(dateLayout)
+
+	// Pastikan rollup untuk hari-hari yang akan diarsipkan sudah lengkap
+	days, err := db.Query("SELECT DISTINCT booked_for FROM logactivity WHERE "+archivableCondition+" ORDER BY booked_for", cutoffDate)
+	if err != nil {
+		return run, err
+	}
+	var pending []time.Time
+	for days.Next() {
+		var day string
+		if err := days.Scan(&day); err != nil {
+			days.Close()
+			return run, err
+		}
+		parsed, _ := time.Parse(dateLayout, day[:10])
+		pending = append(pending, parsed)
+	}
+	days.Close()
+	if len(pending) == 0 {
+		return run, nil
+	}
+	for _, day := range pending {
+		if err := rollupDay(db, day); err != nil {
+			return run, err
+		}
+	}
+	run.FromDate = pending[0].Format(dateLayout)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return run, err
+	}
+	defer tx.Rollback()
+
+	columns := strings.Join(logActivityColumns, ", ")
+	if archiveTarget == archiveTargetFile {
+		run.Location, run.RowCount, err = writeArchiveFile(tx, run.FromDate, run.ToDate, cutoffDate)
+	} else {
+		var res sql.Result
+		res, err = tx.Exec(fmt.Sprintf(`
+			INSERT INTO logactivity_archive (%[1]s, archive_reason)
+			SELECT %[1]s, 'retention' FROM logactivity WHERE %[2]s`, columns, archivableCondition), cutoffDate)
+		if err == nil {
+			affected, _ := res.RowsAffected()
+			run.RowCount = int(affected)
+		}
+	}
+	if err != nil {
+		return run, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM logactivity WHERE "+archivableCondition, cutoffDate); err != nil {
+		return run, err
+	}
+	res, err := tx.Exec("INSERT INTO archive_runs (target, location, from_date, to_date, row_count) VALUES (?, ?, ?, ?, ?)",
+		run.Target, run.Location, run.FromDate, run.ToDate, run.RowCount)
+	if err != nil {
+		return run, err
+	}
+	id, _ := res.LastInsertId()
+	run.ID = int(id)
+
+	if err := tx.Commit(); err != nil {
+		// File arsip tanpa catatan di archive_runs tidak berguna, hapus lagi
+		if run.Location != "" {
+			os.Remove(run.Location)
+		}
+		return run, err
+	}
+	return run, nil
+}
+
+// Menulis booking sebelum cutoff ke file JSONL gzip. Baris dikunci dalam
+// transaksi yang sama dengan DELETE, jadi tidak ada baris yang hilang.
+func writeArchiveFile(tx *sql.Tx, from, to, cutoffDate string) (string, int, error) {
+	if err := os.MkdirAll(archiveDir, 0o750); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(archiveDir, fmt.Sprintf("logactivity_%s_%s_%d.jsonl.gz", from, to, time.Now().Unix()))
+
+	rows, err := tx.Query(fmt.Sprintf("SELECT %s FROM logactivity WHERE %s ORDER BY id FOR UPDATE",
+		strings.Join(logActivityColumns, ", "), archivableCondition), cutoffDate)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rows.Close()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return "", 0, err
+	}
+	fail := func(err error) (string, int, error) {
+		file.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+
+	gz := gzip.NewWriter(file)
+	buf := bufio.NewWriter(gz)
+	enc := json.NewEncoder(buf)
+
+	raw := make([]sql.NullString, len(logActivityColumns))
+	dest := make([]interface{}, len(raw))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fail(err)
+		}
+		record := make(map[string]*string, len(raw))
+		for i, col := range logActivityColumns {
+			if raw[i].Valid {
+				value := raw[i].String
+				record[col] = &value
+			} else {
+				record[col] = nil
+			}
+		}
+		if err := enc.Encode(record); err != nil {
+			return fail(err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return fail(err)
+	}
+	if err := buf.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := gz.Close(); err != nil {
+		return fail(err)
+	}
+	if err := file.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, count, nil
+}
+
+// Mengembalikan booking arsip dengan booked_for di antara from dan to ke
+// logactivity. Rentang tersebut ditahan sampai holdUntil supaya tidak
+// diarsipkan lagi oleh job retention.
+func restoreLogActivity(db *sql.DB, from, to string, holdUntil time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	columns := strings.Join(logActivityColumns, ", ")
+	restored := 0
+
+	if _, err := tx.Exec("INSERT INTO archive_holds (from_date, to_date, hold_until) VALUES (?, ?, ?)",
+		from, to, holdUntil.Format(time.DateTime)); err != nil {
+		return 0, err
+	}
+
+	// Dari tabel arsip. Hanya arsip retensi; log yang dihapus admin
+	// (archive_reason 'deleted') tidak ikut kembali.
+	res, err := tx.Exec(fmt.Sprintf(`
+		INSERT IGNORE INTO logactivity (%[1]s)
+		SELECT %[1]s FROM logactivity_archive
+		WHERE booked_for BETWEEN ? AND ? AND archive_reason = 'retention'`, columns), from, to)
+	if err != nil {
+		return 0, err
+	}
+	affected, _ := res.RowsAffected()
+	restored += int(affected)
+	// Baris yang dilewati INSERT IGNORE (misalnya kursinya sudah dipesan
+	// lagi) tetap di arsip, hanya yang sudah ada di logactivity yang dihapus
+	if _, err := tx.Exec(`
+		DELETE a FROM logactivity_archive a
+		JOIN logactivity l ON l.id = a.id
+		WHERE a.booked_for BETWEEN ? AND ? AND a.archive_reason = 'retention'`, from, to); err != nil {
+		return 0, err
+	}
+
+	// Dari file arsip yang rentangnya beririsan
+	runs, err := tx.Query(`
+		SELECT id, location FROM archive_runs
+		WHERE target = ? AND from_date <= ? AND to_date >= ?`, archiveTargetFile, to, from)
+	if err != nil {
+		return 0, err
+	}
+	type fileRun struct {
+		id       int
+		location string
+	}
+	var files []fileRun
+	for runs.Next() {
+		var f fileRun
+		if err := runs.Scan(&f.id, &f.location); err != nil {
+			runs.Close()
+			return 0, err
+		}
+		files = append(files, f)
+	}
+	runs.Close()
+
+	for _, f := range files {
+		n, err := restoreArchiveFile(tx, f.location, from, to)
+		if err != nil {
+			return 0, fmt.Errorf("failed to restore %s: %v", f.location, err)
+		}
+		if _, err := tx.Exec("UPDATE archive_runs SET restored_rows = restored_rows + ? WHERE id = ?", n, f.id); err != nil {
+			return 0, err
+		}
+		restored += n
+	}
+
+	return restored, tx.Commit()
+}
+
+func restoreArchiveFile(tx *sql.Tx, path, from, to string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(logActivityColumns)), ", ")
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT IGNORE INTO logactivity (%s) VALUES (%s)",
+		strings.Join(logActivityColumns, ", "), placeholders))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	restored := 0
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	for dec.More() {
+		var record map[string]*string
+		if err := dec.Decode(&record); err != nil {
+			return 0, err
+		}
+		day := record["booked_for"]
+		if day == nil || len(*day) < 10 || (*day)[:10] < from || (*day)[:10] > to {
+			continue
+		}
+		args := make([]interface{}, len(logActivityColumns))
+		for i, col := range logActivityColumns {
+			if v := record[col]; v != nil {
+				args[i] = *v
+			}
+		}
+		res, err := stmt.Exec(args...)
+		if err != nil {
+			return 0, err
+		}
+		affected, _ := res.RowsAffected()
+		restored += int(affected)
+	}
+	return restored, nil
+}
+
+// Handler untuk POST /admin/archive/run, menjalankan retensi sekarang
+func runArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	run, err := archiveLogActivity(db, retentionCutoff())
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// Handler untuk GET /admin/archive/runs
+func getArchiveRunsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, target, location, COALESCE(CAST(from_date AS CHAR), ''), CAST(to_date AS CHAR),
+			row_count, restored_rows, CAST(created_at AS CHAR)
+		FROM archive_runs
+		ORDER BY id DESC`)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	runs := []ArchiveRun{}
+	for rows.Next() {
+		var run ArchiveRun
+		if err := rows.Scan(&run.ID, &run.Target, &run.Location, &run.FromDate, &run.ToDate, &run.RowCount, &run.RestoredRows, &run.CreatedAt); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// Handler untuk POST /admin/archive/restore
+func restoreArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	var req RestoreRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	errs := validateStruct(req)
+	if len(errs) == 0 && req.To < req.From {
+		errs["to"] = "must not be before from"
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	holdUntil := time.Now().Add(restoreHold)
+	restored, err := restoreLogActivity(db, req.From, req.To, holdUntil)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RestoreResult{From: req.From, To: req.To, Restored: restored, HoldUntil: holdUntil.Format(time.RFC3339)})
+}
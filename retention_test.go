@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRestoreLogActivityKeepsSkippedRows(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO archive_holds").WithArgs("2025-01-01", "2025-01-31", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT IGNORE INTO logactivity .* FROM logactivity_archive\s+WHERE booked_for BETWEEN \? AND \? AND archive_reason = 'retention'`).
+		WithArgs("2025-01-01", "2025-01-31").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// Hanya arsip yang sekarang ada di logactivity yang dihapus
+	mock.ExpectExec(`DELETE a FROM logactivity_archive a\s+JOIN logactivity l ON l.id = a.id\s+WHERE a.booked_for BETWEEN \? AND \? AND a.archive_reason = 'retention'`).
+		WithArgs("2025-01-01", "2025-01-31").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("SELECT id, location FROM archive_runs").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "location"}))
+	mock.ExpectCommit()
+
+	db := setupDatabase()
+	defer db.Close()
+	restored, err := restoreLogActivity(db, "2025-01-01", "2025-01-31", time.Now().Add(time.Hour))
+	if err != nil || restored != 3 {
+		t.Fatalf("restored = %d, err = %v", restored, err)
+	}
+}
+
+func TestArchiveSkipsRestoredRange(t *testing.T) {
+	mock := useMockDB(t)
+	holdUntil := time.Now().Add(restoreHold)
+	mock.ExpectBegin()
+	hold := &captureArg{}
+	mock.ExpectExec("INSERT INTO archive_holds").WithArgs("2025-01-01", "2025-01-31", hold).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT IGNORE INTO logactivity").WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectExec("DELETE a FROM logactivity_archive").WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectQuery("SELECT id, location FROM archive_runs").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "location"}))
+	mock.ExpectCommit()
+	// Job retention berikutnya hanya melihat hari di luar rentang yang ditahan;
+	// hari yang baru di-restore tidak ikut sehingga tidak ada yang diarsipkan
+	mock.ExpectQuery(`SELECT DISTINCT booked_for FROM logactivity WHERE booked_for < \? AND NOT EXISTS \(\s*SELECT 1 FROM archive_holds h\s+WHERE logactivity.booked_for BETWEEN h.from_date AND h.to_date AND h.hold_until > NOW\(\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"booked_for"}))
+
+	db := setupDatabase()
+	defer db.Close()
+	if _, err := restoreLogActivity(db, "2025-01-01", "2025-01-31", holdUntil); err != nil {
+		t.Fatal(err)
+	}
+	if hold.value != holdUntil.Format(time.DateTime) {
+		t.Errorf("hold_until = %q, want %q", hold.value, holdUntil.Format(time.DateTime))
+	}
+	run, err := archiveLogActivity(db, time.Now())
+	if err != nil || run.RowCount != 0 {
+		t.Fatalf("run = %+v, err = %v", run, err)
+	}
+}
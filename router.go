@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// route mendeskripsikan satu endpoint. Tabel routes dipakai untuk
+// mendaftarkan handler ke ServeMux sekaligus membuat dokumen OpenAPI,
+// jadi setiap endpoint baru cukup ditambahkan di sini.
+type route struct {
+	Method    string
+	Path      string
+	Handler   http.HandlerFunc
+	Auth      string // "" (publik), "user" (login), "active" (login dan sudah disetujui) atau "admin"
+	Tag       string
+	Summary   string
+	Query     []queryParam
+	Request   interface{} // contoh tipe body request, nil jika tanpa body
+	Response  interface{} // contoh tipe body response sukses
+	Status    int         // status sukses, default 200
+	List      bool        // response dibungkus envelope Page
+	Successor string      // diisi untuk path lama yang deprecated
+	Limit     string      // "login" atau "register" untuk proteksi brute force
+}
+
+// queryParam mendeskripsikan parameter query string untuk dokumentasi
+type queryParam struct {
+	Name        string
+	Description string
+}
+
+const (
+	authUser   = "user"
+	authActive = "active"
+	authAdmin  = "admin"
+)
+
+// Semua pattern yang terdaftar di ServeMux, dipakai test kelengkapan OpenAPI
+var registeredPatterns []string
+
+// Parameter standar untuk endpoint list (lihat pagination.go)
+func listQuery(filters ...queryParam) []queryParam {
+	return append([]queryParam{
+		{"limit", "Jumlah item per halaman (1-200, default 50)"},
+		{"cursor", "Cursor dari field next_cursor halaman sebelumnya"},
+		{"sort", "Kolom sort, awali dengan - untuk descending"},
+	}, filters...)
+}
+
+// Parameter rentang tanggal untuk endpoint analitik
+func analyticsQuery(extra ...queryParam) []queryParam {
+	return append([]queryParam{
+		{"from", "Tanggal awal YYYY-MM-DD (default 30 hari terakhir)"},
+		{"to", "Tanggal akhir YYYY-MM-DD (default hari ini)"},
+	}, extra...)
+}
+
+// Parameter untuk endpoint export: format, sort dan filter list
+func exportQuery(filters ...queryParam) []queryParam {
+	return append([]queryParam{
+		{"format", "csv atau xlsx (default csv)"},
+		{"sort", "Kolom sort, awali dengan - untuk descending"},
+	}, filters...)
+}
+
+var legacyIDQuery = []queryParam{{"id", "ID resource"}}
+
+var routes = []route{
+	// Auth
+	{Method: "POST", Path: "/register", Handler: registerHandler, Tag: "auth", Summary: "Register a new user (closed, invite-only or pending admin approval)",
+		Request: RegisterRequest{}, Response: User{}, Status: http.StatusCreated, Limit: limitRegister},
+	{Method: "GET", Path: "/registration", Handler: getRegistrationModeHandler, Tag: "auth", Summary: "Current self-registration mode",
+		Response: RegistrationSettings{}},
+	{Method: "POST", Path: "/login", Handler: loginHandler, Tag: "auth", Summary: "Log in and receive a JWT",
+		Request: LoginRequest{}, Response: LoginResponse{}, Limit: limitLogin},
+	{Method: "POST", Path: "/login/2fa", Handler: loginTwoFactorHandler, Tag: "auth", Summary: "Complete a two-factor login with a TOTP or recovery code",
+		Request: LoginTwoFactorRequest{}, Response: LoginResponse{}, Limit: limitLogin},
+	{Method: "GET", Path: "/auth/oidc/login", Handler: oidcLoginHandler, Tag: "auth", Summary: "Start single sign-on, returns the identity provider authorization URL",
+		Response: OIDCLoginResponse{}, Limit: limitLogin},
+	{Method: "POST", Path: "/auth/oidc/callback", Handler: oidcCallbackHandler, Tag: "auth", Summary: "Finish single sign-on with the code and state from the identity provider redirect",
+		Request: OIDCCallbackRequest{}, Response: LoginResponse{}, Limit: limitLogin},
+
+	// Events
+	{Method: "GET", Path: "/events", Handler: getEventsHandler, Tag: "events", Summary: "List events",
+		Query: listQuery(queryParam{"q", "Cari berdasarkan nama event"}), Response: Event{}, List: true},
+	{Method: "POST", Path: "/events", Handler: createEventHandler, Auth: authAdmin, Tag: "events", Summary: "Create an event",
+		Request: Event{}, Response: Event{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/events/{id}", Handler: getEventHandler, Tag: "events", Summary: "Get an event",
+		Response: Event{}},
+	{Method: "PUT", Path: "/events/{id}", Handler: updateEventHandler, Auth: authAdmin, Tag: "events", Summary: "Replace an event",
+		Request: Event{}, Response: Event{}},
+	{Method: "PATCH", Path: "/events/{id}", Handler: patchEventHandler, Auth: authAdmin, Tag: "events", Summary: "Partially update an event",
+		Request: EventPatch{}, Response: Event{}},
+	{Method: "DELETE", Path: "/events/{id}", Handler: deleteEventHandler, Auth: authAdmin, Tag: "events", Summary: "Delete an event",
+		Response: MessageResponse{}},
+
+	// Bookings (data booking tersimpan di tabel logactivity)
+	{Method: "GET", Path: "/bookings", Handler: getLogActivityHandler, Auth: authActive, Tag: "bookings", Summary: "List bookings from the activity log",
+		Query: listQuery(
+			queryParam{"nama_divisi", "Filter divisi"},
+			queryParam{"status", "Filter status (occupied, available)"},
+			queryParam{"seat", "Filter kursi"},
+			queryParam{"from", "Tanggal awal YYYY-MM-DD"},
+			queryParam{"to", "Tanggal akhir YYYY-MM-DD"},
+		), Response: LogActivity{}, List: true},
+	{Method: "POST", Path: "/bookings", Handler: bookingHandler, Auth: authActive, Tag: "bookings", Summary: "Book a seat",
+		Request: Booking{}, Response: Booking{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/bookings/{id}", Handler: getBookingActivityHandler, Auth: authActive, Tag: "bookings", Summary: "Get activity for a booking",
+		Response: []LogActivity{}},
+	{Method: "DELETE", Path: "/bookings/{id}", Handler: deleteLogActivityHandler, Auth: authActive, Tag: "bookings", Summary: "Delete a booking (owner or admin)",
+		Response: MessageResponse{}},
+	{Method: "POST", Path: "/bookings/{id}/check-in", Handler: checkInBookingHandler, Auth: authActive, Tag: "bookings", Summary: "Check in to a booked seat (owner or admin)",
+		Response: MessageResponse{}},
+	{Method: "POST", Path: "/bookings/{id}/cancel", Handler: cancelBookingHandler, Auth: authActive, Tag: "bookings", Summary: "Cancel a booking (owner or admin)",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/occupied-seats", Handler: getOccupiedSeatsHandler, Tag: "bookings", Summary: "List currently occupied seats",
+		Response: []string{}},
+
+	// Users
+	{Method: "GET", Path: "/users", Handler: getUsersHandler, Auth: authAdmin, Tag: "users", Summary: "List users",
+		Query: listQuery(queryParam{"role", "Filter role (admin, anggota)"}, queryParam{"division", "Filter divisi"}, queryParam{"status", "Filter status (active, pending)"}), Response: User{}, List: true},
+	{Method: "GET", Path: "/users/{id}", Handler: getUserHandler, Auth: authAdmin, Tag: "users", Summary: "Get a user",
+		Response: User{}},
+	{Method: "DELETE", Path: "/users/{id}", Handler: deleteUserHandler, Auth: authAdmin, Tag: "users", Summary: "Delete a user",
+		Response: MessageResponse{}},
+	{Method: "POST", Path: "/admin/users/import", Handler: importUsersHandler, Auth: authAdmin, Tag: "users", Summary: "Bulk import users from CSV (username, fullname, role, division)",
+		Query: []queryParam{
+			{"dry_run", "true untuk melihat hasil tanpa menyimpan"},
+			{"mode", "password (password sementara) atau invite (link undangan)"},
+		}, Response: ImportReport{}},
+	{Method: "POST", Path: "/invitations/accept", Handler: acceptInvitationHandler, Tag: "auth", Summary: "Accept an invitation and set a password",
+		Request: AcceptInvitationRequest{}, Response: MessageResponse{}},
+	{Method: "GET", Path: "/admin/users", Handler: getUsersHandler, Auth: authAdmin, Tag: "users", Summary: "List users (admin only)",
+		Query: listQuery(queryParam{"role", "Filter role (admin, anggota)"}, queryParam{"division", "Filter divisi"}, queryParam{"status", "Filter status (active, pending)"}), Response: User{}, List: true},
+	{Method: "POST", Path: "/admin/users/{id}/approve", Handler: approveUserHandler, Auth: authAdmin, Tag: "users", Summary: "Approve a pending registration and assign its role",
+		Request: ApproveUserRequest{}, Response: User{}},
+	{Method: "POST", Path: "/admin/users/{id}/reject", Handler: rejectUserHandler, Auth: authAdmin, Tag: "users", Summary: "Reject and delete a pending registration",
+		Response: MessageResponse{}},
+	{Method: "POST", Path: "/admin/service-accounts", Handler: createServiceAccountHandler, Auth: authAdmin, Tag: "auth", Summary: "Create a service account that can only use API tokens",
+		Request: CreateServiceAccountRequest{}, Response: User{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/admin/service-accounts/{id}/tokens", Handler: getServiceAccountTokensHandler, Auth: authAdmin, Tag: "auth", Summary: "List API tokens of a service account",
+		Response: []APIToken{}},
+	{Method: "POST", Path: "/admin/service-accounts/{id}/tokens", Handler: createServiceAccountTokenHandler, Auth: authAdmin, Tag: "auth", Summary: "Create an API token for a service account, the token is shown once",
+		Request: CreateAPITokenRequest{}, Response: CreatedAPIToken{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/admin/api-tokens/{id}", Handler: revokeAPITokenHandler, Auth: authAdmin, Tag: "auth", Summary: "Revoke any API token",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/admin/jwt-keys", Handler: getSigningKeysHandler, Auth: authAdmin, Tag: "auth", Summary: "List JWT signing keys (public metadata only)",
+		Response: []SigningKeyInfo{}},
+	{Method: "POST", Path: "/admin/jwt-keys/rotate", Handler: rotateSigningKeyHandler, Auth: authAdmin, Tag: "auth", Summary: "Rotate the JWT signing key now, existing tokens stay valid",
+		Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/admin/jwt-keys/{kid}", Handler: revokeSigningKeyHandler, Auth: authAdmin, Tag: "auth", Summary: "Revoke a compromised signing key, its tokens are rejected",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/admin/users/{id}/sessions", Handler: getUserSessionsHandler, Auth: authAdmin, Tag: "users", Summary: "List a user's active login sessions",
+		Response: []Session{}},
+	{Method: "DELETE", Path: "/admin/users/{id}/sessions", Handler: revokeUserSessionsHandler, Auth: authAdmin, Tag: "users", Summary: "Log a user out everywhere by revoking all their sessions",
+		Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/admin/users/{id}/2fa", Handler: adminResetTwoFactorHandler, Auth: authAdmin, Tag: "users", Summary: "Reset a user's two-factor authentication after a lost device",
+		Response: MessageResponse{}},
+
+	// Pengaturan pendaftaran
+	{Method: "PUT", Path: "/admin/registration", Handler: updateRegistrationModeHandler, Auth: authAdmin, Tag: "auth", Summary: "Set the self-registration mode (closed, invite, approval)",
+		Request: RegistrationSettings{}, Response: RegistrationSettings{}},
+	{Method: "GET", Path: "/admin/invites", Handler: getInvitesHandler, Auth: authAdmin, Tag: "auth", Summary: "List registration invite codes, newest first",
+		Query: listQuery(queryParam{"state", "Filter state (unused, used, expired)"}), Response: RegistrationInvite{}, List: true},
+	{Method: "POST", Path: "/admin/invites", Handler: createInviteHandler, Auth: authAdmin, Tag: "auth", Summary: "Create a single-use invite code tied to a role and division",
+		Request: CreateInviteRequest{}, Response: RegistrationInvite{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/admin/invites/{id}", Handler: revokeInviteHandler, Auth: authAdmin, Tag: "auth", Summary: "Revoke an unused invite code",
+		Response: MessageResponse{}},
+
+	// Contacts
+	{Method: "GET", Path: "/contacts", Handler: getContactsHandlers, Auth: authAdmin, Tag: "contacts", Summary: "List contact form submissions",
+		Query: listQuery(
+			queryParam{"email", "Filter email pengirim"},
+			queryParam{"flagged", "Filter spam (true, false)"},
+		), Response: Contact{}, List: true},
+	{Method: "POST", Path: "/contacts", Handler: ContactHandler, Tag: "contacts", Summary: "Submit the contact form",
+		Request: Contact{}, Response: MessageResponse{}},
+	{Method: "GET", Path: "/contacts/{id}", Handler: getContactHandler, Auth: authAdmin, Tag: "contacts", Summary: "Get a contact submission",
+		Response: Contact{}},
+	{Method: "DELETE", Path: "/contacts/{id}", Handler: deleteContactHandler, Auth: authAdmin, Tag: "contacts", Summary: "Delete a contact submission",
+		Response: MessageResponse{}},
+
+	// Export CSV/XLSX, filter sama dengan endpoint list masing-masing
+	{Method: "GET", Path: "/bookings/export", Handler: exportHandler("logactivity"), Auth: authAdmin, Tag: "exports", Summary: "Export the activity log as CSV or XLSX",
+		Query: exportQuery(
+			queryParam{"nama_divisi", "Filter divisi"},
+			queryParam{"status", "Filter status (occupied, available)"},
+			queryParam{"seat", "Filter kursi"},
+			queryParam{"from", "Tanggal awal YYYY-MM-DD"},
+			queryParam{"to", "Tanggal akhir YYYY-MM-DD"},
+		)},
+	{Method: "GET", Path: "/users/export", Handler: exportHandler("users"), Auth: authAdmin, Tag: "exports", Summary: "Export users as CSV or XLSX",
+		Query: exportQuery(queryParam{"role", "Filter role (admin, anggota)"}, queryParam{"division", "Filter divisi"})},
+	{Method: "GET", Path: "/events/export", Handler: exportHandler("events"), Auth: authAdmin, Tag: "exports", Summary: "Export events as CSV or XLSX",
+		Query: exportQuery(queryParam{"q", "Cari berdasarkan nama event"})},
+	{Method: "GET", Path: "/contacts/export", Handler: exportHandler("contacts"), Auth: authAdmin, Tag: "exports", Summary: "Export contact submissions as CSV or XLSX",
+		Query: exportQuery(
+			queryParam{"email", "Filter email pengirim"},
+			queryParam{"flagged", "Filter spam (true, false)"},
+		)},
+
+	// Seats dan analitik pemakaian
+	{Method: "GET", Path: "/seats", Handler: getSeatsHandler, Tag: "seats", Summary: "List seats with zone and floor",
+		Response: []Seat{}},
+	{Method: "PUT", Path: "/seats/{code}", Handler: putSeatHandler, Auth: authAdmin, Tag: "seats", Summary: "Create or update a seat",
+		Request: Seat{}, Response: Seat{}},
+	{Method: "GET", Path: "/analytics/occupancy", Handler: getOccupancyHandler, Auth: authAdmin, Tag: "analytics", Summary: "Occupancy rate per seat, zone, floor or division",
+		Query: analyticsQuery(queryParam{"group_by", "seat, zone, floor atau division (default seat)"}), Response: OccupancyReport{}},
+	{Method: "GET", Path: "/analytics/summary", Handler: getUsageSummaryHandler, Auth: authAdmin, Tag: "analytics", Summary: "Peak hours, weekdays, no-show, cancellation and lead time",
+		Query: analyticsQuery(), Response: UsageSummary{}},
+	{Method: "POST", Path: "/analytics/rollup", Handler: rebuildRollupHandler, Auth: authAdmin, Tag: "analytics", Summary: "Rebuild daily rollups for a date range",
+		Query: analyticsQuery(), Response: MessageResponse{}},
+
+	// Retensi dan arsip logactivity
+	{Method: "POST", Path: "/admin/archive/run", Handler: runArchiveHandler, Auth: authAdmin, Tag: "archive", Summary: "Archive bookings older than the retention period now",
+		Response: ArchiveRun{}},
+	{Method: "GET", Path: "/admin/archive/runs", Handler: getArchiveRunsHandler, Auth: authAdmin, Tag: "archive", Summary: "List archive runs",
+		Response: []ArchiveRun{}},
+	{Method: "POST", Path: "/admin/archive/restore", Handler: restoreArchiveHandler, Auth: authAdmin, Tag: "archive", Summary: "Restore archived bookings for a date range",
+		Request: RestoreRequest{}, Response: RestoreResult{}},
+
+	// Akun pengguna yang login
+	{Method: "POST", Path: "/me/password", Handler: changePasswordHandler, Auth: authUser, Tag: "auth", Summary: "Change your password (requires the current password)",
+		Request: ChangePasswordRequest{}, Response: MessageResponse{}},
+	{Method: "GET", Path: "/me/sessions", Handler: getMySessionsHandler, Auth: authUser, Tag: "auth", Summary: "List your active login sessions",
+		Response: []Session{}},
+	{Method: "DELETE", Path: "/me/sessions/{id}", Handler: revokeMySessionHandler, Auth: authUser, Tag: "auth", Summary: "Revoke one of your sessions, revoking the current one logs you out",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/me/tokens", Handler: getMyAPITokensHandler, Auth: authUser, Tag: "auth", Summary: "List your personal API tokens",
+		Response: []APIToken{}},
+	{Method: "POST", Path: "/me/tokens", Handler: createMyAPITokenHandler, Auth: authUser, Tag: "auth", Summary: "Create a personal API token with scopes, the token is shown once",
+		Request: CreateAPITokenRequest{}, Response: CreatedAPIToken{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/me/tokens/{id}", Handler: revokeMyAPITokenHandler, Auth: authUser, Tag: "auth", Summary: "Revoke one of your API tokens",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/me/2fa", Handler: getTwoFactorHandler, Auth: authUser, Tag: "auth", Summary: "Two-factor status and remaining recovery codes",
+		Response: TwoFactorStatus{}},
+	{Method: "POST", Path: "/me/2fa/setup", Handler: setupTwoFactorHandler, Auth: authUser, Tag: "auth", Summary: "Start TOTP enrolment (requires the current password), returns the secret, otpauth URI and QR code",
+		Request: TwoFactorSetupRequest{}, Response: TwoFactorSetup{}},
+	{Method: "POST", Path: "/me/2fa/confirm", Handler: confirmTwoFactorHandler, Auth: authUser, Tag: "auth", Summary: "Confirm enrolment with a first code and receive recovery codes",
+		Request: TwoFactorCodeRequest{}, Response: RecoveryCodes{}},
+	{Method: "POST", Path: "/me/2fa/recovery-codes", Handler: regenerateRecoveryCodesHandler, Auth: authUser, Tag: "auth", Summary: "Replace all recovery codes with a new set",
+		Request: TwoFactorCodeRequest{}, Response: RecoveryCodes{}},
+	{Method: "POST", Path: "/me/2fa/disable", Handler: disableTwoFactorHandler, Auth: authUser, Tag: "auth", Summary: "Turn off two-factor authentication (not allowed for admins while mandatory)",
+		Request: DisableTwoFactorRequest{}, Response: MessageResponse{}},
+
+	// Notifikasi milik pengguna yang login
+	{Method: "GET", Path: "/me/notifications", Handler: getNotificationsHandler, Auth: authUser, Tag: "notifications", Summary: "In-app notification inbox, newest first",
+		Query: listQuery(queryParam{"unread", "Filter belum dibaca (true, false)"}), Response: InboxNotification{}, List: true},
+	{Method: "POST", Path: "/me/notifications/{id}/read", Handler: markNotificationReadHandler, Auth: authUser, Tag: "notifications", Summary: "Mark a notification as read",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/me/notification-preferences", Handler: getNotificationSettingsHandler, Auth: authUser, Tag: "notifications", Summary: "Get notification language, addresses and preferences",
+		Response: NotificationSettings{}},
+	{Method: "PUT", Path: "/me/notification-preferences", Handler: putNotificationSettingsHandler, Auth: authActive, Tag: "notifications", Summary: "Update notification language, addresses and preferences, a new email address must be verified",
+		Request: NotificationSettings{}, Response: NotificationSettings{}},
+	{Method: "POST", Path: "/me/notification-preferences/verify-email", Handler: verifyNotificationEmailHandler, Auth: authUser, Tag: "notifications", Summary: "Verify the notification email address with the token from the verification link",
+		Request: VerifyEmailRequest{}, Response: MessageResponse{}},
+
+	// Webhook keluar
+	{Method: "GET", Path: "/admin/webhooks", Handler: getWebhooksHandler, Auth: authAdmin, Tag: "webhooks", Summary: "List webhook subscriptions",
+		Response: []WebhookSubscription{}},
+	{Method: "POST", Path: "/admin/webhooks", Handler: createWebhookHandler, Auth: authAdmin, Tag: "webhooks", Summary: "Create a webhook subscription, the signing secret is returned once",
+		Request: WebhookSubscription{}, Response: WebhookSubscription{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/admin/webhooks/{id}", Handler: getWebhookHandler, Auth: authAdmin, Tag: "webhooks", Summary: "Get a webhook subscription",
+		Response: WebhookSubscription{}},
+	{Method: "PUT", Path: "/admin/webhooks/{id}", Handler: updateWebhookHandler, Auth: authAdmin, Tag: "webhooks", Summary: "Update a webhook subscription",
+		Request: WebhookSubscription{}, Response: WebhookSubscription{}},
+	{Method: "DELETE", Path: "/admin/webhooks/{id}", Handler: deleteWebhookHandler, Auth: authAdmin, Tag: "webhooks", Summary: "Delete a webhook subscription and its delivery log",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/admin/webhooks/{id}/deliveries", Handler: getWebhookDeliveriesHandler, Auth: authAdmin, Tag: "webhooks", Summary: "Delivery log for a subscription, newest first",
+		Query: listQuery(queryParam{"status", "Filter status (pending, sent, failed)"}, queryParam{"event_type", "Filter jenis event"}), Response: WebhookDelivery{}, List: true},
+	{Method: "POST", Path: "/admin/webhooks/deliveries/{id}/redeliver", Handler: redeliverWebhookHandler, Auth: authAdmin, Tag: "webhooks", Summary: "Send a delivery again as a new attempt",
+		Response: WebhookDelivery{}},
+
+	// Proteksi login dan audit log
+	{Method: "GET", Path: "/admin/lockouts", Handler: getLockoutsHandler, Auth: authAdmin, Tag: "auth", Summary: "Accounts with recent failed logins or an active lockout",
+		Response: []LoginLockout{}},
+	{Method: "DELETE", Path: "/admin/lockouts/{username}", Handler: clearLockoutHandler, Auth: authAdmin, Tag: "auth", Summary: "Clear failed logins and unlock an account",
+		Response: MessageResponse{}},
+	{Method: "GET", Path: "/admin/audit-log", Handler: getAuditLogHandler, Auth: authAdmin, Tag: "auth", Summary: "Security audit log, newest first",
+		Query: listQuery(queryParam{"event", "Filter event (login.locked, login.lockout_cleared)"}, queryParam{"username", "Filter username"}), Response: AuditEntry{}, List: true},
+
+	// Job terjadwal
+	{Method: "GET", Path: "/admin/jobs", Handler: getJobsHandler, Auth: authAdmin, Tag: "jobs", Summary: "List scheduled jobs with next and last run",
+		Response: []JobInfo{}},
+	{Method: "GET", Path: "/admin/jobs/{name}/runs", Handler: getJobRunsHandler, Auth: authAdmin, Tag: "jobs", Summary: "Run history for a job, newest first",
+		Query: listQuery(queryParam{"status", "Filter status (running, success, failed)"}, queryParam{"trigger", "Filter trigger (schedule, catchup, manual)"}), Response: JobRun{}, List: true},
+	{Method: "POST", Path: "/admin/jobs/{name}/run", Handler: runJobHandler, Auth: authAdmin, Tag: "jobs", Summary: "Run a job now in the background",
+		Response: JobRun{}, Status: http.StatusAccepted},
+
+	// Monitoring
+	{Method: "GET", Path: "/metrics", Handler: metricsHandler, Tag: "ops", Summary: "Prometheus metrics in text exposition format"},
+	{Method: "GET", Path: "/healthz", Handler: healthzHandler, Tag: "ops", Summary: "Liveness probe, does not touch the database",
+		Response: HealthResponse{}},
+	{Method: "GET", Path: "/readyz", Handler: readyzHandler, Tag: "ops", Summary: "Readiness probe with per-check detail, 503 when not ready or shutting down",
+		Response: HealthResponse{}},
+
+	// Path lama, dipertahankan sementara selama frontend bermigrasi
+	{Method: "DELETE", Path: "/events/delete", Handler: deleteEventHandler, Auth: authAdmin, Tag: "events", Summary: "Delete an event",
+		Query: legacyIDQuery, Response: MessageResponse{}, Successor: "/events/{id}"},
+	{Method: "PUT", Path: "/events/update", Handler: updateEventHandler, Auth: authAdmin, Tag: "events", Summary: "Replace an event",
+		Query: legacyIDQuery, Request: Event{}, Response: Event{}, Successor: "/events/{id}"},
+	{Method: "POST", Path: "/booking", Handler: bookingHandler, Auth: authActive, Tag: "bookings", Summary: "Book a seat",
+		Request: Booking{}, Response: Booking{}, Status: http.StatusCreated, Successor: "/bookings"},
+	{Method: "DELETE", Path: "/users/delete", Handler: deleteUserHandler, Auth: authAdmin, Tag: "users", Summary: "Delete a user",
+		Query: legacyIDQuery, Response: MessageResponse{}, Successor: "/users/{id}"},
+	{Method: "GET", Path: "/logactivity", Handler: getLogActivityHandler, Auth: authActive, Tag: "bookings", Summary: "List bookings from the activity log",
+		Response: []LogActivity{}, Successor: "/bookings"},
+	{Method: "DELETE", Path: "/logactivity/delete", Handler: deleteLogActivityHandler, Auth: authActive, Tag: "bookings", Summary: "Delete a booking (owner or admin)",
+		Query: legacyIDQuery, Response: MessageResponse{}, Successor: "/bookings/{id}"},
+	{Method: "POST", Path: "/contact", Handler: ContactHandler, Tag: "contacts", Summary: "Submit the contact form",
+		Request: Contact{}, Response: MessageResponse{}, Successor: "/contacts"},
+	{Method: "GET", Path: "/api/contact", Handler: getContactsHandlers, Auth: authAdmin, Tag: "contacts", Summary: "List contact form submissions",
+		Response: []Contact{}, Successor: "/contacts"},
+
+	// Kunci publik JWT untuk service lain
+	{Method: "GET", Path: "/.well-known/jwks.json", Handler: jwksHandler, Tag: "auth", Summary: "Public keys for verifying tokens issued by this API",
+		Response: JWKSet{}},
+
+	// Dokumentasi API
+	{Method: "GET", Path: "/openapi.json", Handler: openAPIHandler, Tag: "docs", Summary: "OpenAPI 3 document for this API"},
+	{Method: "GET", Path: "/docs", Handler: docsHandler, Tag: "docs", Summary: "Offline API documentation page"},
+}
+
+// Membuat router dengan pola method + path dari ServeMux Go 1.22.
+// ServeMux otomatis membalas 405 beserta header Allow jika path cocok
+// tetapi method tidak terdaftar.
+func newRouter() http.Handler {
+	mux := http.NewServeMux()
+	registeredPatterns = nil
+	for _, rt := range routes {
+		handler := rt.Handler
+		if rt.Auth != "" {
+			handler = requireScope(routeScope(rt), handler)
+		}
+		switch rt.Auth {
+		case authUser:
+			handler = verifyToken(handler)
+		case authActive:
+			handler = verifyActiveUser(handler)
+		case authAdmin:
+			handler = verifyAdminRole(handler)
+		}
+		if rt.Limit != "" {
+			handler = throttle(rt.Limit, handler)
+		}
+		if rt.Successor != "" {
+			handler = deprecated(rt.Successor, handler)
+		}
+		pattern := rt.Method + " " + rt.Path
+		mux.HandleFunc(pattern, instrumentRoute(rt, handler))
+		registeredPatterns = append(registeredPatterns, pattern)
+	}
+	return withJSONMuxErrors(mux)
+}
+
+// Menandai endpoint lama sebagai deprecated dan menunjuk ke path penggantinya
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		ctx := context.WithValue(r.Context(), legacyRequestKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+const legacyRequestKey contextKey = "legacy_request"
+
+func isLegacyRequest(r *http.Request) bool {
+	legacy, _ := r.Context().Value(legacyRequestKey).(bool)
+	return legacy
+}
+
+// Mengambil ID resource dari path (/events/{id}), dengan fallback ke
+// query string (?id=) untuk path lama
+func pathID(r *http.Request, queryKey string) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get(queryKey)
+}
+
+// muxErrorWriter mengganti body plain text 404/405 bawaan ServeMux dengan
+// format error JSON standar. Header lain (misalnya Allow) tetap dikirim.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	intercepted bool
+}
+
+func (mw *muxErrorWriter) WriteHeader(status int) {
+	isPlain := strings.HasPrefix(mw.Header().Get("Content-Type"), "text/plain")
+	if isPlain && (status == http.StatusNotFound || status == http.StatusMethodNotAllowed) {
+		mw.intercepted = true
+		mw.Header().Del("X-Content-Type-Options")
+		if status == http.StatusNotFound {
+			writeError(mw.ResponseWriter, mw.r, status, codeNotFound, "Not found")
+		} else {
+			writeError(mw.ResponseWriter, mw.r, status, codeMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+	mw.ResponseWriter.WriteHeader(status)
+}
+
+func (mw *muxErrorWriter) Write(b []byte) (int, error) {
+	if mw.intercepted {
+		return len(b), nil
+	}
+	return mw.ResponseWriter.Write(b)
+}
+
+// Flush diteruskan supaya export streaming tetap berjalan
+func (mw *muxErrorWriter) Flush() {
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (mw *muxErrorWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+func withJSONMuxErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&muxErrorWriter{ResponseWriter: w, r: r}, r)
+	})
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler menjalankan job background berdasarkan ekspresi cron. Setiap
+// eksekusi dicatat di tabel job_runs, dan lock MySQL (GET_LOCK) memastikan
+// satu job hanya berjalan di satu instance walaupun ada beberapa replika.
+
+const (
+	jobTriggerSchedule = "schedule"
+	jobTriggerCatchUp  = "catchup"
+	jobTriggerManual   = "manual"
+
+	jobStatusRunning = "running"
+	jobStatusSuccess = "success"
+	jobStatusFailed  = "failed"
+
+	// DSN tidak memakai parseTime, jadi waktu dikirim dan dibaca sebagai string waktu lokal
+	jobTimeLayout = "2006-01-02 15:04:05"
+)
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobLocked   = errors.New("job is already running")
+)
+
+// Job adalah satu pekerjaan terjadwal. Schedule kosong berarti job hanya
+// bisa dijalankan manual lewat admin API.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string
+	// CatchUp menjalankan satu kali jadwal yang terlewat saat server mati
+	CatchUp bool
+	Run     func(ctx context.Context, db *sql.DB) error
+}
+
+// JobRun adalah satu baris riwayat eksekusi job
+type JobRun struct {
+	ID           int64  `json:"id"`
+	Job          string `json:"job"`
+	Trigger      string `json:"trigger"`
+	ScheduledFor string `json:"scheduled_for,omitempty"`
+	StartedAt    string `json:"started_at"`
+	FinishedAt   string `json:"finished_at,omitempty"`
+	Status       string `json:"status"`
+	DurationMs   int64  `json:"duration_ms"`
+	Error        string `json:"error,omitempty"`
+	Instance     string `json:"instance"`
+}
+
+// JobInfo dipakai untuk daftar job di admin API
+type JobInfo struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Schedule    string  `json:"schedule"`
+	NextRun     string  `json:"next_run,omitempty"`
+	LastRun     *JobRun `json:"last_run,omitempty"`
+}
+
+type scheduledJob struct {
+	Job
+	cron *cronSchedule
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+type Scheduler struct {
+	db       *sql.DB
+	jobs     []*scheduledJob
+	byName   map[string]*scheduledJob
+	instance string
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running bool
+}
+
+func newScheduler(db *sql.DB, jobs []Job) (*Scheduler, error) {
+	host, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		db:       db,
+		byName:   make(map[string]*scheduledJob),
+		instance: fmt.Sprintf("%s:%d", host, os.Getpid()),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, job := range jobs {
+		sj := &scheduledJob{Job: job}
+		if job.Schedule != "" {
+			cron, err := parseCron(job.Schedule)
+			if err != nil {
+				cancel()
+				return nil, fmt.Errorf("job %s: %v", job.Name, err)
+			}
+			sj.cron = cron
+		}
+		s.jobs = append(s.jobs, sj)
+		s.byName[job.Name] = sj
+	}
+	return s, nil
+}
+
+// Start menjalankan loop penjadwalan untuk setiap job yang punya schedule
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return
+	}
+	s.running = true
+	for _, job := range s.jobs {
+		if job.cron == nil {
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+}
+
+// Stop menghentikan penjadwalan dan menunggu job yang sedang berjalan selesai
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *Scheduler) loop(job *scheduledJob) {
+	defer s.wg.Done()
+
+	if job.CatchUp {
+		s.catchUp(job)
+	}
+
+	for {
+		next := job.cron.Next(time.Now())
+		job.mu.Lock()
+		job.next = next
+		job.mu.Unlock()
+		// Tidak ada jadwal lagi dalam batas pencarian, job dianggap nonaktif
+		if next.IsZero() {
+			slog.Warn("job has no upcoming run, scheduling stopped", "job", job.Name, "schedule", job.Schedule)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		run, finish, err := s.begin(job, jobTriggerSchedule, next)
+		if err != nil {
+			if err != errJobLocked {
+				slog.Error("job could not start", "job", job.Name, "error", err)
+			}
+			continue
+		}
+		if run != nil {
+			finish()
+		}
+	}
+}
+
+// Menjalankan sekali jadwal terakhir yang terlewat sejak eksekusi terakhir.
+// Job yang belum pernah berjalan tidak di-catch-up.
+func (s *Scheduler) catchUp(job *scheduledJob) {
+	var last sql.NullString
+	err := s.db.QueryRowContext(s.ctx, `
+		SELECT MAX(scheduled_for) FROM job_runs
+		WHERE job_name = ? AND status <> ?`, job.Name, jobStatusRunning).Scan(&last)
+	if err != nil {
+		slog.Error("job catch-up check failed", "job", job.Name, "error", err)
+		return
+	}
+	if !last.Valid {
+		return
+	}
+	lastRun, err := time.ParseInLocation(jobTimeLayout, last.String, time.Local)
+	if err != nil {
+		slog.Error("job catch-up check failed", "job", job.Name, "error", err)
+		return
+	}
+
+	now := time.Now()
+	missed := time.Time{}
+	for t := job.cron.Next(lastRun); !t.IsZero() && !t.After(now); t = job.cron.Next(t) {
+		missed = t
+	}
+	if missed.IsZero() {
+		return
+	}
+
+	slog.Info("job missed a run, catching up", "job", job.Name, "missed", missed.Format(time.RFC3339))
+	run, finish, err := s.begin(job, jobTriggerCatchUp, missed)
+	if err != nil {
+		if err != errJobLocked {
+			slog.Error("job catch-up failed", "job", job.Name, "error", err)
+		}
+		return
+	}
+	if run != nil {
+		finish()
+	}
+}
+
+// Trigger menjalankan job secara manual di background dan langsung
+// mengembalikan catatan run yang sedang berjalan
+func (s *Scheduler) Trigger(name string) (*JobRun, error) {
+	job, ok := s.byName[name]
+	if !ok {
+		return nil, errJobNotFound
+	}
+	run, finish, err := s.begin(job, jobTriggerManual, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		finish()
+	}()
+	return run, nil
+}
+
+// begin mengambil lock job dan mencatat run baru. Jika jadwal yang sama
+// sudah dijalankan instance lain, run dan error keduanya nil.
+func (s *Scheduler) begin(job *scheduledJob, trigger string, scheduledFor time.Time) (*JobRun, func(), error) {
+	conn, err := s.db.Conn(s.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	lockName := "sibakar.job." + job.Name
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(s.ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, nil, errJobLocked
+	}
+	release := func() {
+		var released sql.NullInt64
+		conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName).Scan(&released)
+		conn.Close()
+	}
+
+	// Lock sudah dipegang, jadi run yang masih "running" pasti sisa proses yang mati
+	if _, err := s.db.Exec(`
+		UPDATE job_runs SET status = ?, error = 'interrupted', finished_at = NOW()
+		WHERE job_name = ? AND status = ?`, jobStatusFailed, job.Name, jobStatusRunning); err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	var scheduled interface{}
+	if !scheduledFor.IsZero() {
+		scheduled = scheduledFor.Format(jobTimeLayout)
+		var done int
+		err := s.db.QueryRow(`
+			SELECT COUNT(*) FROM job_runs WHERE job_name = ? AND scheduled_for = ?`,
+			job.Name, scheduled).Scan(&done)
+		if err != nil || done > 0 {
+			release()
+			return nil, nil, err
+		}
+	}
+
+	started := time.Now()
+	res, err := s.db.Exec(`
+		INSERT INTO job_runs (job_name, trigger_type, scheduled_for, started_at, status, instance)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		job.Name, trigger, scheduled, started.Format(jobTimeLayout), jobStatusRunning, s.instance)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	id, _ := res.LastInsertId()
+
+	run := &JobRun{
+		ID:        id,
+		Job:       job.Name,
+		Trigger:   trigger,
+		StartedAt: started.Format(time.RFC3339),
+		Status:    jobStatusRunning,
+		Instance:  s.instance,
+	}
+	if !scheduledFor.IsZero() {
+		run.ScheduledFor = scheduledFor.Format(time.RFC3339)
+	}
+
+	finish := func() {
+		defer release()
+		err := s.execute(job)
+		status, message := jobStatusSuccess, ""
+		if err != nil {
+			status, message = jobStatusFailed, err.Error()
+			slog.Error("job failed", "job", job.Name, "run_id", id, "error", err)
+		}
+		duration := time.Since(started)
+		metricJobRuns.Inc(job.Name, status)
+		metricJobDuration.Observe(duration.Seconds(), job.Name)
+		if err == nil {
+			metricJobLastSuccess.Set(float64(time.Now().Unix()), job.Name)
+		}
+		_, dbErr := s.db.Exec(`
+			UPDATE job_runs SET status = ?, error = NULLIF(?, ''), finished_at = ?, duration_ms = ?
+			WHERE id = ?`, status, message, time.Now().Format(jobTimeLayout), duration.Milliseconds(), id)
+		if dbErr != nil {
+			slog.Error("failed to record job run", "job", job.Name, "run_id", id, "error", dbErr)
+		}
+	}
+	return run, finish, nil
+}
+
+// Panic di dalam job dicatat sebagai kegagalan supaya tidak mematikan server
+func (s *Scheduler) execute(job *scheduledJob) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	// Nama job dibawa lewat context supaya ikut tercatat di log dari dalam job
+	return job.Run(context.WithValue(s.ctx, jobNameKey, job.Name), s.db)
+}
+
+// Jobs mengembalikan daftar job beserta jadwal berikutnya
+func (s *Scheduler) Jobs() []JobInfo {
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := JobInfo{Name: job.Name, Description: job.Description, Schedule: job.Schedule}
+		job.mu.Lock()
+		next := job.next
+		job.mu.Unlock()
+		if next.IsZero() && job.cron != nil {
+			next = job.cron.Next(time.Now())
+		}
+		if !next.IsZero() {
+			info.NextRun = next.Format(time.RFC3339)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// cronSchedule adalah ekspresi cron 5 field: menit jam tanggal bulan hari.
+// Mendukung *, daftar (1,15), rentang (1-5), step (*/10) dan alias @daily,
+// @hourly, @weekly, @monthly.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	if alias, ok := cronAliases[expr]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+
+	c := &cronSchedule{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	bounds := []struct {
+		dest     *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		bits, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+		*b.dest = bits
+	}
+	// 7 juga berarti Minggu
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	// Tanggal yang tidak pernah ada, misalnya "0 0 30 2 *"
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("invalid cron expression %q: never matches", expr)
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next mengembalikan waktu jadwal pertama setelah t, atau waktu nol jika
+// tidak ada jadwal dalam 5 tahun
+func (c *cronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Batas pencarian supaya ekspresi seperti "0 0 30 2 *" tidak loop selamanya
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Seperti cron standar: jika tanggal dan hari sama-sama dibatasi, cukup salah satu yang cocok
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
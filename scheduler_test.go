@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"@daily", "*/15 * * * *", "0 7 * * 1-5", "0 0 29 2 *", "0 0 30 2 1"} {
+		if _, err := parseCron(expr); err != nil {
+			t.Errorf("parseCron(%q) = %v", expr, err)
+		}
+	}
+	for expr, want := range map[string]string{
+		"0 0 30 2 *":  "never matches",
+		"0 0 31 4 *":  "never matches",
+		"0 0 * *":     "expected 5 fields",
+		"60 * * * *":  "out of range",
+		"*/0 * * * *": "invalid step",
+	} {
+		if _, err := parseCron(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseCron(%q) error = %v, want %q", expr, err, want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, 10, 19, 8, 30, 0, 0, time.Local)
+	for expr, want := range map[string]time.Time{
+		"0 7 * * 1-5":  time.Date(2026, 10, 20, 7, 0, 0, 0, time.Local),
+		"*/15 * * * *": time.Date(2026, 10, 19, 8, 45, 0, 0, time.Local),
+		"0 0 29 2 *":   time.Date(2028, 2, 29, 0, 0, 0, 0, time.Local),
+		// Tanggal dan hari sama-sama dibatasi: cukup salah satu, Senin pertama di Februari
+		"0 0 30 2 1": time.Date(2027, 2, 1, 0, 0, 0, 0, time.Local),
+	} {
+		c, err := parseCron(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Next(from); !got.Equal(want) {
+			t.Errorf("Next(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
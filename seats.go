@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Seat berisi data master kursi, dipakai untuk laporan per zona dan lantai
+type Seat struct {
+	Code  string `json:"code"`
+	Zone  string `json:"zone" validate:"max=50"`
+	Floor string `json:"floor" validate:"max=20"`
+}
+
+// Handler untuk mengambil semua kursi
+func getSeatsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	rows, err := db.Query("SELECT code, zone, floor FROM seats ORDER BY code")
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	seats := []Seat{}
+	for rows.Next() {
+		var seat Seat
+		if err := rows.Scan(&seat.Code, &seat.Zone, &seat.Floor); err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		seats = append(seats, seat)
+	}
+
+	writeJSON(w, http.StatusOK, seats)
+}
+
+// Handler untuk menambah atau mengubah zona dan lantai sebuah kursi
+func putSeatHandler(w http.ResponseWriter, r *http.Request) {
+	var seat Seat
+	if !decodeJSON(w, r, &seat) {
+		return
+	}
+	seat.Code = r.PathValue("code")
+	errs := validateStruct(seat)
+	if len(seat.Code) > 20 {
+		errs["code"] = "must be at most 20 characters"
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	_, err := db.Exec(`
+		INSERT INTO seats (code, zone, floor) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE zone = VALUES(zone), floor = VALUES(floor)`,
+		seat.Code, seat.Zone, seat.Floor)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, seat)
+}
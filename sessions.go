@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setiap login membuat satu sesi di user_sessions. ID sesi ikut di claim
+// sid token akses, sehingga token bisa dicabut sebelum kedaluwarsa lewat
+// DELETE /me/sessions/{id} atau "log out everywhere" oleh admin.
+
+const (
+	auditSessionRevoked    = "session.revoked"
+	auditSessionRevokedAll = "session.revoked_all"
+)
+
+// Session adalah sesi login yang masih aktif
+type Session struct {
+	ID         int64  `json:"id"`
+	Device     string `json:"device"`
+	IP         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+// Membuat sesi untuk login yang berhasil dan mengembalikan sid-nya
+func createSession(r *http.Request, db *sql.DB, userID int) (string, error) {
+	sid, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	_, err = db.Exec(`
+		INSERT INTO user_sessions (sid, user_id, device, ip, user_agent, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, NOW(), ?)`,
+		sid, userID, describeDevice(userAgent), clientIP(r), userAgent,
+		time.Now().Add(tokenConfig.TTL).Format(jobTimeLayout))
+	return sid, err
+}
+
+// Ringkasan perangkat dari User-Agent, contoh "Chrome on Windows"
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"}, {"opr/", "Opera"}, {"firefox/", "Firefox"}, {"chrome/", "Chrome"},
+		{"safari/", "Safari"}, {"curl/", "curl"}, {"postman", "Postman"}, {"okhttp", "Android app"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	system := ""
+	for _, o := range []struct{ token, name string }{
+		{"android", "Android"}, {"iphone", "iPhone"}, {"ipad", "iPad"}, {"windows", "Windows"},
+		{"mac os x", "macOS"}, {"cros", "ChromeOS"}, {"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			system = o.name
+			break
+		}
+	}
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
+
+// sessionTokens menolak JWT yang sesinya sudah dicabut atau kedaluwarsa,
+// dan JWT yang terbit sebelum admin mencabut semua sesi pengguna
+type sessionTokens struct {
+	jwt TokenVerifier
+	db  *sql.DB
+}
+
+func (s sessionTokens) Verify(ctx context.Context, token string) (*AccessClaims, error) {
+	claims, err := s.jwt.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var revokedAll bool
+	var sessionID sql.NullInt64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT u.sessions_revoked_at IS NOT NULL AND u.sessions_revoked_at >= FROM_UNIXTIME(?), u.must_change_password, s.id
+		FROM users u
+		LEFT JOIN user_sessions s ON s.sid = ? AND s.user_id = u.id AND s.revoked_at IS NULL AND s.expires_at > NOW()
+		WHERE u.id = ?`, claims.IssuedAt.Unix(), claims.SessionID, claims.Subject).
+		Scan(&revokedAll, &claims.PasswordChangeRequired, &sessionID)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("token subject no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Token tanpa sid terbit sebelum sesi dicatat, tetap berlaku sampai
+	// kedaluwarsa kecuali semua sesi pengguna dicabut setelah token terbit
+	if claims.SessionID == "" {
+		if revokedAll {
+			return nil, errors.New("all sessions of this user were revoked")
+		}
+		return claims, nil
+	}
+	if !sessionID.Valid {
+		return nil, errors.New("session was revoked or has expired")
+	}
+
+	// last_seen_at cukup diperbarui paling sering sekali per menit. Gagal
+	// mencatatnya tidak membuat token yang valid ditolak.
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE user_sessions SET last_seen_at = NOW()
+		WHERE id = ? AND last_seen_at < NOW() - INTERVAL 1 MINUTE`, sessionID.Int64)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to update session last_seen_at", "session_id", sessionID.Int64, "error", err)
+	}
+	return claims, nil
+}
+
+// Mencabut semua sesi pengguna kecuali keepSID (sesi yang sedang dipakai,
+// kosong berarti semua), misalnya setelah password atau 2FA diganti.
+// Token lama tanpa sid ikut ditolak lewat users.sessions_revoked_at.
+func revokeOtherSessions(tx execer, userID int, keepSID, revokedBy string) error {
+	_, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW(), revoked_by = ? WHERE user_id = ? AND sid <> ? AND revoked_at IS NULL",
+		revokedBy, userID, keepSID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET sessions_revoked_at = NOW() WHERE id = ?", userID)
+	return err
+}
+
+func listSessions(db *sql.DB, userID int, currentSID string) ([]Session, error) {
+	rows, err := db.Query(`
+		SELECT id, sid, device, ip, user_agent, CAST(created_at AS CHAR), CAST(last_seen_at AS CHAR), CAST(expires_at AS CHAR)
+		FROM user_sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		var sid string
+		if err := rows.Scan(&s.ID, &sid, &s.Device, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		s.Current = currentSID != "" && sid == currentSID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Handler untuk GET /me/sessions
+func getMySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	sessions, err := listSessions(db, user.ID, currentClaims(r).SessionID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// Handler untuk DELETE /me/sessions/{id}. Mencabut sesi yang sedang dipakai
+// sama dengan logout.
+func revokeMySessionHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	result, err := db.Exec("UPDATE user_sessions SET revoked_at = NOW(), revoked_by = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		user.Username, r.PathValue("id"), user.ID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "No active session with this ID")
+		return
+	}
+	recordAudit(db, r, auditSessionRevoked, user.Username, "id="+r.PathValue("id"))
+
+	writeMessage(w, http.StatusOK, "Session revoked")
+}
+
+// Handler untuk GET /admin/users/{id}/sessions
+func getUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	var exists bool
+	if err := db.QueryRow("SELECT COUNT(*) > 0 FROM users WHERE id = ?", id).Scan(&exists); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !exists {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "User not found")
+		return
+	}
+	sessions, err := listSessions(db, id, "")
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// Handler untuk DELETE /admin/users/{id}/sessions ("log out everywhere").
+// Token lama tanpa sid ikut ditolak lewat users.sessions_revoked_at. API
+// token tidak terpengaruh, cabut lewat DELETE /admin/api-tokens/{id}.
+func revokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	var username string
+	err := db.QueryRow("SELECT username FROM users WHERE id = ?", r.PathValue("id")).Scan(&username)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW(), revoked_by = ? WHERE user_id = ? AND revoked_at IS NULL",
+		currentUsername(r), r.PathValue("id"))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET sessions_revoked_at = NOW() WHERE id = ?", r.PathValue("id")); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	revoked, _ := result.RowsAffected()
+	recordAudit(db, r, auditSessionRevokedAll, username, "sessions="+strconv.FormatInt(revoked, 10))
+
+	writeMessage(w, http.StatusOK, "All sessions revoked")
+}
+
+func pruneSessions(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM user_sessions WHERE expires_at < NOW() - INTERVAL 30 DAY")
+	return err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSessionVerifyIgnoresLastSeenFailure(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT u.sessions_revoked_at").WithArgs(sqlmock.AnyArg(), "sid-1", "7").
+		WillReturnRows(sqlmock.NewRows([]string{"revoked_all", "must_change_password", "id"}).AddRow(false, false, 3))
+	mock.ExpectExec("UPDATE user_sessions SET last_seen_at").WithArgs(3).
+		WillReturnError(errors.New("lock wait timeout"))
+
+	db := setupDatabase()
+	defer db.Close()
+	inner := verifierFunc(func(token string) (*AccessClaims, error) {
+		return &AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "7", IssuedAt: jwt.NewNumericDate(time.Now())},
+			Username:         "budi",
+			SessionID:        "sid-1",
+		}, nil
+	})
+	claims, err := sessionTokens{jwt: inner, db: db}.Verify(context.Background(), "jwt")
+	if err != nil || claims.Username != "budi" {
+		t.Fatalf("claims = %+v, err = %v", claims, err)
+	}
+}
+
+func expectRevokeOtherSessions(mock sqlmock.Sqlmock, userID int, keepSID, revokedBy string) {
+	mock.ExpectExec(`UPDATE user_sessions SET revoked_at = NOW\(\), revoked_by = \? WHERE user_id = \? AND sid <> \?`).
+		WithArgs(revokedBy, userID, keepSID).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE users SET sessions_revoked_at = NOW()").WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	useFastHashing(t)
+	current, err := hashPassword("lama-sekali-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT id, username, fullname, password").WithArgs("budi").
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(7, "budi", "Budi", current, roleMember, userStatusActive, "user", false))
+	mock.ExpectQuery("SELECT password FROM users").WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(current))
+	mock.ExpectQuery("SELECT password_hash FROM password_history").
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO password_history").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE users SET password").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM password_history").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectRevokeOtherSessions(mock, 7, "sid-sekarang", "budi")
+	mock.ExpectCommit()
+	expectAudit(mock, auditPasswordChanged)
+
+	body := `{"current_password":"lama-sekali-123","new_password":"kopi-pagi-di-lantai3"}`
+	r := httptest.NewRequest("POST", "/me/password", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	changePasswordHandler(rec, withClaims(r, &AccessClaims{Username: "budi", SessionID: "sid-sekarang"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminTwoFactorResetRevokesAllSessions(t *testing.T) {
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT username, totp_enabled FROM users").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"username", "totp_enabled"}).AddRow("budi", true))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET totp_secret = NULL").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM recovery_codes").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec("DELETE FROM login_challenges").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectRevokeOtherSessions(mock, 7, "", "admin")
+	mock.ExpectCommit()
+	expectAudit(mock, auditTwoFactorReset)
+
+	r := httptest.NewRequest("DELETE", "/admin/users/7/2fa", nil)
+	r.SetPathValue("id", "7")
+	rec := httptest.NewRecorder()
+	adminResetTwoFactorHandler(rec, withClaims(r, &AccessClaims{Username: "admin", Role: roleAdmin, MFA: true}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claim standar token akses. Diatur lewat env:
+//
+//	JWT_ISSUER    nilai iss (default sibakar)
+//	JWT_AUDIENCE  nilai aud yang wajib ada di token (default sibakar-api)
+//	JWT_TTL       umur token (default 72h)
+//	JWT_LEEWAY    toleransi selisih jam untuk exp/iat/nbf (default 30s)
+type TokenConfig struct {
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+	Leeway   time.Duration
+}
+
+func loadTokenConfig() TokenConfig {
+	return TokenConfig{
+		Issuer:   getEnv("JWT_ISSUER", "sibakar"),
+		Audience: getEnv("JWT_AUDIENCE", "sibakar-api"),
+		TTL:      getEnvDuration("JWT_TTL", 72*time.Hour),
+		Leeway:   getEnvDuration("JWT_LEEWAY", 30*time.Second),
+	}
+}
+
+var tokenConfig = loadTokenConfig()
+
+// TokenIssuer membuat token akses setelah login berhasil
+type TokenIssuer interface {
+	Issue(ctx context.Context, user User, sessionID string, mfa bool) (string, error)
+}
+
+// TokenVerifier memverifikasi token dari header Authorization dan
+// mengembalikan claim-nya
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*AccessClaims, error)
+}
+
+// Claim token akses: claim standar ditambah data yang dipakai middleware
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	MFA      bool   `json:"mfa"`
+	// ID sesi di user_sessions, kosong untuk token sebelum sesi dicatat
+	SessionID string `json:"sid,omitempty"`
+
+	// Diisi untuk request dengan API token, tidak pernah ada di JWT
+	APIToken bool     `json:"-"`
+	Scopes   []string `json:"-"`
+
+	// Dibaca dari users.must_change_password saat verifikasi, misalnya
+	// untuk akun hasil import yang masih memakai password sementara
+	PasswordChangeRequired bool `json:"-"`
+}
+
+// Dibuat di main setelah kunci JWT siap
+var (
+	tokenIssuer   TokenIssuer
+	tokenVerifier TokenVerifier
+)
+
+// Header typ untuk token akses (RFC 9068). Token dari jalur lama
+// (jwt-go v3) tidak punya header ini.
+const accessTokenType = "at+jwt"
+
+// Nama app_settings yang menyimpan waktu pertama kali server memakai
+// jalur token baru
+const settingLegacyTokenCutover = "jwt_legacy_cutover"
+
+// jwtTokens menandatangani dan memverifikasi token dengan kunci dari jwt_keys
+type jwtTokens struct {
+	keys *keyring
+	cfg  TokenConfig
+	// Token tanpa typ at+jwt yang terbit sebelum waktu ini masih diterima
+	// sampai kedaluwarsa. Zero berarti tidak ada masa kompatibilitas.
+	legacyCutover time.Time
+}
+
+func newJWTTokens(keys *keyring, cfg TokenConfig, legacyCutover time.Time) *jwtTokens {
+	return &jwtTokens{keys: keys, cfg: cfg, legacyCutover: legacyCutover}
+}
+
+func (t *jwtTokens) Issue(ctx context.Context, user User, sessionID string, mfa bool) (string, error) {
+	key, err := t.keys.current(ctx)
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.cfg.Issuer,
+			Audience:  jwt.ClaimStrings{t.cfg.Audience},
+			Subject:   strconv.Itoa(user.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.cfg.TTL)),
+			ID:        jti,
+		},
+		Username:  user.Username,
+		Role:      user.Role,
+		MFA:       mfa,
+		SessionID: sessionID,
+	})
+	token.Header["kid"] = key.ID
+	token.Header["typ"] = accessTokenType
+	return token.SignedString(key.Private)
+}
+
+func (t *jwtTokens) Verify(ctx context.Context, tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := t.keys.lookup(ctx, kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// alg di header harus sama dengan kunci, mencegah alg confusion
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.Public(), nil
+	},
+		jwt.WithValidMethods([]string{algRS256, algEdDSA}),
+		jwt.WithIssuer(t.cfg.Issuer),
+		jwt.WithAudience(t.cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(t.cfg.Leeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.ID == "" || claims.IssuedAt == nil {
+		return nil, errors.New("token is missing sub, jti or iat")
+	}
+
+	if typ, _ := token.Header["typ"].(string); typ != accessTokenType {
+		if !claims.IssuedAt.Before(t.legacyCutover) {
+			return nil, errors.New("token was not issued as an access token")
+		}
+		metricLegacyTokens.Inc()
+	}
+	return claims, nil
+}
+
+// Waktu mulai jalur token baru, disimpan sekali di app_settings supaya
+// semua instance dan restart memakai batas yang sama. Token lama
+// otomatis habis dalam JWT_TTL setelah waktu ini.
+func legacyTokenCutover(db *sql.DB) (time.Time, error) {
+	value, err := getSetting(db, settingLegacyTokenCutover, "")
+	if err != nil {
+		return time.Time{}, err
+	}
+	if value == "" {
+		value = time.Now().UTC().Format(time.RFC3339)
+		if _, err := db.Exec("INSERT IGNORE INTO app_settings (name, value, updated_by) VALUES (?, ?, 'system')",
+			settingLegacyTokenCutover, value); err != nil {
+			return time.Time{}, err
+		}
+		// Instance lain mungkin lebih dulu menyimpan
+		if value, err = getSetting(db, settingLegacyTokenCutover, value); err != nil {
+			return time.Time{}, err
+		}
+	}
+	cutover, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s setting %q", settingLegacyTokenCutover, value)
+	}
+	if time.Since(cutover) > tokenConfig.TTL {
+		return time.Time{}, nil
+	}
+	slog.Info("accepting legacy access tokens", "issued_before", cutover.Format(time.RFC3339),
+		"until", cutover.Add(tokenConfig.TTL).Format(time.RFC3339))
+	return cutover, nil
+}
+
+// Membaca dan memverifikasi token dari header Authorization. Menulis 401
+// dan mengembalikan false jika token tidak ada atau tidak valid.
+func bearerClaims(w http.ResponseWriter, r *http.Request) (*AccessClaims, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Token is missing")
+		return nil, false
+	}
+
+	// Menghilangkan "Bearer " di depan token
+	parts := strings.Split(header, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid token format")
+		return nil, false
+	}
+
+	claims, err := tokenVerifier.Verify(r.Context(), parts[1])
+	if err != nil {
+		slog.DebugContext(r.Context(), "rejected access token", "error", err)
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Invalid or expired token")
+		return nil, false
+	}
+
+	// Password sementara wajib diganti dulu, hanya POST /me/password yang boleh
+	if claims.PasswordChangeRequired && !(r.Method == http.MethodPost && r.URL.Path == "/me/password") {
+		writeError(w, r, http.StatusForbidden, codePasswordChangeRequired,
+			"You must change your temporary password first: POST /me/password")
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Keyring berisi kunci tetap tanpa database. Cache dianggap baru dibaca
+// sehingga lookup dan current tidak menyentuh database.
+func staticKeyring(t *testing.T, keys ...signingKey) *keyring {
+	useKeyConfig(t, algEdDSA)
+	ring := newKeyring(nil)
+	for _, key := range keys {
+		ring.keys[key.ID] = key
+	}
+	ring.loadedAt = time.Now()
+	return ring
+}
+
+// Menandatangani claim apa adanya, header typ dan kid diatur pemanggil
+func signTestToken(t *testing.T, key signingKey, method jwt.SigningMethod, header map[string]any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	for name, value := range header {
+		token.Header[name] = value
+	}
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testAccessClaims(issuedAt time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":      tokenConfig.Issuer,
+		"aud":      tokenConfig.Audience,
+		"sub":      "7",
+		"jti":      "jti-test",
+		"iat":      issuedAt.Unix(),
+		"exp":      issuedAt.Add(tokenConfig.TTL).Unix(),
+		"username": "budi",
+		"role":     roleMember,
+	}
+}
+
+func TestJWTTokensRoundTrip(t *testing.T) {
+	key := newTestKey(t, "aktif", algEdDSA, time.Now().Add(-time.Hour))
+	tokens := newJWTTokens(staticKeyring(t, key), tokenConfig, time.Time{})
+
+	token, err := tokens.Issue(context.Background(), User{ID: 7, Username: "budi", Role: roleMember}, "sid-1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := tokens.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "7" || claims.Username != "budi" || claims.SessionID != "sid-1" || !claims.MFA || claims.ID == "" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestJWTTokensLegacyWindow(t *testing.T) {
+	key := newTestKey(t, "aktif", algEdDSA, time.Now().Add(-time.Hour))
+	ring := staticKeyring(t, key)
+	cutover := time.Now().Add(-10 * time.Minute)
+	// Token jwt-go v3 lama: tanpa typ at+jwt
+	legacy := func(issuedAt time.Time) string {
+		return signTestToken(t, key, jwt.SigningMethodEdDSA, map[string]any{"kid": key.ID}, testAccessClaims(issuedAt))
+	}
+
+	for _, tc := range []struct {
+		name    string
+		cutover time.Time
+		token   string
+		ok      bool
+	}{
+		{"issued before cutover", cutover, legacy(cutover.Add(-time.Minute)), true},
+		{"issued after cutover", cutover, legacy(cutover.Add(time.Minute)), false},
+		{"no compatibility window", time.Time{}, legacy(cutover.Add(-time.Minute)), false},
+		{"access token after cutover", cutover, signTestToken(t, key, jwt.SigningMethodEdDSA,
+			map[string]any{"kid": key.ID, "typ": accessTokenType}, testAccessClaims(time.Now())), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newJWTTokens(ring, tokenConfig, tc.cutover).Verify(context.Background(), tc.token)
+			if (err == nil) != tc.ok {
+				t.Errorf("Verify error = %v, want accepted %v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestJWTTokensRejectsKeyMismatch(t *testing.T) {
+	edKey := newTestKey(t, "ed", algEdDSA, time.Now().Add(-time.Hour))
+	rsaKey := newTestKey(t, "rsa", algRS256, time.Now().Add(-time.Hour))
+	tokens := newJWTTokens(staticKeyring(t, edKey, rsaKey), tokenConfig, time.Time{})
+	// Kunci RSA asing dengan kid kunci RSA yang dikenal
+	foreign := newTestKey(t, "rsa", algRS256, time.Now())
+	header := func(kid string) map[string]any { return map[string]any{"kid": kid, "typ": accessTokenType} }
+	claims := testAccessClaims(time.Now())
+
+	for name, token := range map[string]string{
+		"RS256 under an EdDSA kid": signTestToken(t, rsaKey, jwt.SigningMethodRS256, header(edKey.ID), claims),
+		"EdDSA under an RS256 kid": signTestToken(t, edKey, jwt.SigningMethodEdDSA, header(rsaKey.ID), claims),
+		"unknown kid":              signTestToken(t, edKey, jwt.SigningMethodEdDSA, header("hilang"), claims),
+		"missing kid":              signTestToken(t, edKey, jwt.SigningMethodEdDSA, map[string]any{"typ": accessTokenType}, claims),
+		"signed by another key":    signTestToken(t, foreign, jwt.SigningMethodRS256, header(rsaKey.ID), claims),
+		"PS256 with an RSA key":    signTestToken(t, rsaKey, jwt.SigningMethodPS256, header(rsaKey.ID), claims),
+	} {
+		if _, err := tokens.Verify(context.Background(), token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestJWTTokensRequireClaims(t *testing.T) {
+	key := newTestKey(t, "aktif", algEdDSA, time.Now().Add(-time.Hour))
+	tokens := newJWTTokens(staticKeyring(t, key), tokenConfig, time.Time{})
+	header := map[string]any{"kid": key.ID, "typ": accessTokenType}
+
+	for _, claim := range []string{"sub", "jti", "iat", "exp", "iss", "aud"} {
+		claims := testAccessClaims(time.Now())
+		delete(claims, claim)
+		if _, err := tokens.Verify(context.Background(), signTestToken(t, key, jwt.SigningMethodEdDSA, header, claims)); err == nil {
+			t.Errorf("token without %s accepted", claim)
+		}
+	}
+	for claim, value := range map[string]any{"iss": "lain", "aud": "lain", "sub": ""} {
+		claims := testAccessClaims(time.Now())
+		claims[claim] = value
+		if _, err := tokens.Verify(context.Background(), signTestToken(t, key, jwt.SigningMethodEdDSA, header, claims)); err == nil {
+			t.Errorf("token with %s=%q accepted", claim, value)
+		}
+	}
+
+	expired := testAccessClaims(time.Now().Add(-tokenConfig.TTL - time.Minute))
+	if _, err := tokens.Verify(context.Background(), signTestToken(t, key, jwt.SigningMethodEdDSA, header, expired)); err == nil {
+		t.Error("expired token accepted")
+	}
+	future := testAccessClaims(time.Now().Add(time.Hour))
+	if _, err := tokens.Verify(context.Background(), signTestToken(t, key, jwt.SigningMethodEdDSA, header, future)); err == nil {
+		t.Error("token issued in the future accepted")
+	}
+}
@@ -0,0 +1,670 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Autentikasi dua langkah dengan TOTP (RFC 6238). Diatur lewat env:
+//
+//	TOTP_ISSUER          nama yang tampil di aplikasi authenticator (default SIBAKAR)
+//	ADMIN_2FA_REQUIRED   route admin hanya menerima token hasil login 2FA (default true)
+//	LOGIN_CHALLENGE_TTL  masa berlaku challenge setelah password benar (default 5m)
+type TwoFactorConfig struct {
+	Issuer        string
+	AdminRequired bool
+	ChallengeTTL  time.Duration
+}
+
+func loadTwoFactorConfig() TwoFactorConfig {
+	return TwoFactorConfig{
+		Issuer:        getEnv("TOTP_ISSUER", "SIBAKAR"),
+		AdminRequired: getEnv("ADMIN_2FA_REQUIRED", "true") == "true",
+		ChallengeTTL:  getEnvDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute),
+	}
+}
+
+var twoFactorConfig = loadTwoFactorConfig()
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// Kode dari langkah sebelum dan sesudahnya juga diterima, untuk jam HP yang meleset
+	totpSkew = 1
+
+	recoveryCodeCount       = 10
+	loginChallengeAttempts  = 5
+	auditTwoFactorEnabled   = "2fa.enabled"
+	auditTwoFactorDisabled  = "2fa.disabled"
+	auditTwoFactorReset     = "2fa.reset"
+	auditRecoveryRegen      = "2fa.recovery_codes_regenerated"
+	auditRecoveryCodeUsed   = "2fa.recovery_code_used"
+	auditLoginTwoFactorFail = "login.2fa_failed"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Secret 160 bit sesuai rekomendasi RFC 4226
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// HOTP (RFC 4226) untuk satu langkah waktu
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// Mencocokkan kode dengan langkah waktu di sekitar now. Langkah yang sudah
+// pernah dipakai (<= lastStep) ditolak supaya kode tidak bisa dipakai ulang.
+func verifyTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI otpauth:// yang dibaca aplikasi authenticator
+func totpURI(secret, username string) string {
+	label := url.PathEscape(twoFactorConfig.Issuer + ":" + username)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", twoFactorConfig.Issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// QR code PNG dalam bentuk data URI supaya bisa langsung dipasang di <img>
+func totpQRCode(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// Kode cadangan ditampilkan sebagai xxxxx-xxxxx, huruf kecil saja supaya
+// mudah diketik
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := randomPassword(10)
+		if err != nil {
+			return nil, err
+		}
+		code = strings.ToLower(code)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Mengganti semua kode cadangan pengguna dengan set baru
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, sha256Hex(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+type totpState struct {
+	Secret   string
+	Pending  string
+	Enabled  bool
+	LastStep int64
+}
+
+func getTOTPState(db *sql.DB, userID int) (totpState, error) {
+	var s totpState
+	err := db.QueryRow("SELECT COALESCE(totp_secret, ''), COALESCE(totp_pending_secret, ''), totp_enabled, totp_last_step FROM users WHERE id = ?", userID).
+		Scan(&s.Secret, &s.Pending, &s.Enabled, &s.LastStep)
+	return s, err
+}
+
+// Memakai kode TOTP: langkahnya dicatat dengan UPDATE bersyarat supaya dua
+// request bersamaan dengan kode yang sama tidak sama-sama lolos
+func useTOTPCode(db *sql.DB, userID int, secret, code string, lastStep int64) (bool, error) {
+	step, ok := verifyTOTP(secret, strings.TrimSpace(code), lastStep, time.Now())
+	if !ok {
+		return false, nil
+	}
+	result, err := db.Exec("UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1, nil
+}
+
+func useRecoveryCode(db *sql.DB, userID int, code string) (bool, error) {
+	result, err := db.Exec("UPDATE recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		userID, sha256Hex(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1, nil
+}
+
+// Mengecek kode TOTP untuk akun yang 2FA-nya aktif
+func checkTOTP(db *sql.DB, userID int, code string) (bool, error) {
+	state, err := getTOTPState(db, userID)
+	if err != nil {
+		return false, err
+	}
+	if !state.Enabled {
+		return false, nil
+	}
+	return useTOTPCode(db, userID, state.Secret, code, state.LastStep)
+}
+
+// Status 2FA untuk GET /me/2fa
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// Response POST /me/2fa/setup
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"` // data:image/png;base64,...
+}
+
+// Payload POST /me/2fa/setup. Password dicek ulang supaya token yang
+// dicuri tidak bisa dipakai mendaftarkan authenticator milik orang lain.
+type TwoFactorSetupRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+}
+
+// Payload yang berisi satu kode TOTP
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Payload untuk mematikan 2FA
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// Kode cadangan hanya ditampilkan sekali, saat dibuat
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// Payload POST /login/2fa, isi code atau recovery_code
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+func twoFactorRequired(role string) bool {
+	return role == roleAdmin && twoFactorConfig.AdminRequired
+}
+
+// Pengguna yang login saat ini beserta role-nya
+func currentUser(w http.ResponseWriter, r *http.Request, db *sql.DB) (User, bool) {
+	user, err := getUserByUsername(db, currentUsername(r))
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Account no longer exists")
+		return user, false
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return user, false
+	}
+	return user, true
+}
+
+// Handler untuk GET /me/2fa
+func getTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	status := TwoFactorStatus{Enabled: user.TwoFactor, Required: twoFactorRequired(user.Role)}
+	err := db.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", user.ID).
+		Scan(&status.RecoveryCodesRemaining)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// Handler untuk POST /me/2fa/setup. Secret disimpan sebagai pending dan
+// baru aktif setelah dikonfirmasi dengan kode pertama.
+func setupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorSetupRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	if user.TwoFactor {
+		writeError(w, r, http.StatusConflict, codeConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if !checkLockout(w, r, normalizeUsername(user.Username)) {
+		return
+	}
+	if ok, _ := verifyPassword(req.CurrentPassword, user.Password); !ok {
+		if _, err := authLimiter.RecordFailure(r.Context(), normalizeUsername(user.Username), authGuard.Lockout); err != nil {
+			slog.ErrorContext(r.Context(), "failed to record login failure", "error", err)
+		}
+		writeValidationError(w, r, map[string]string{"current_password": "is incorrect"})
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	uri := totpURI(secret, user.Username)
+	qr, err := totpQRCode(uri)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if _, err := db.Exec("UPDATE users SET totp_pending_secret = ? WHERE id = ?", secret, user.ID); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TwoFactorSetup{Secret: secret, OtpauthURI: uri, QRCode: qr})
+}
+
+// Handler untuk POST /me/2fa/confirm
+func confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	state, err := getTOTPState(db, user.ID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if state.Enabled {
+		writeError(w, r, http.StatusConflict, codeConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if state.Pending == "" {
+		writeError(w, r, http.StatusConflict, codeConflict, "Start setup with POST /me/2fa/setup first")
+		return
+	}
+	step, ok := verifyTOTP(state.Pending, strings.TrimSpace(req.Code), 0, time.Now())
+	if !ok {
+		writeValidationError(w, r, map[string]string{"code": "is incorrect"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE users SET totp_secret = totp_pending_secret, totp_pending_secret = NULL, totp_enabled = 1, totp_last_step = ?
+		WHERE id = ? AND totp_pending_secret = ?`, step, user.ID, state.Pending)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditTwoFactorEnabled, user.Username, "")
+
+	writeJSON(w, http.StatusOK, RecoveryCodes{Codes: codes})
+}
+
+// Handler untuk POST /me/2fa/recovery-codes, kode lama tidak berlaku lagi
+func regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorCodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	if !user.TwoFactor {
+		writeError(w, r, http.StatusConflict, codeConflict, "Two-factor authentication is not enabled")
+		return
+	}
+	valid, err := checkTOTP(db, user.ID, req.Code)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !valid {
+		writeValidationError(w, r, map[string]string{"code": "is incorrect"})
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	codes, err := replaceRecoveryCodes(tx, user.ID)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditRecoveryRegen, user.Username, "")
+
+	writeJSON(w, http.StatusOK, RecoveryCodes{Codes: codes})
+}
+
+// Handler untuk POST /me/2fa/disable, butuh password dan kode TOTP
+func disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req DisableTwoFactorRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	user, ok := currentUser(w, r, db)
+	if !ok {
+		return
+	}
+	if !user.TwoFactor {
+		writeError(w, r, http.StatusConflict, codeConflict, "Two-factor authentication is not enabled")
+		return
+	}
+	if twoFactorRequired(user.Role) {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Two-factor authentication is mandatory for admins")
+		return
+	}
+	if !checkLockout(w, r, normalizeUsername(user.Username)) {
+		return
+	}
+	if ok, _ := verifyPassword(req.Password, user.Password); !ok {
+		if _, err := authLimiter.RecordFailure(r.Context(), normalizeUsername(user.Username), authGuard.Lockout); err != nil {
+			slog.ErrorContext(r.Context(), "failed to record login failure", "error", err)
+		}
+		writeValidationError(w, r, map[string]string{"password": "is incorrect"})
+		return
+	}
+	valid, err := checkTOTP(db, user.ID, req.Code)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !valid {
+		writeValidationError(w, r, map[string]string{"code": "is incorrect"})
+		return
+	}
+
+	if err := resetTwoFactor(db, user.ID, currentClaims(r).SessionID, user.Username); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditTwoFactorDisabled, user.Username, "")
+
+	writeMessage(w, http.StatusOK, "Two-factor authentication disabled")
+}
+
+// Mematikan 2FA dan mencabut sesi lain pengguna kecuali keepSID
+func resetTwoFactor(db *sql.DB, userID int, keepSID, revokedBy string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("UPDATE users SET totp_secret = NULL, totp_pending_secret = NULL, totp_enabled = 0, totp_last_step = 0 WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM login_challenges WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if err := revokeOtherSessions(tx, userID, keepSID, revokedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Handler untuk DELETE /admin/users/{id}/2fa, untuk pengguna yang
+// kehilangan perangkat dan kode cadangannya
+func adminResetTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	var username string
+	var enabled bool
+	err := db.QueryRow("SELECT username, totp_enabled FROM users WHERE id = ?", r.PathValue("id")).Scan(&username, &enabled)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !enabled {
+		writeError(w, r, http.StatusConflict, codeConflict, "Two-factor authentication is not enabled for this user")
+		return
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	if err := resetTwoFactor(db, id, "", currentUsername(r)); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	recordAudit(db, r, auditTwoFactorReset, username, "")
+
+	writeMessage(w, http.StatusOK, "Two-factor authentication reset")
+}
+
+// Challenge login langkah kedua: token acak yang hanya disimpan hash-nya
+func createLoginChallenge(db *sql.DB, userID int) (string, time.Time, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(twoFactorConfig.ChallengeTTL)
+	_, err = db.Exec("INSERT INTO login_challenges (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		sha256Hex(token), userID, expiresAt.Format(jobTimeLayout))
+	return token, expiresAt, err
+}
+
+// Handler untuk POST /login/2fa
+func loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req LoginTwoFactorRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	errs := validateStruct(req)
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		errs["code"] = "provide either code or recovery_code"
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	var userID, attempts int
+	err := db.QueryRow(`
+		SELECT user_id, attempts FROM login_challenges
+		WHERE token_hash = ? AND expires_at > NOW()`, sha256Hex(req.ChallengeToken)).Scan(&userID, &attempts)
+	if err == sql.ErrNoRows || attempts >= loginChallengeAttempts {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Login challenge is invalid or expired, please log in again")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	var username string
+	if err := db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !checkLockout(w, r, normalizeUsername(username)) {
+		return
+	}
+
+	var valid bool
+	if req.RecoveryCode != "" {
+		valid, err = useRecoveryCode(db, userID, req.RecoveryCode)
+	} else {
+		valid, err = checkTOTP(db, userID, req.Code)
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if !valid {
+		if _, err := db.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = ?", sha256Hex(req.ChallengeToken)); err != nil {
+			slog.ErrorContext(r.Context(), "failed to count login challenge attempt", "error", err)
+		}
+		recordAudit(db, r, auditLoginTwoFactorFail, username, "")
+		failLogin(w, r, db, username, "Invalid two-factor code")
+		return
+	}
+
+	// Challenge hanya bisa dipakai sekali
+	result, err := db.Exec("DELETE FROM login_challenges WHERE token_hash = ?", sha256Hex(req.ChallengeToken))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Login challenge is invalid or expired, please log in again")
+		return
+	}
+	if req.RecoveryCode != "" {
+		recordAudit(db, r, auditRecoveryCodeUsed, username, "")
+	}
+
+	user, err := getUserByUsername(db, username)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	loginSucceeded(r, username)
+	completeLogin(w, r, db, user, true)
+}
+
+// Menghapus challenge yang sudah kedaluwarsa, dijalankan oleh scheduler
+func pruneLoginChallenges(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DELETE FROM login_challenges WHERE expires_at < NOW()")
+	return err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Secret ASCII "12345678901234567890" dari RFC 6238 lampiran B
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestVerifyTOTPMatchesRFC6238(t *testing.T) {
+	// Kode 8 digit dari RFC dipotong menjadi 6 digit terakhir
+	for unix, code := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		step, ok := verifyTOTP(rfc6238Secret, code, 0, time.Unix(unix, 0))
+		if !ok {
+			t.Errorf("T=%d: code %s rejected", unix, code)
+			continue
+		}
+		if want := unix / totpPeriod; step != want {
+			t.Errorf("T=%d: step = %d, want %d", unix, step, want)
+		}
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, "000000", 0, time.Unix(59, 0)); ok {
+		t.Error("wrong code accepted")
+	}
+}
+
+func TestVerifyTOTPSkewAndReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+
+	// Langkah sebelum dan sesudahnya diterima, dua langkah meleset ditolak
+	for offset, want := range map[int64]bool{-2: false, -1: true, 1: true, 2: false} {
+		if _, ok := verifyTOTP(rfc6238Secret, totpCode(key, current+offset), 0, now); ok != want {
+			t.Errorf("offset %d: accepted = %v, want %v", offset, ok, want)
+		}
+	}
+
+	code := totpCode(key, current)
+	step, ok := verifyTOTP(rfc6238Secret, code, 0, now)
+	if !ok {
+		t.Fatal("fresh code rejected")
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, code, step, now); ok {
+		t.Error("code accepted again after its step was used")
+	}
+	// Kode dari langkah sebelum yang terakhir dipakai juga ditolak
+	if _, ok := verifyTOTP(rfc6238Secret, totpCode(key, current-1), step, now); ok {
+		t.Error("older code accepted after a newer step was used")
+	}
+}
+
+func TestUseTOTPCodeRecordsStep(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	code := totpCode(key, time.Now().Unix()/totpPeriod)
+	mock := useMockDB(t)
+	// Request lain sudah memakai langkah yang sama: UPDATE bersyarat tidak mengubah apa pun
+	mock.ExpectExec(`UPDATE users SET totp_last_step = \? WHERE id = \? AND totp_last_step < \?`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	db := setupDatabase()
+	defer db.Close()
+	if ok, err := useTOTPCode(db, 7, rfc6238Secret, code, 0); ok || err != nil {
+		t.Fatalf("ok = %v, err = %v", ok, err)
+	}
+}
+
+func TestRecoveryCodeIsSingleUse(t *testing.T) {
+	mock := useMockDB(t)
+	hash := sha256Hex("abcde12345")
+	for _, affected := range []int64{1, 0} {
+		mock.ExpectExec(`UPDATE recovery_codes SET used_at = NOW\(\) WHERE user_id = \? AND code_hash = \? AND used_at IS NULL`).
+			WithArgs(7, hash).WillReturnResult(sqlmock.NewResult(0, affected))
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+	// Huruf besar, spasi dan tanda hubung diabaikan
+	if ok, err := useRecoveryCode(db, 7, "ABCDE-12345"); !ok || err != nil {
+		t.Fatalf("first use: ok = %v, err = %v", ok, err)
+	}
+	if ok, err := useRecoveryCode(db, 7, "abcde 12345"); ok || err != nil {
+		t.Fatalf("second use: ok = %v, err = %v", ok, err)
+	}
+}
+
+func TestLoginTwoFactorChallengeAttempts(t *testing.T) {
+	useFreshLimiter(t)
+	challenge := "tantangan"
+	submit := func() *httptest.ResponseRecorder {
+		body := `{"challenge_token":"` + challenge + `","code":"000000"}`
+		rec := httptest.NewRecorder()
+		loginTwoFactorHandler(rec, httptest.NewRequest("POST", "/login/2fa", strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("wrong code counts an attempt", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery("SELECT user_id, attempts FROM login_challenges").WithArgs(sha256Hex(challenge)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "attempts"}).AddRow(7, loginChallengeAttempts-1))
+		mock.ExpectQuery("SELECT username FROM users").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("budi"))
+		mock.ExpectQuery("SELECT COALESCE\\(totp_secret").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"secret", "pending", "enabled", "last_step"}).AddRow(rfc6238Secret, "", true, 0))
+		mock.ExpectExec("UPDATE login_challenges SET attempts = attempts \\+ 1").WithArgs(sha256Hex(challenge)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAudit(mock, auditLoginTwoFactorFail)
+
+		if rec := submit(); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Invalid two-factor code") {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+	})
+
+	t.Run("challenge is dead after the cap", func(t *testing.T) {
+		mock := useMockDB(t)
+		mock.ExpectQuery("SELECT user_id, attempts FROM login_challenges").WithArgs(sha256Hex(challenge)).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "attempts"}).AddRow(7, loginChallengeAttempts))
+		// Kode tidak dicek sama sekali, bahkan kode yang benar pun ditolak
+
+		if rec := submit(); rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "log in again") {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestTwoFactorSetupRequiresPassword(t *testing.T) {
+	useFastHashing(t)
+	useFreshLimiter(t)
+	hash, err := hashPassword("rahasia-admin-123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{}`, http.StatusBadRequest},
+		{`{"current_password":"tebakan"}`, http.StatusBadRequest},
+		{`{"current_password":"rahasia-admin-123"}`, http.StatusOK},
+	} {
+		t.Run(tc.body, func(t *testing.T) {
+			mock := useMockDB(t)
+			if tc.body != `{}` {
+				mock.ExpectQuery("SELECT id, username, fullname, password").WithArgs("admin").
+					WillReturnRows(sqlmock.NewRows(userColumns).AddRow(1, "admin", "Admin", hash, roleAdmin, userStatusActive, "user", false))
+			}
+			if tc.want == http.StatusOK {
+				mock.ExpectExec("UPDATE users SET totp_pending_secret").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			r := httptest.NewRequest("POST", "/me/2fa/setup", strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+			setupTwoFactorHandler(rec, withClaims(r, &AccessClaims{Username: "admin", Role: roleAdmin}))
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Import pengguna massal dari CSV dengan kolom: username, fullname, role, division.
+// Semua baris divalidasi dulu; jika ada satu saja yang salah, tidak ada yang disimpan.
+
+const (
+	importModePassword = "password" // buat password sementara
+	importModeInvite   = "invite"   // buat link undangan untuk set password sendiri
+
+	importCreate = "create"
+	importUpdate = "update"
+	importSkip   = "skip"
+	importError  = "error"
+)
+
+// Satu baris CSV yang akan diimport
+type ImportRow struct {
+	Username string `json:"username" validate:"required,min=3,max=50"`
+	Fullname string `json:"fullname" validate:"required,max=100"`
+	Role     string `json:"role" validate:"required,oneof=admin anggota"`
+	Division string `json:"division" validate:"max=100"`
+}
+
+type ImportOptions struct {
+	DryRun bool
+	Mode   string
+}
+
+// Hasil untuk satu baris CSV
+type ImportResult struct {
+	Line         int               `json:"line"`
+	Username     string            `json:"username"`
+	Action       string            `json:"action"`
+	Errors       map[string]string `json:"errors,omitempty"`
+	TempPassword string            `json:"temp_password,omitempty"`
+	InviteLink   string            `json:"invite_link,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Applied bool           `json:"applied"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Skipped int            `json:"skipped"`
+	Failed  int            `json:"failed"`
+	Results []ImportResult `json:"results"`
+}
+
+var importColumns = []string{"username", "fullname", "role", "division"}
+
+// csvFormatError menandai file CSV yang tidak bisa dibaca (kesalahan dari client)
+type csvFormatError struct {
+	msg string
+}
+
+func (e *csvFormatError) Error() string {
+	return e.msg
+}
+
+// Membaca CSV, header wajib ada di baris pertama (urutan kolom bebas)
+func parseImportCSV(r io.Reader) ([]ImportRow, []int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, &csvFormatError{fmt.Sprintf("failed to read CSV header: %v", err)}
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, col := range importColumns[:3] {
+		if _, ok := index[col]; !ok {
+			return nil, nil, &csvFormatError{fmt.Sprintf("CSV header is missing column %q", col)}
+		}
+	}
+
+	get := func(record []string, col string) string {
+		if i, ok := index[col]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []ImportRow
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, nil, err
+		}
+		if err != nil {
+			return nil, nil, &csvFormatError{fmt.Sprintf("failed to read CSV: %v", err)}
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, ImportRow{
+			Username: get(record, "username"),
+			Fullname: get(record, "fullname"),
+			Role:     get(record, "role"),
+			Division: get(record, "division"),
+		})
+		lines = append(lines, line)
+	}
+	return rows, lines, nil
+}
+
+// Menjalankan import dalam satu transaksi. Dry run menjalankan logika yang
+// sama lalu rollback, jadi hasilnya persis seperti import sungguhan.
+func importUsers(db *sql.DB, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun, Results: []ImportResult{}}
+
+	rows, lines, err := parseImportCSV(r)
+	if err != nil {
+		return report, err
+	}
+
+	// Validasi semua baris, termasuk username ganda di dalam file
+	seen := map[string]int{}
+	for i, row := range rows {
+		result := ImportResult{Line: lines[i], Username: row.Username}
+		errs := validateStruct(row)
+		key := strings.ToLower(row.Username)
+		if first, ok := seen[key]; ok && row.Username != "" {
+			errs["username"] = fmt.Sprintf("duplicate of line %d", first)
+		} else {
+			seen[key] = lines[i]
+		}
+		if len(errs) > 0 {
+			result.Action = importError
+			result.Errors = errs
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	for i, row := range rows {
+		result := &report.Results[i]
+		if result.Action == importError {
+			continue
+		}
+
+		var id int64
+		var fullname, role, division string
+		err := tx.QueryRow("SELECT id, fullname, role, division FROM users WHERE username = ? FOR UPDATE", row.Username).
+			Scan(&id, &fullname, &role, &division)
+		switch {
+		case err == sql.ErrNoRows:
+			result.Action = importCreate
+			report.Created++
+			if !opts.DryRun {
+				if err := createImportedUser(tx, row, opts.Mode, result); err != nil {
+					return report, err
+				}
+			}
+		case err != nil:
+			return report, err
+		case fullname == row.Fullname && role == row.Role && division == row.Division:
+			result.Action = importSkip
+			report.Skipped++
+		default:
+			result.Action = importUpdate
+			report.Updated++
+			_, err := tx.Exec("UPDATE users SET fullname = ?, role = ?, division = ? WHERE id = ?", row.Fullname, row.Role, row.Division, id)
+			if err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if opts.DryRun || report.Failed > 0 {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+	report.Applied = true
+	return report, nil
+}
+
+func createImportedUser(tx *sql.Tx, row ImportRow, mode string, result *ImportResult) error {
+	// Mode undangan: password acak yang tidak pernah diberikan ke siapa pun,
+	// pengguna mengatur password sendiri lewat link undangan
+	password, err := randomPassword(16)
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO users (username, fullname, password, role, division, must_change_password)
+		VALUES (?, ?, ?, ?, ?, 1)`,
+		row.Username, row.Fullname, hash, row.Role, row.Division)
+	if err != nil {
+		return err
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if mode != importModeInvite {
+		result.TempPassword = password
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO user_invitations (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		userID, sha256Hex(token), time.Now().Add(invitationTTL))
+	if err != nil {
+		return err
+	}
+	result.InviteLink = invitationBaseURL + "?token=" + token
+	return nil
+}
+
+var (
+	invitationBaseURL = getEnv("INVITE_BASE_URL", "http://localhost:5173/invite")
+	invitationTTL     = getEnvDuration("INVITE_TTL", 7*24*time.Hour)
+)
+
+// Handler untuk POST /admin/users/import?dry_run=true&mode=password|invite.
+// Body berupa CSV langsung (text/csv) atau multipart dengan field "file".
+func importUsersHandler(w http.ResponseWriter, r *http.Request) {
+	opts := ImportOptions{DryRun: r.URL.Query().Get("dry_run") == "true", Mode: r.URL.Query().Get("mode")}
+	if opts.Mode == "" {
+		opts.Mode = importModePassword
+	}
+	if opts.Mode != importModePassword && opts.Mode != importModeInvite {
+		writeValidationError(w, r, map[string]string{"mode": "must be one of: password, invite"})
+		return
+	}
+
+	// Batas dipasang di r.Body supaya berlaku juga untuk r.FormFile
+	r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+	var body io.Reader = r.Body
+	var maxBytesErr *http.MaxBytesError
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, codeBadRequest, "CSV file is too large")
+			return
+		}
+		if err != nil {
+			writeValidationError(w, r, map[string]string{"file": "is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	report, err := importUsers(db, body, opts)
+	var formatErr *csvFormatError
+	switch {
+	case errors.As(err, &formatErr):
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, formatErr.Error())
+		return
+	case errors.As(err, &maxBytesErr):
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeBadRequest, "CSV file is too large")
+		return
+	case err != nil:
+		writeInternalError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, report)
+}
+
+// Payload untuk menerima undangan dan mengatur password
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Handler untuk POST /invitations/accept
+func acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var req AcceptInvitationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if errs := validateStruct(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var invitationID, userID int64
+	var username string
+	err = tx.QueryRow(`
+		SELECT i.id, i.user_id, u.username FROM user_invitations i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.token_hash = ? AND i.used_at IS NULL AND i.expires_at > NOW()
+		FOR UPDATE`, sha256Hex(req.Token)).Scan(&invitationID, &userID, &username)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invitation is invalid or has expired")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	if msg := checkPasswordPolicy(req.Password, username); msg != "" {
+		writeValidationError(w, r, map[string]string{"password": msg})
+		return
+	}
+
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ?, must_change_password = 0 WHERE id = ?", hash, userID); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE user_invitations SET used_at = NOW() WHERE id = ?", invitationID); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeMessage(w, http.StatusOK, "Password has been set, you can now log in")
+}
+
+// Subcommand CLI: be-sibakar import-users [-dry-run] [-mode password|invite] users.csv
+func runImportUsersCommand(args []string) int {
+	fs := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "tampilkan apa yang akan dilakukan tanpa menyimpan")
+	mode := fs.String("mode", importModePassword, "password (password sementara) atau invite (link undangan)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: be-sibakar import-users [-dry-run] [-mode password|invite] users.csv")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || (*mode != importModePassword && *mode != importModeInvite) {
+		fs.Usage()
+		return 2
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	db := setupDatabase()
+	defer db.Close()
+	if err := runMigrations(db); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	report, err := importUsers(db, file, ImportOptions{DryRun: *dryRun, Mode: *mode})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Import failed:", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tUSERNAME\tACTION\tDETAIL")
+	for _, res := range report.Results {
+		detail := res.TempPassword + res.InviteLink
+		for field, msg := range res.Errors {
+			detail += field + " " + msg + "; "
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", res.Line, res.Username, res.Action, detail)
+	}
+	tw.Flush()
+
+	fmt.Printf("\ncreated=%d updated=%d skipped=%d failed=%d\n", report.Created, report.Updated, report.Skipped, report.Failed)
+	switch {
+	case report.Failed > 0:
+		fmt.Println("Nothing was imported because some rows are invalid.")
+		return 1
+	case report.DryRun:
+		fmt.Println("Dry run: no changes were saved.")
+	default:
+		fmt.Println("Import applied.")
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validasi deklaratif berdasarkan tag `validate` pada struct, contoh:
+//
+//	Role string `json:"role" validate:"required,oneof=admin anggota"`
+//
+// Aturan yang didukung: required, min=N, max=N (panjang karakter),
+// oneof=a b c, email, phone, date (YYYY-MM-DD), url (http/https). Nama field di pesan error
+// diambil dari tag json.
+func validateStruct(v interface{}) map[string]string {
+	errs := make(map[string]string)
+
+	val := reflect.Indirect(reflect.ValueOf(v))
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || field.Type.Kind() != reflect.String {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if msg := checkRules(val.Field(i).String(), tag); msg != "" {
+			errs[name] = msg
+		}
+	}
+	return errs
+}
+
+// Cek satu nilai terhadap daftar aturan, kembalikan pesan error pertama
+func checkRules(value, rules string) string {
+	trimmed := strings.TrimSpace(value)
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name != "required" && trimmed == "" {
+			// Field opsional yang kosong tidak perlu dicek lebih lanjut
+			return ""
+		}
+		switch name {
+		case "required":
+			if trimmed == "" {
+				return "is required"
+			}
+		case "min":
+			n, _ := strconv.Atoi(arg)
+			if utf8.RuneCountInString(value) < n {
+				return fmt.Sprintf("must be at least %d characters", n)
+			}
+		case "max":
+			n, _ := strconv.Atoi(arg)
+			if utf8.RuneCountInString(value) > n {
+				return fmt.Sprintf("must be at most %d characters", n)
+			}
+		case "oneof":
+			allowed := strings.Fields(arg)
+			found := false
+			for _, a := range allowed {
+				if value == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "must be one of: " + strings.Join(allowed, ", ")
+			}
+		case "email":
+			if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+				return "must be a valid email address"
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				return "must be a date in YYYY-MM-DD format"
+			}
+		case "phone":
+			if !phonePattern.MatchString(value) {
+				return "must be a valid phone number"
+			}
+		case "url":
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return "must be a valid http or https URL"
+			}
+		case "https":
+			if u, err := url.Parse(value); err != nil || u.Scheme != "https" || u.Host == "" {
+				return "must be a valid https URL"
+			}
+		}
+	}
+	return ""
+}
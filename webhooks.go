@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook keluar untuk sistem lain (HR, facilities). Event dicatat ke tabel
+// webhook_deliveries oleh kode yang sama dengan yang menyimpan data, lalu
+// job "webhooks" mengirimnya dengan tanda tangan HMAC-SHA256 dan retry.
+//
+// Verifikasi di sisi penerima:
+//
+//	expected = hex(HMAC-SHA256(secret, X-Sibakar-Timestamp + "." + body))
+//	X-Sibakar-Signature == "sha256=" + expected
+
+const (
+	webhookBookingCreated   = "booking.created"
+	webhookBookingCancelled = "booking.cancelled"
+	webhookBookingCheckedIn = "booking.checked_in"
+	webhookContactReceived  = "contact.received"
+	webhookEventCreated     = "event.created"
+	webhookEventUpdated     = "event.updated"
+	webhookEventDeleted     = "event.deleted"
+)
+
+var webhookEventTypes = []string{
+	webhookBookingCreated,
+	webhookBookingCancelled,
+	webhookBookingCheckedIn,
+	webhookContactReceived,
+	webhookEventCreated,
+	webhookEventUpdated,
+	webhookEventDeleted,
+}
+
+var (
+	webhookMaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	webhookTimeout     = getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+)
+
+// WebhookSubscription adalah satu URL tujuan beserta event yang didengarkan.
+// EventTypes berisi nama event atau "*" untuk semua event.
+type WebhookSubscription struct {
+	ID          int      `json:"id"`
+	URL         string   `json:"url" validate:"required,url,max=500"`
+	EventTypes  []string `json:"event_types"`
+	Description string   `json:"description" validate:"max=255"`
+	Active      bool     `json:"active"`
+	// Secret hanya dikirim sekali saat subscription dibuat
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// WebhookDelivery adalah satu percobaan pengiriman event ke satu subscription
+type WebhookDelivery struct {
+	ID             int64  `json:"id"`
+	SubscriptionID int    `json:"subscription_id"`
+	EventType      string `json:"event_type"`
+	EventID        string `json:"event_id"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ResponseCode   int    `json:"response_code,omitempty"`
+	ResponseBody   string `json:"response_body,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	DeliveredAt    string `json:"delivered_at,omitempty"`
+}
+
+// Isi body yang dikirim ke subscriber
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt string      `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Mencatat event untuk semua subscription aktif yang mendengarkannya.
+// Dipanggil setelah data tersimpan, error cukup dicatat oleh pemanggil.
+func publishWebhookEvent(db *sql.DB, eventType string, data interface{}) error {
+	rows, err := db.Query(`
+		SELECT id FROM webhook_subscriptions
+		WHERE active = 1 AND (FIND_IN_SET(?, event_types) > 0 OR FIND_IN_SET('*', event_types) > 0)`, eventType)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	eventID, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(webhookPayload{
+		ID:        eventID,
+		Type:      eventType,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err := db.Exec(`
+			INSERT INTO webhook_deliveries (subscription_id, event_type, event_id, payload, status)
+			VALUES (?, ?, ?, ?, ?)`, id, eventType, eventID, string(payload), outboxPending)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func logWebhookError(eventType string, err error) {
+	if err != nil {
+		slog.Error("failed to queue webhook", "event_type", eventType, "error", err)
+	}
+}
+
+// Tanda tangan mencakup timestamp supaya payload lama tidak bisa dikirim ulang
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookAttempt struct {
+	ID       int64
+	EventID  string
+	Type     string
+	Payload  string
+	Attempts int
+	URL      string
+	Secret   string
+}
+
+// Job pengirim webhook. Gagal dicoba lagi dengan jeda 1, 2, 4, ... menit
+// (maksimal 6 jam) sampai WEBHOOK_MAX_ATTEMPTS.
+func deliverWebhooks(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT d.id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.status = ? AND d.next_attempt_at <= NOW() AND s.active = 1
+		ORDER BY d.id
+		LIMIT 200`, outboxPending)
+	if err != nil {
+		return err
+	}
+	var attempts []webhookAttempt
+	for rows.Next() {
+		var a webhookAttempt
+		if err := rows.Scan(&a.ID, &a.EventID, &a.Type, &a.Payload, &a.Attempts, &a.URL, &a.Secret); err != nil {
+			rows.Close()
+			return err
+		}
+		attempts = append(attempts, a)
+	}
+	rows.Close()
+
+	client := &http.Client{Timeout: webhookTimeout}
+	failed := 0
+	for _, a := range attempts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		ok, err := attemptWebhook(ctx, db, client, a)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d webhook deliveries failed, will retry", failed, len(attempts))
+	}
+	return nil
+}
+
+// Mengirim satu delivery dan mencatat hasilnya. Error hanya untuk kegagalan database.
+func attemptWebhook(ctx context.Context, db *sql.DB, client *http.Client, a webhookAttempt) (bool, error) {
+	code, body, sendErr := sendWebhook(ctx, client, a)
+	attempts := a.Attempts + 1
+
+	if sendErr == nil {
+		_, err := db.ExecContext(ctx, `
+			UPDATE webhook_deliveries
+			SET status = ?, attempts = ?, response_code = ?, response_body = ?, last_error = NULL, delivered_at = NOW()
+			WHERE id = ?`, outboxSent, attempts, code, body, a.ID)
+		return true, err
+	}
+
+	status := outboxPending
+	if attempts >= webhookMaxAttempts {
+		status = outboxFailed
+	}
+	var responseCode interface{}
+	if code > 0 {
+		responseCode = code
+	}
+	backoff := retryBackoff(a.Attempts, time.Minute, 6*time.Hour)
+	_, err := db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, response_code = ?, response_body = ?, last_error = ?,
+			next_attempt_at = NOW() + INTERVAL ? SECOND
+		WHERE id = ?`, status, attempts, responseCode, body, sendErr.Error(), int(backoff.Seconds()), a.ID)
+	return false, err
+}
+
+func sendWebhook(ctx context.Context, client *http.Client, a webhookAttempt) (int, string, error) {
+	body := []byte(a.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sibakar-webhooks/1")
+	req.Header.Set("X-Sibakar-Event", a.Type)
+	req.Header.Set("X-Sibakar-Event-ID", a.EventID)
+	req.Header.Set("X-Sibakar-Delivery", strconv.FormatInt(a.ID, 10))
+	req.Header.Set("X-Sibakar-Timestamp", timestamp)
+	req.Header.Set("X-Sibakar-Signature", signWebhook(a.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	// Simpan sebagian response untuk log, cukup untuk debugging
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(snippet), fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(snippet), nil
+}
+
+func validateWebhookSubscription(sub WebhookSubscription) map[string]string {
+	errs := validateStruct(sub)
+	if len(sub.EventTypes) == 0 {
+		errs["event_types"] = "is required"
+	}
+	for _, typ := range sub.EventTypes {
+		if typ != "*" && !containsString(webhookEventTypes, typ) {
+			errs["event_types"] = "must contain only: *, " + strings.Join(webhookEventTypes, ", ")
+			break
+		}
+	}
+	return errs
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+const webhookSubscriptionColumns = "id, url, event_types, description, active, CAST(created_at AS CHAR)"
+
+func scanWebhookSubscription(scan func(dest ...interface{}) error) (WebhookSubscription, error) {
+	var sub WebhookSubscription
+	var eventTypes string
+	err := scan(&sub.ID, &sub.URL, &eventTypes, &sub.Description, &sub.Active, &sub.CreatedAt)
+	sub.EventTypes = strings.Split(eventTypes, ",")
+	return sub, err
+}
+
+// Handler untuk GET /admin/webhooks
+func getWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	rows, err := db.Query("SELECT " + webhookSubscriptionColumns + " FROM webhook_subscriptions ORDER BY id")
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	subs := []WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows.Scan)
+		if err != nil {
+			writeInternalError(w, r, err)
+			return
+		}
+		subs = append(subs, sub)
+	}
+
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// Handler untuk GET /admin/webhooks/{id}
+func getWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	sub, err := scanWebhookSubscription(db.QueryRow("SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = ?", r.PathValue("id")).Scan)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// Handler untuk POST /admin/webhooks. Secret dibuat server dan hanya
+// ditampilkan di response ini.
+func createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub := WebhookSubscription{Active: true}
+	if !decodeJSON(w, r, &sub) {
+		return
+	}
+	if errs := validateWebhookSubscription(sub); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec("INSERT INTO webhook_subscriptions (url, secret, event_types, description, active) VALUES (?, ?, ?, ?, ?)",
+		sub.URL, secret, strings.Join(sub.EventTypes, ","), sub.Description, sub.Active)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	id, _ := result.LastInsertId()
+	sub.ID = int(id)
+	sub.Secret = secret
+	sub.CreatedAt = ""
+
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+// Handler untuk PUT /admin/webhooks/{id}. Secret tidak berubah.
+func updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var sub WebhookSubscription
+	if !decodeJSON(w, r, &sub) {
+		return
+	}
+	if errs := validateWebhookSubscription(sub); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhook_subscriptions WHERE id = ?", r.PathValue("id")).Scan(&exists); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if exists == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+
+	_, err := db.Exec("UPDATE webhook_subscriptions SET url = ?, event_types = ?, description = ?, active = ? WHERE id = ?",
+		sub.URL, strings.Join(sub.EventTypes, ","), sub.Description, sub.Active, r.PathValue("id"))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	updated, err := scanWebhookSubscription(db.QueryRow("SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = ?", r.PathValue("id")).Scan)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// Handler untuk DELETE /admin/webhooks/{id}, log pengiriman ikut dihapus
+func deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := db.Exec("DELETE FROM webhook_subscriptions WHERE id = ?", r.PathValue("id"))
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Webhook not found")
+		return
+	}
+	if _, err := db.Exec("DELETE FROM webhook_deliveries WHERE subscription_id = ?", r.PathValue("id")); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	writeMessage(w, http.StatusOK, "Webhook deleted successfully")
+}
+
+var webhookDeliveryListSpec = listSpec{
+	Table:       "webhook_deliveries",
+	Sortable:    map[string]string{"id": "id", "created_at": "created_at"},
+	DefaultSort: "id",
+	// Filter: ?status=&event_type=
+	Filters: func(r *http.Request, p *pageRequest, errs map[string]string) {
+		p.Filter("subscription_id = ?", r.PathValue("id"))
+		p.FilterParam(r, "status", "status")
+		p.FilterParam(r, "event_type", "event_type")
+	},
+}
+
+const webhookDeliveryColumns = `id, subscription_id, event_type, event_id, status, attempts, COALESCE(response_code, 0),
+	COALESCE(response_body, ''), COALESCE(last_error, ''), CAST(created_at AS CHAR), COALESCE(CAST(delivered_at AS CHAR), '')`
+
+func webhookDeliveryDest(d *WebhookDelivery) []interface{} {
+	return []interface{}{&d.ID, &d.SubscriptionID, &d.EventType, &d.EventID, &d.Status, &d.Attempts, &d.ResponseCode,
+		&d.ResponseBody, &d.LastError, &d.CreatedAt, &d.DeliveredAt}
+}
+
+// Handler untuk GET /admin/webhooks/{id}/deliveries, terbaru lebih dulu
+func getWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	page, errs := parsePageRequest(r, webhookDeliveryListSpec)
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if r.URL.Query().Get("sort") == "" {
+		page.Desc = true
+	}
+
+	db := setupDatabase()
+	defer db.Close()
+
+	result, err := page.Query(db, webhookDeliveryColumns, func() (interface{}, []interface{}) {
+		d := &WebhookDelivery{}
+		return d, webhookDeliveryDest(d)
+	})
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writePage(w, r, result)
+}
+
+// Handler untuk POST /admin/webhooks/deliveries/{id}/redeliver. Payload yang
+// sama dikirim ulang sebagai delivery baru supaya log lama tetap utuh.
+func redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	db := setupDatabase()
+	defer db.Close()
+
+	var a webhookAttempt
+	var subscriptionID int
+	err := db.QueryRow(`
+		SELECT d.subscription_id, d.event_id, d.event_type, d.payload, s.url, s.secret
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.id = ?`, r.PathValue("id")).
+		Scan(&subscriptionID, &a.EventID, &a.Type, &a.Payload, &a.URL, &a.Secret)
+	if err == sql.ErrNoRows {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Delivery not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO webhook_deliveries (subscription_id, event_type, event_id, payload, status)
+		VALUES (?, ?, ?, ?, ?)`, subscriptionID, a.Type, a.EventID, a.Payload, outboxPending)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	a.ID, _ = result.LastInsertId()
+
+	// Percobaan pertama langsung dijalankan supaya admin melihat hasilnya,
+	// jika gagal delivery ini ikut dicoba lagi oleh job webhooks
+	client := &http.Client{Timeout: webhookTimeout}
+	if _, err := attemptWebhook(r.Context(), db, client, a); err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+
+	var delivery WebhookDelivery
+	err = db.QueryRow("SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", a.ID).Scan(webhookDeliveryDest(&delivery)...)
+	if err != nil {
+		writeInternalError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}